@@ -0,0 +1,25 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/26
+
+//go:build !windows
+// +build !windows
+
+package acme
+
+import (
+	"os"
+	"syscall"
+)
+
+func lockFile(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	return syscall.Flock(int(f.Fd()), how)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,559 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/26
+
+// Package acme obtains and renews the certificates of the router hosts from an ACME CA.
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	xacme "golang.org/x/crypto/acme"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/metrics"
+	tls2 "github.com/crochee/proxy/tls"
+)
+
+const (
+	// DefaultCAServer is the directory of the Let's Encrypt production CA.
+	DefaultCAServer = "https://acme-v02.api.letsencrypt.org/directory"
+	// DefaultStorage is the storage file used when none is configured.
+	DefaultStorage = "acme.json"
+	// DefaultRenewBefore is how long before their expiry the certificates are renewed by default.
+	DefaultRenewBefore = 30 * 24 * time.Hour
+
+	// checkInterval is the period of the renewal checks.
+	checkInterval = time.Hour
+	// obtainTimeout bounds the order of a certificate.
+	obtainTimeout = 5 * time.Minute
+)
+
+// KeyTypes are the supported types of certificate keys.
+var KeyTypes = map[string]func() (crypto.Signer, error){
+	"EC256":   func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P256(), rand.Reader) },
+	"EC384":   func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P384(), rand.Reader) },
+	"RSA2048": func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 2048) },
+	"RSA4096": func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 4096) },
+}
+
+// Provider obtains the certificates of the domains, renews them before they expire,
+// and serves them through the certificate stores of the TLS entry points.
+type Provider struct {
+	cfg         *config.ACME
+	store       *LocalStore
+	client      *xacme.Client
+	newKey      func() (crypto.Signer, error)
+	renewBefore time.Duration
+	refresh     chan struct{}
+
+	mu           sync.RWMutex
+	domains      []string
+	stores       []*tls2.CertificateStore
+	certificates map[string]*tls.Certificate
+	// tokens holds the key authorizations of the pending HTTP-01 challenges.
+	tokens map[string]string
+	// challengeCerts holds the certificates of the pending TLS-ALPN-01 challenges by domain.
+	challengeCerts map[string]*tls.Certificate
+}
+
+// NewProvider creates a Provider, the account is registered by Run.
+func NewProvider(cfg *config.ACME) (*Provider, error) {
+	keyType := cfg.KeyType
+	if keyType == "" {
+		keyType = "EC256"
+	}
+	newKey, ok := KeyTypes[keyType]
+	if !ok {
+		return nil, fmt.Errorf("acme: unknown key type %s", keyType)
+	}
+	httpClient, err := newHTTPClient(cfg.CACertificates)
+	if err != nil {
+		return nil, err
+	}
+	caServer := cfg.CAServer
+	if caServer == "" {
+		caServer = DefaultCAServer
+	}
+	storage := cfg.Storage
+	if storage == "" {
+		storage = DefaultStorage
+	}
+	renewBefore := cfg.RenewBefore
+	if renewBefore == 0 {
+		renewBefore = DefaultRenewBefore
+	}
+	return &Provider{
+		cfg:   cfg,
+		store: NewLocalStore(storage),
+		client: &xacme.Client{
+			DirectoryURL: caServer,
+			HTTPClient:   httpClient,
+		},
+		newKey:         newKey,
+		renewBefore:    renewBefore,
+		refresh:        make(chan struct{}, 1),
+		certificates:   make(map[string]*tls.Certificate),
+		tokens:         make(map[string]string),
+		challengeCerts: make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// newHTTPClient returns the client reaching the CA, trusting caCertificates in addition to the system roots.
+func newHTTPClient(caCertificates []tls2.FileOrContent) (*http.Client, error) {
+	if len(caCertificates) == 0 {
+		return http.DefaultClient, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, caCertificate := range caCertificates {
+		content, err := caCertificate.Read()
+		if err != nil {
+			return nil, fmt.Errorf("acme: unable to read CA certificate: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, errors.New("acme: no certificate found in CA certificate")
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport, Timeout: time.Minute}, nil
+}
+
+// Domains returns the hosts of the routers a certificate can be ordered for,
+// the IP addresses and the wildcards are left out since they cannot be validated by HTTP-01 nor TLS-ALPN-01.
+func Domains(list []*config.ProxyHost) []string {
+	seen := make(map[string]struct{})
+	var domains []string
+	for _, proxyHost := range list {
+		for _, origin := range proxyHost.Origin {
+			domain := origin
+			if host, _, err := net.SplitHostPort(origin); err == nil {
+				domain = host
+			}
+			domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+			if domain == "" || strings.Contains(domain, "*") || net.ParseIP(domain) != nil {
+				continue
+			}
+			if _, ok := seen[domain]; ok {
+				continue
+			}
+			seen[domain] = struct{}{}
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// SetDomains sets the domains the certificates are obtained for, the missing certificates are ordered by Run.
+func (p *Provider) SetDomains(domains []string) {
+	p.mu.Lock()
+	p.domains = domains
+	p.mu.Unlock()
+	select {
+	case p.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// AddStore serves the certificates through store.
+func (p *Provider) AddStore(store *tls2.CertificateStore) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stores = append(p.stores, store)
+	for domain, cert := range p.certificates {
+		if err := store.AddCertificate(cert); err != nil {
+			logger.Errorf("Unable to add the ACME certificate of %s: %v", domain, err)
+		}
+	}
+}
+
+// HTTPChallengeHandler answers the HTTP-01 challenges and passes the other requests to next.
+func (p *Provider) HTTPChallengeHandler(next http.Handler) http.Handler {
+	const prefix = "/.well-known/acme-challenge/"
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.URL.Path, prefix) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+		p.mu.RLock()
+		keyAuth, ok := p.tokens[strings.TrimPrefix(req.URL.Path, prefix)]
+		p.mu.RUnlock()
+		if !ok {
+			http.NotFound(rw, req)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/plain")
+		_, _ = rw.Write([]byte(keyAuth))
+	})
+}
+
+// TLSChallenge makes config answer the TLS-ALPN-01 challenges, it must be called before the TLS listener is served.
+func (p *Provider) TLSChallenge(config *tls.Config) {
+	config.NextProtos = append(config.NextProtos, xacme.ALPNProto)
+	next := config.GetCertificate
+	config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == xacme.ALPNProto {
+			p.mu.RLock()
+			cert, ok := p.challengeCerts[strings.ToLower(hello.ServerName)]
+			p.mu.RUnlock()
+			if !ok {
+				return nil, fmt.Errorf("no TLS-ALPN-01 challenge for %q", hello.ServerName)
+			}
+			return cert, nil
+		}
+		return next(hello)
+	}
+}
+
+// Run registers the account, then obtains the missing certificates and renews the expiring ones until ctx is done.
+func (p *Provider) Run(ctx context.Context) {
+	log := logger.FromContext(ctx)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-p.refresh:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+		if err := p.renew(ctx); err != nil {
+			log.Errorf("ACME: %v", err)
+		}
+		timer.Reset(checkInterval)
+	}
+}
+
+// renew serves the stored certificates and orders the missing and expiring ones.
+func (p *Provider) renew(ctx context.Context) error {
+	if err := p.register(ctx); err != nil {
+		return err
+	}
+	p.mu.RLock()
+	domains := p.domains
+	p.mu.RUnlock()
+	var failed []string
+	for _, domain := range domains {
+		if err := p.renewDomain(ctx, domain); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", domain, err))
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("unable to obtain the certificates, retrying in %s: %s", checkInterval, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// register loads the account of the storage, or registers a new one on the CA.
+func (p *Provider) register(ctx context.Context) error {
+	if p.client.Key != nil {
+		return nil
+	}
+	return p.store.Update(func(data *StoredData) error {
+		if account := data.Account; account != nil && account.CAServer == p.client.DirectoryURL {
+			key, err := parsePrivateKey(account.PrivateKey)
+			if err != nil {
+				return fmt.Errorf("account key: %w", err)
+			}
+			p.client.Key = key
+			return nil
+		}
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		p.client.Key = key
+		account := &xacme.Account{}
+		if p.cfg.Email != "" {
+			account.Contact = []string{"mailto:" + p.cfg.Email}
+		}
+		if account, err = p.client.Register(ctx, account, p.acceptTOS); err != nil {
+			p.client.Key = nil
+			return fmt.Errorf("unable to register the account: %w", err)
+		}
+		var keyPEM []byte
+		if keyPEM, err = encodePrivateKey(key); err != nil {
+			return err
+		}
+		data.Account = &Account{
+			Email:      p.cfg.Email,
+			CAServer:   p.client.DirectoryURL,
+			URI:        account.URI,
+			PrivateKey: keyPEM,
+		}
+		// the certificates of another CA are renewed with the new account.
+		data.Certificates = nil
+		logger.FromContext(ctx).Infof("ACME account registered on %s", p.client.DirectoryURL)
+		return nil
+	})
+}
+
+// renewDomain serves the stored certificate of domain, another proxy sharing the storage may have obtained it,
+// and orders a new one when it is missing or expires within renewBefore.
+func (p *Provider) renewDomain(ctx context.Context, domain string) error {
+	data, err := p.store.Load()
+	if err != nil {
+		return err
+	}
+	if stored := data.GetCertificate(domain); stored != nil {
+		cert, err := parseCertificate(stored)
+		if err != nil {
+			logger.FromContext(ctx).Errorf("ACME: invalid stored certificate for %s: %v", domain, err)
+		} else {
+			p.serve(domain, cert)
+			if time.Now().Before(p.renewAt(cert.Leaf)) {
+				return nil
+			}
+		}
+	}
+
+	// the storage stays locked while the certificate is ordered, the proxies sharing it
+	// wait for the lock and find the certificate renewed instead of ordering it again.
+	var cert *tls.Certificate
+	var obtained bool
+	if err = p.store.Update(func(data *StoredData) error {
+		if stored := data.GetCertificate(domain); stored != nil {
+			if renewed, err := parseCertificate(stored); err == nil && time.Now().Before(p.renewAt(renewed.Leaf)) {
+				cert = renewed
+				return nil
+			}
+		}
+		ctx, cancel := context.WithTimeout(ctx, obtainTimeout)
+		defer cancel()
+		stored, err := p.obtain(ctx, domain)
+		if err != nil {
+			return err
+		}
+		if cert, err = parseCertificate(stored); err != nil {
+			return err
+		}
+		data.SetCertificate(stored)
+		obtained = true
+		return nil
+	}); err != nil {
+		return err
+	}
+	p.serve(domain, cert)
+	if obtained {
+		logger.FromContext(ctx).Infof("ACME certificate obtained for %s, valid until %s",
+			domain, cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// acceptTOS accepts the terms of service of the CA when the configuration does.
+func (p *Provider) acceptTOS(tosURL string) bool {
+	if !p.cfg.AcceptTOS {
+		logger.Errorf("ACME: the terms of service %s of the CA are not accepted", tosURL)
+	}
+	return p.cfg.AcceptTOS
+}
+
+// parseCertificate parses the key pair of stored, its leaf included.
+func parseCertificate(stored *Certificate) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(stored.Certificate, stored.Key)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// renewAt returns when the certificate is renewed, renewBefore its expiry
+// but no sooner than two thirds of its lifetime so that the short-lived certificates are not renewed on each check.
+func (p *Provider) renewAt(leaf *x509.Certificate) time.Time {
+	renewBefore := p.renewBefore
+	if lifetime := leaf.NotAfter.Sub(leaf.NotBefore); renewBefore > lifetime/3 {
+		renewBefore = lifetime / 3
+	}
+	return leaf.NotAfter.Add(-renewBefore)
+}
+
+// serve swaps the certificate of domain in the stores.
+func (p *Provider) serve(domain string, cert *tls.Certificate) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	previous := p.certificates[domain]
+	if previous != nil && previous.Leaf.Equal(cert.Leaf) {
+		return
+	}
+	for _, store := range p.stores {
+		if err := store.UpdateCertificate(previous, cert); err != nil {
+			logger.Errorf("Unable to add the ACME certificate of %s: %v", domain, err)
+		}
+	}
+	p.certificates[domain] = cert
+	if previous != nil {
+		metrics.DeleteCertificate(previous.Leaf)
+	}
+	metrics.SetCertificateExpiry(cert.Leaf)
+}
+
+// obtain orders a certificate for domain, solving its authorizations with the configured challenges.
+func (p *Provider) obtain(ctx context.Context, domain string) (*Certificate, error) {
+	order, err := p.client.AuthorizeOrder(ctx, xacme.DomainIDs(domain))
+	if err != nil {
+		return nil, err
+	}
+	// the orders fetched afterwards carry no URL.
+	orderURL := order.URI
+	for _, authzURL := range order.AuthzURLs {
+		if err = p.authorize(ctx, authzURL); err != nil {
+			return nil, err
+		}
+	}
+	if order, err = p.client.WaitOrder(ctx, orderURL); err != nil {
+		return nil, err
+	}
+
+	var key crypto.Signer
+	if key, err = p.newKey(); err != nil {
+		return nil, err
+	}
+	var csr []byte
+	if csr, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, key); err != nil {
+		return nil, err
+	}
+	var chain [][]byte
+	if chain, _, err = p.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true); err != nil {
+		// x/crypto waits for an order being processed at the Location of the finalize response,
+		// the CAs omitting it, such as Pebble, are waited for at the URL of the order.
+		if order, _ = p.client.WaitOrder(ctx, orderURL); order == nil || order.Status != xacme.StatusValid {
+			return nil, err
+		}
+		if chain, err = p.client.FetchCert(ctx, order.CertURL, true); err != nil {
+			return nil, err
+		}
+	}
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	var keyPEM []byte
+	if keyPEM, err = encodePrivateKey(key); err != nil {
+		return nil, err
+	}
+	return &Certificate{Domain: domain, Certificate: certPEM, Key: keyPEM}, nil
+}
+
+// authorize solves a pending authorization, preferring TLS-ALPN-01 when both challenges are configured.
+func (p *Provider) authorize(ctx context.Context, authzURL string) error {
+	authz, err := p.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	if authz.Status != xacme.StatusPending {
+		return nil
+	}
+	var supported []string
+	if p.cfg.TLSChallenge != nil {
+		supported = append(supported, "tls-alpn-01")
+	}
+	if p.cfg.HTTPChallenge != nil {
+		supported = append(supported, "http-01")
+	}
+	var challenge *xacme.Challenge
+	for _, typ := range supported {
+		for _, c := range authz.Challenges {
+			if c.Type == typ {
+				challenge = c
+				break
+			}
+		}
+		if challenge != nil {
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("the CA offers none of the %s challenges for %s", strings.Join(supported, ", "), authz.Identifier.Value)
+	}
+
+	domain := strings.ToLower(authz.Identifier.Value)
+	switch challenge.Type {
+	case "tls-alpn-01":
+		var cert tls.Certificate
+		if cert, err = p.client.TLSALPN01ChallengeCert(challenge.Token, domain); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.challengeCerts[domain] = &cert
+		p.mu.Unlock()
+		defer func() {
+			p.mu.Lock()
+			delete(p.challengeCerts, domain)
+			p.mu.Unlock()
+		}()
+	case "http-01":
+		var keyAuth string
+		if keyAuth, err = p.client.HTTP01ChallengeResponse(challenge.Token); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.tokens[challenge.Token] = keyAuth
+		p.mu.Unlock()
+		defer func() {
+			p.mu.Lock()
+			delete(p.tokens, challenge.Token)
+			p.mu.Unlock()
+		}()
+	}
+	if _, err = p.client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	_, err = p.client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+func encodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func parsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/26
+
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/config"
+	tls2 "github.com/crochee/proxy/tls"
+)
+
+func TestDomains(t *testing.T) {
+	domains := Domains([]*config.ProxyHost{
+		{Origin: []string{"b.example.com", "A.example.com:8443", "127.0.0.1", "*.example.com"}},
+		{Origin: []string{"b.example.com.", "[::1]:443"}},
+	})
+	if want := []string{"a.example.com", "b.example.com"}; !reflect.DeepEqual(domains, want) {
+		t.Errorf("got %v, want %v", domains, want)
+	}
+}
+
+func TestLocalStoreUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acme.json")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// each proxy has its own store on the shared file.
+			if err := NewLocalStore(path).Update(func(data *StoredData) error {
+				data.SetCertificate(&Certificate{Domain: strconv.Itoa(i) + ".example.com"})
+				return nil
+			}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	data, err := NewLocalStore(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(data.Certificates); n != 10 {
+		t.Fatalf("expected the 10 updates to be kept, got %d certificates", n)
+	}
+}
+
+// TestObtainWithPebble obtains certificates from a Pebble test CA started with its default configuration:
+//
+//	pebble -config test/config/pebble-config.json
+//	pebble_directory=https://localhost:14000/dir pebble_ca=test/certs/pebble.minica.pem go test ./acme
+//
+// Pebble validates the challenges of localhost on the ports 5002 and 5001.
+func TestObtainWithPebble(t *testing.T) {
+	directory, ok := os.LookupEnv("pebble_directory")
+	if !ok {
+		t.Skip("pebble_directory is not set")
+	}
+	const domain = "localhost"
+	newProvider := func(t *testing.T, storage string, challenge *config.ACMEChallenge) *Provider {
+		cfg := &config.ACME{
+			AcceptTOS:      true,
+			CAServer:       directory,
+			Storage:        storage,
+			CACertificates: []tls2.FileOrContent{tls2.FileOrContent(os.Getenv("pebble_ca"))},
+		}
+		if challenge.EntryPoint == "web" {
+			cfg.HTTPChallenge = challenge
+		} else {
+			cfg.TLSChallenge = challenge
+		}
+		provider, err := NewProvider(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		provider.SetDomains([]string{domain})
+		return provider
+	}
+	serve := func(t *testing.T, address string, tlsConfig *tls.Config, handler http.Handler) {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		server := &http.Server{Handler: handler}
+		go server.Serve(listener)
+		t.Cleanup(func() { server.Close() })
+	}
+
+	for _, entryPoint := range []config.ServerName{"web", "websecure"} {
+		t.Run(string(entryPoint), func(t *testing.T) {
+			storage := filepath.Join(t.TempDir(), "acme.json")
+			provider := newProvider(t, storage, &config.ACMEChallenge{EntryPoint: entryPoint})
+			store, err := tls2.NewCertificateStore(string(entryPoint), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			provider.AddStore(store)
+			if entryPoint == "web" {
+				serve(t, "127.0.0.1:5002", nil, provider.HTTPChallengeHandler(http.NotFoundHandler()))
+			} else {
+				tlsConfig := &tls.Config{GetCertificate: store.GetCertificate}
+				provider.TLSChallenge(tlsConfig)
+				serve(t, "127.0.0.1:5001", tlsConfig, http.NotFoundHandler())
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err = provider.renew(ctx); err != nil {
+				t.Fatal(err)
+			}
+			cert := store.Match(domain)
+			if cert == nil {
+				t.Fatal("the obtained certificate is not served")
+			}
+			if len(cert.Certificate) < 2 {
+				t.Errorf("expected the chain of the certificate, got %d certificates", len(cert.Certificate))
+			}
+
+			// another proxy sharing the storage serves the stored certificate without ordering a new one.
+			other := newProvider(t, storage, &config.ACMEChallenge{EntryPoint: entryPoint})
+			otherStore, err := tls2.NewCertificateStore(string(entryPoint), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other.AddStore(otherStore)
+			if err = other.renew(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if shared := otherStore.Match(domain); shared == nil || !shared.Leaf.Equal(cert.Leaf) {
+				t.Error("the stored certificate is not shared")
+			}
+		})
+	}
+}
+
+func TestRenewAt(t *testing.T) {
+	provider := &Provider{renewBefore: DefaultRenewBefore}
+	now := time.Now()
+	for lifetime, want := range map[time.Duration]time.Duration{
+		90 * 24 * time.Hour: 60 * 24 * time.Hour,
+		6 * 24 * time.Hour:  4 * 24 * time.Hour,
+	} {
+		leaf := &x509.Certificate{NotBefore: now, NotAfter: now.Add(lifetime)}
+		if got := provider.renewAt(leaf).Sub(now); got != want {
+			t.Errorf("lifetime %s: renewed after %s, want %s", lifetime, got, want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/26
+
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// StoredData is the content of the storage file.
+type StoredData struct {
+	Account      *Account       `json:"account,omitempty"`
+	Certificates []*Certificate `json:"certificates,omitempty"`
+}
+
+// Account is the ACME account the certificates are ordered with.
+type Account struct {
+	Email string `json:"email,omitempty"`
+	// CAServer is the directory URL the account is registered on.
+	CAServer string `json:"caServer"`
+	URI      string `json:"uri,omitempty"`
+	// PrivateKey is the PEM encoded key of the account.
+	PrivateKey []byte `json:"privateKey"`
+}
+
+// Certificate is a certificate obtained for a domain.
+type Certificate struct {
+	Domain string `json:"domain"`
+	// Certificate is the PEM encoded chain, the leaf first.
+	Certificate []byte `json:"certificate"`
+	// Key is the PEM encoded private key.
+	Key []byte `json:"key"`
+}
+
+// GetCertificate returns the certificate of domain, nil when none is stored.
+func (d *StoredData) GetCertificate(domain string) *Certificate {
+	for _, cert := range d.Certificates {
+		if cert.Domain == domain {
+			return cert
+		}
+	}
+	return nil
+}
+
+// SetCertificate stores cert in place of the certificate of the same domain.
+func (d *StoredData) SetCertificate(cert *Certificate) {
+	for i, stored := range d.Certificates {
+		if stored.Domain == cert.Domain {
+			d.Certificates[i] = cert
+			return
+		}
+	}
+	d.Certificates = append(d.Certificates, cert)
+}
+
+// LocalStore persists the data in a JSON file.
+// The file is locked while it is read or updated, so that several proxies can share it.
+type LocalStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewLocalStore creates a LocalStore persisting in the file path.
+func NewLocalStore(path string) *LocalStore {
+	return &LocalStore{path: path}
+}
+
+// Load reads the stored data, it is empty when the file does not exist.
+func (s *LocalStore) Load() (*StoredData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return s.read()
+}
+
+// Update reads the stored data, modifies it with fn and writes it back while holding the lock.
+// The file is left untouched when fn fails.
+func (s *LocalStore) Update(fn func(*StoredData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var data *StoredData
+	if data, err = s.read(); err != nil {
+		return err
+	}
+	if err = fn(data); err != nil {
+		return err
+	}
+	return s.write(data)
+}
+
+// lock locks the file beside the storage, the storage itself is replaced on each write.
+func (s *LocalStore) lock(exclusive bool) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to lock %s: %w", f.Name(), err)
+	}
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+func (s *LocalStore) read() (*StoredData, error) {
+	data := &StoredData{}
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return data, nil
+		}
+		return nil, err
+	}
+	if len(content) == 0 {
+		return data, nil
+	}
+	if err = json.Unmarshal(content, data); err != nil {
+		return nil, fmt.Errorf("unable to decode %s: %w", s.path, err)
+	}
+	return data, nil
+}
+
+// write replaces the file so that a reader never sees a partial content.
+func (s *LocalStore) write(data *StoredData) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	var f *os.File
+	if f, err = ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*"); err != nil {
+		return err
+	}
+	if _, err = f.Write(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err = os.Rename(f.Name(), s.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
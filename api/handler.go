@@ -0,0 +1,264 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/23
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/router"
+	serverhttp "github.com/crochee/proxy/server/http"
+	"github.com/crochee/proxy/tls"
+)
+
+// Prefix is the path under which the admin endpoints are served.
+const Prefix = "/api/"
+
+const redacted = "REDACTED"
+
+// Manager gives access to the active configuration and applies its changes.
+type Manager interface {
+	Config() *config.Config
+	Routing() *serverhttp.Routing
+	Update(fn func(cfg *config.Config) error) error
+}
+
+// Handler serves the admin REST API:
+//
+//	GET  /api/entrypoints
+//	GET  /api/routers
+//	GET  /api/services
+//	GET  /api/services/{name}
+//	GET  /api/middlewares
+//	GET  /api/config
+//	POST /api/services/{name}/drain    {"server": "http://10.0.0.1:80"}
+//	POST /api/services/{name}/undrain  {"server": "http://10.0.0.1:80"}
+//	POST /api/services/{name}/weight   {"server": "http://10.0.0.1:80", "weight": 2}
+//
+// The drain and weight changes are not written to the configuration file,
+// the next reload of the file discards them.
+type Handler struct {
+	manager Manager
+}
+
+// New creates the admin API handler.
+func New(manager Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// EntryPointInfo describes an entry point.
+type EntryPointInfo struct {
+	Name       config.ServerName `json:"name"`
+	Address    string            `json:"address,omitempty"`
+	TLSAddress string            `json:"tlsAddress,omitempty"`
+	Protocol   string            `json:"protocol,omitempty"`
+	Internal   bool              `json:"internal,omitempty"`
+}
+
+// ServiceInfo describes a service and the state of its servers.
+type ServiceInfo struct {
+	Name    string               `json:"name"`
+	Servers []router.ServerState `json:"servers"`
+}
+
+type serverRequest struct {
+	Server string `json:"server"`
+	Weight *int   `json:"weight,omitempty"`
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(req.URL.Path, Prefix), "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case req.Method == http.MethodGet && path == "entrypoints":
+		h.getEntryPoints(rw, req)
+	case req.Method == http.MethodGet && path == "routers":
+		writeJSON(rw, req, http.StatusOK, h.manager.Routing().Routers)
+	case req.Method == http.MethodGet && path == "services":
+		h.getServices(rw, req)
+	case req.Method == http.MethodGet && len(parts) == 2 && parts[0] == "services":
+		h.getService(rw, req, parts[1])
+	case req.Method == http.MethodGet && path == "middlewares":
+		writeJSON(rw, req, http.StatusOK, h.manager.Config().Middleware)
+	case req.Method == http.MethodGet && path == "config":
+		h.getConfig(rw, req)
+	case req.Method == http.MethodPost && len(parts) == 3 && parts[0] == "services":
+		h.updateServer(rw, req, parts[1], parts[2])
+	default:
+		writeError(rw, req, http.StatusNotFound, fmt.Errorf("%s %s not found", req.Method, req.URL.Path))
+	}
+}
+
+func (h *Handler) getEntryPoints(rw http.ResponseWriter, req *http.Request) {
+	cfg := h.manager.Config()
+	list := make([]EntryPointInfo, 0, len(cfg.Spec)+len(cfg.Internal))
+	for name, entryPoint := range cfg.Spec {
+		plain, secure := entryPoint.ListenAddresses()
+		list = append(list, EntryPointInfo{
+			Name:       name,
+			Address:    plain,
+			TLSAddress: secure,
+			Protocol:   entryPoint.Protocol,
+		})
+	}
+	for name, entryPoint := range cfg.Internal {
+		list = append(list, EntryPointInfo{Name: name, Address: entryPoint.GetAddress(), Internal: true})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(rw, req, http.StatusOK, list)
+}
+
+func (h *Handler) getServices(rw http.ResponseWriter, req *http.Request) {
+	services := h.manager.Routing().Services
+	list := make([]ServiceInfo, 0, len(services))
+	for name, balancer := range services {
+		list = append(list, ServiceInfo{Name: name, Servers: balancer.ServerStates()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(rw, req, http.StatusOK, list)
+}
+
+func (h *Handler) getService(rw http.ResponseWriter, req *http.Request, name string) {
+	balancer, ok := h.manager.Routing().Services[name]
+	if !ok {
+		writeError(rw, req, http.StatusNotFound, fmt.Errorf("service %s not found", name))
+		return
+	}
+	writeJSON(rw, req, http.StatusOK, ServiceInfo{Name: name, Servers: balancer.ServerStates()})
+}
+
+// getConfig writes the active configuration without its private keys and the tracing headers.
+func (h *Handler) getConfig(rw http.ResponseWriter, req *http.Request) {
+	cfg, err := h.manager.Config().DeepCopy()
+	if err != nil {
+		writeError(rw, req, http.StatusInternalServerError, err)
+		return
+	}
+	for _, transport := range cfg.GetServersTransports() {
+		if transport != nil {
+			redactKeys(transport.Certificates)
+		}
+	}
+	for _, entryPoints := range []config.EntryPointList{cfg.Spec, cfg.Internal} {
+		for _, entryPoint := range entryPoints {
+			if entryPoint == nil || entryPoint.TLS == nil {
+				continue
+			}
+			redactKeys(entryPoint.TLS.Certificates)
+			if entryPoint.TLS.DefaultCertificate != nil {
+				redactKey(entryPoint.TLS.DefaultCertificate)
+			}
+		}
+	}
+	if cfg.Tracing != nil {
+		for key := range cfg.Tracing.Headers {
+			cfg.Tracing.Headers[key] = redacted
+		}
+	}
+	writeJSON(rw, req, http.StatusOK, cfg)
+}
+
+// redactKeys hides the private keys of the certificates, a FileOrContent may hold the PEM itself.
+func redactKeys(certificates tls.Certificates) {
+	for i := range certificates {
+		redactKey(&certificates[i])
+	}
+}
+
+func redactKey(certificate *tls.Certificate) {
+	if certificate.KeyFile != "" {
+		certificate.KeyFile = tls.FileOrContent(redacted)
+	}
+}
+
+var (
+	errBadRequest = errors.New("bad request")
+	errNotFound   = errors.New("not found")
+)
+
+func (h *Handler) updateServer(rw http.ResponseWriter, req *http.Request, name, action string) {
+	var body serverRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(rw, req, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+		return
+	}
+	var update func(proxyHost *config.ProxyHost) error
+	switch action {
+	case "drain":
+		update = func(proxyHost *config.ProxyHost) error {
+			if !proxyHost.IsDrained(body.Server) {
+				proxyHost.Drain = append(proxyHost.Drain, body.Server)
+			}
+			return nil
+		}
+	case "undrain":
+		update = func(proxyHost *config.ProxyHost) error {
+			drain := proxyHost.Drain[:0]
+			for _, server := range proxyHost.Drain {
+				if server != body.Server {
+					drain = append(drain, server)
+				}
+			}
+			proxyHost.Drain = drain
+			return nil
+		}
+	case "weight":
+		update = func(proxyHost *config.ProxyHost) error {
+			if body.Weight == nil || *body.Weight < 0 {
+				return fmt.Errorf("%w: weight must be a non-negative integer", errBadRequest)
+			}
+			if proxyHost.Weight == nil {
+				proxyHost.Weight = make(map[string]int)
+			}
+			proxyHost.Weight[body.Server] = *body.Weight
+			return nil
+		}
+	default:
+		writeError(rw, req, http.StatusNotFound, fmt.Errorf("%s %s not found", req.Method, req.URL.Path))
+		return
+	}
+
+	err := h.manager.Update(func(cfg *config.Config) error {
+		for _, proxyHost := range cfg.List {
+			if proxyHost.GetName() != name {
+				continue
+			}
+			if !proxyHost.HasTarget(body.Server) {
+				return fmt.Errorf("%w: server %q of service %s", errNotFound, body.Server, name)
+			}
+			return update(proxyHost)
+		}
+		return fmt.Errorf("%w: service %s", errNotFound, name)
+	})
+	switch {
+	case err == nil:
+		logger.FromContext(req.Context()).Infof("api: %s %s of service %s", action, body.Server, name)
+		h.getService(rw, req, name)
+	case errors.Is(err, errNotFound):
+		writeError(rw, req, http.StatusNotFound, err)
+	case errors.Is(err, errBadRequest):
+		writeError(rw, req, http.StatusBadRequest, err)
+	default:
+		writeError(rw, req, http.StatusInternalServerError, err)
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, req *http.Request, statusCode int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(statusCode)
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		logger.FromContext(req.Context()).Errorf("api: unable to write response: %v", err)
+	}
+}
+
+func writeError(rw http.ResponseWriter, req *http.Request, statusCode int, err error) {
+	writeJSON(rw, req, statusCode, map[string]string{"message": err.Error()})
+}
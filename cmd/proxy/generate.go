@@ -6,12 +6,19 @@ package main
 
 import (
 	"context"
+	"crypto"
+	"fmt"
+	"io/ioutil"
 	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/crochee/proxy/config"
 	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/tls"
 	"github.com/crochee/proxy/tls/generate"
+	"github.com/crochee/proxy/tls/inspect"
 )
 
 var TlsFlags = []cli.Flag{
@@ -29,6 +36,49 @@ var TlsFlags = []cli.Flag{
 	},
 }
 
+// TlsSubcommands manage a local PKI: a root CA and the leaf certificates it signs.
+var TlsSubcommands = []*cli.Command{
+	{
+		Name:   "ca",
+		Usage:  "creates a root CA",
+		Action: createCA,
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "cn", Usage: "common name of the CA", Value: "Proxy Root CA"},
+			&cli.IntFlag{Name: "days", Usage: "validity in days", Value: 3650},
+			&cli.StringFlag{Name: "key-type", Usage: "rsa, ecdsa or ed25519", Value: generate.KeyECDSA},
+			&cli.StringFlag{Name: "cert", Aliases: []string{"c"}, Usage: "CA cert path", Value: "ca.pem"},
+			&cli.StringFlag{Name: "key", Aliases: []string{"k"}, Usage: "CA key path", Value: "ca-key.pem"},
+		},
+	},
+	{
+		Name:   "issue",
+		Usage:  "issues a leaf certificate signed by a CA",
+		Action: issueCertificate,
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "ca-cert", Usage: "CA cert path, followed by its chain", Value: "ca.pem"},
+			&cli.StringFlag{Name: "ca-key", Usage: "CA key path", Value: "ca-key.pem"},
+			&cli.StringFlag{Name: "cn", Usage: "common name, the first SAN by default"},
+			&cli.StringSliceFlag{Name: "san", Usage: "DNS name or IP address, repeatable"},
+			&cli.IntFlag{Name: "days", Usage: "validity in days", Value: 365},
+			&cli.StringFlag{Name: "key-type", Usage: "rsa, ecdsa or ed25519", Value: generate.KeyECDSA},
+			&cli.StringSliceFlag{Name: "usage", Usage: "server or client, repeatable", Value: cli.NewStringSlice(generate.UsageServer)},
+			&cli.StringFlag{Name: "cert", Aliases: []string{"c"}, Usage: "cert path", Value: "cert.pem"},
+			&cli.StringFlag{Name: "key", Aliases: []string{"k"}, Usage: "PKCS#8 key path", Value: "key.pem"},
+			&cli.StringFlag{Name: "chain", Usage: "full chain path: the cert, the CA and its chain"},
+		},
+	},
+	{
+		Name:      "inspect",
+		Usage:     "describes the certificates of PEM files, or of a configuration without argument",
+		ArgsUsage: "[file...]",
+		Action:    inspectCertificates,
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "config-path", Usage: "config path, inspected when no file is given", Value: "./conf/config.yml"},
+			&cli.IntFlag{Name: "days", Usage: "expiry threshold in days", Value: 30},
+		},
+	},
+}
+
 func certificate(c *cli.Context) error {
 	ctx := logger.With(context.Background(),
 		logger.Enable(c.Bool("enable-log")),
@@ -42,3 +92,104 @@ func certificate(c *cli.Context) error {
 	}
 	return nil
 }
+
+func createCA(c *cli.Context) error {
+	ca, err := generate.NewRootCA(c.String("cn"), days(c.Int("days")), c.String("key-type"))
+	if err != nil {
+		return err
+	}
+	if err = writeKeyPair(c.String("cert"), generate.EncodeCertificates(ca.Certificate.Raw),
+		c.String("key"), ca.Key); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "CA %q written to %s, valid until %s\n",
+		ca.Certificate.Subject.CommonName, c.String("cert"), ca.Certificate.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+func issueCertificate(c *cli.Context) error {
+	certPEM, err := ioutil.ReadFile(c.String("ca-cert"))
+	if err != nil {
+		return err
+	}
+	var keyPEM []byte
+	if keyPEM, err = ioutil.ReadFile(c.String("ca-key")); err != nil {
+		return err
+	}
+	var ca *generate.CA
+	if ca, err = generate.LoadCA(certPEM, keyPEM); err != nil {
+		return err
+	}
+	der, key, err := ca.Issue(generate.LeafRequest{
+		CommonName: c.String("cn"),
+		SANs:       c.StringSlice("san"),
+		Validity:   days(c.Int("days")),
+		KeyType:    c.String("key-type"),
+		Usages:     c.StringSlice("usage"),
+	})
+	if err != nil {
+		return err
+	}
+	if err = writeKeyPair(c.String("cert"), generate.EncodeCertificates(der), c.String("key"), key); err != nil {
+		return err
+	}
+	if chain := c.String("chain"); chain != "" {
+		if err = ioutil.WriteFile(chain, ca.FullChain(der), 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(c.App.Writer, "certificate signed by %q written to %s\n", ca.Certificate.Subject.CommonName, c.String("cert"))
+	return nil
+}
+
+// inspectCertificates prints the certificates and fails when one of them expires within the threshold
+// or has an invalid chain.
+func inspectCertificates(c *cli.Context) error {
+	var sources []inspect.Source
+	if c.Args().Present() {
+		for _, path := range c.Args().Slice() {
+			sources = append(sources, inspect.Source{Name: path, Content: tls.FileOrContent(path)})
+		}
+	} else {
+		cfg, err := config.LoadYaml(c.String("config-path"))
+		if err != nil {
+			return err
+		}
+		sources = inspect.Sources(cfg)
+	}
+	now := time.Now()
+	threshold := now.Add(days(c.Int("days")))
+	var failures int
+	for _, source := range sources {
+		infos, err := inspect.Inspect(source, now)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			fmt.Fprint(c.App.Writer, info.Format(now))
+			if threshold.After(info.Certificate.NotAfter) || info.ChainError != nil {
+				failures++
+			}
+		}
+	}
+	if failures != 0 {
+		return fmt.Errorf("%d certificates expire within %d days or have an invalid chain", failures, c.Int("days"))
+	}
+	return nil
+}
+
+// writeKeyPair writes the certificate and its PKCS#8 key, the key is only readable by its owner.
+func writeKeyPair(certPath string, certPEM []byte, keyPath string, key crypto.Signer) error {
+	keyPEM, err := generate.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certPath, certPEM, 0644)
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
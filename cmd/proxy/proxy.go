@@ -6,18 +6,26 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	nethttp "net/http"
 	"os"
 	"strings"
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/crochee/proxy/acme"
+	"github.com/crochee/proxy/api"
 	"github.com/crochee/proxy/cmd"
 	"github.com/crochee/proxy/config"
 	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/metrics"
+	"github.com/crochee/proxy/ping"
 	"github.com/crochee/proxy/safe"
 	"github.com/crochee/proxy/server"
 	"github.com/crochee/proxy/server/http"
+	"github.com/crochee/proxy/tls/inspect"
+	"github.com/crochee/proxy/tracing"
 )
 
 func main() {
@@ -36,11 +44,12 @@ func main() {
 			Flags:       BeforeFlags,
 		},
 		{
-			Name:    "tls",
-			Aliases: []string{"t"},
-			Usage:   "generates random TLS certificates",
-			Action:  certificate,
-			Flags:   append(BeforeFlags, TlsFlags...),
+			Name:        "tls",
+			Aliases:     []string{"t"},
+			Usage:       "generates random TLS certificates, or manages and inspects certificates with its subcommands",
+			Action:      certificate,
+			Subcommands: TlsSubcommands,
+			Flags:       append(BeforeFlags, TlsFlags...),
 		},
 	}
 
@@ -81,20 +90,77 @@ func run(c *cli.Context) error {
 		logger.LogPath(c.String("log-path")),
 	)
 	config.InitConfig(c.String("config-path"))
-	return setup(ctx, config.Cfg)
+	return setup(ctx, config.Cfg, c.String("config-path"))
 }
 
-func setup(ctx context.Context, cfg *config.Config) error {
+func setup(ctx context.Context, cfg *config.Config, configPath string) error {
 	ctx = server.ContextWithSignal(ctx)
 
 	// 开启一个协程池,确保自己开启的协程都关闭
 	routinesPool := safe.NewPool(ctx)
+	if cfg.Metrics != nil && cfg.Metrics.Prometheus != nil {
+		metrics.InitPrometheus(cfg.Metrics.Prometheus)
+	}
+	if cfg.Tracing != nil {
+		if err := tracing.Init(cfg.Tracing); err != nil {
+			logger.FromContext(ctx).Errorf("start failed.Error:%v", err)
+			return err
+		}
+		routinesPool.GoCtx(tracing.Run)
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.FromContext(ctx).Errorf("start failed.Error:%v", err)
+		return err
+	}
 	// http
 	httpServer, err := http.NewEntryPointList(cfg.Spec)
 	if err != nil {
 		logger.FromContext(ctx).Errorf("start failed.Error:%v", err)
 		return err
 	}
+	var internalServer http.EntryPointList
+	if internalServer, err = http.NewInternalEntryPointList(cfg.Internal); err != nil {
+		logger.FromContext(ctx).Errorf("start failed.Error:%v", err)
+		return err
+	}
+	if err = setupMetrics(cfg, internalServer); err != nil {
+		logger.FromContext(ctx).Errorf("start failed.Error:%v", err)
+		return err
+	}
+	for _, entryPoint := range httpServer {
+		if store := entryPoint.Certificates(); store != nil {
+			routinesPool.GoCtx(func(ctx context.Context) {
+				store.StapleOCSP(ctx, metrics.ObserveOCSP)
+			})
+		}
+	}
+	manager := server.NewRouterManager(ctx, httpServer)
+	if err = manager.Apply(cfg); err != nil {
+		logger.FromContext(ctx).Errorf("start failed.Error:%v", err)
+		return err
+	}
+	if err = setupACME(cfg, httpServer, manager, routinesPool); err != nil {
+		logger.FromContext(ctx).Errorf("start failed.Error:%v", err)
+		return err
+	}
+	routinesPool.GoCtx(inspect.NewMonitor(cfg.TLSMonitor, manager.Config).Run)
+	if err = setupAPI(cfg, internalServer, manager); err != nil {
+		logger.FromContext(ctx).Errorf("start failed.Error:%v", err)
+		return err
+	}
+	if err = setupPing(cfg, internalServer, httpServer.Ready); err != nil {
+		logger.FromContext(ctx).Errorf("start failed.Error:%v", err)
+		return err
+	}
+	manager.Watch(configPath)
+	for name, entryPoint := range internalServer {
+		if _, ok := httpServer[name]; ok {
+			err = fmt.Errorf("internal entryPoint %s conflicts with an entryPoint of the same name", name)
+			logger.FromContext(ctx).Errorf("start failed.Error:%v", err)
+			return err
+		}
+		httpServer[name] = entryPoint
+	}
 	// 开启server
 	srv := server.NewServer(ctx, routinesPool, httpServer)
 	srv.Start()
@@ -105,3 +171,80 @@ func setup(ctx context.Context, cfg *config.Config) error {
 
 	return nil
 }
+
+// setupMetrics exposes the prometheus metrics on their internal entry point.
+func setupMetrics(cfg *config.Config, internalList http.EntryPointList) error {
+	if cfg.Metrics == nil || cfg.Metrics.Prometheus == nil {
+		return nil
+	}
+	entryPoint, ok := internalList[cfg.Metrics.Prometheus.EntryPoint]
+	if !ok {
+		return fmt.Errorf("metrics: unknown internal entryPoint %q", cfg.Metrics.Prometheus.EntryPoint)
+	}
+	return entryPoint.Handle("/metrics", metrics.Handler())
+}
+
+// setupACME obtains the certificates of the router hosts and serves them on the TLS entry points,
+// the challenges are answered by the entry points of the ACME configuration.
+func setupACME(cfg *config.Config, entryPoints http.EntryPointList, manager *server.RouterManager,
+	pool *safe.Pool) error {
+	if cfg.ACME == nil {
+		return nil
+	}
+	provider, err := acme.NewProvider(cfg.ACME)
+	if err != nil {
+		return err
+	}
+	if challenge := cfg.ACME.HTTPChallenge; challenge != nil {
+		entryPoint, ok := entryPoints[challenge.EntryPoint]
+		if !ok {
+			return fmt.Errorf("acme: unknown httpChallenge entryPoint %q", challenge.EntryPoint)
+		}
+		entryPoint.WrapHandler(provider.HTTPChallengeHandler)
+	}
+	if challenge := cfg.ACME.TLSChallenge; challenge != nil {
+		entryPoint, ok := entryPoints[challenge.EntryPoint]
+		if !ok || entryPoint.TLSConfig() == nil {
+			return fmt.Errorf("acme: unknown tlsChallenge entryPoint %q", challenge.EntryPoint)
+		}
+		provider.TLSChallenge(entryPoint.TLSConfig())
+	}
+	for _, entryPoint := range entryPoints {
+		if store := entryPoint.Certificates(); store != nil {
+			provider.AddStore(store)
+		}
+	}
+	manager.AddListener(func(cfg *config.Config) {
+		provider.SetDomains(acme.Domains(cfg.List))
+	})
+	pool.GoCtx(provider.Run)
+	return nil
+}
+
+// setupAPI exposes the admin REST API on its internal entry point.
+func setupAPI(cfg *config.Config, internalList http.EntryPointList, manager api.Manager) error {
+	if cfg.API == nil {
+		return nil
+	}
+	entryPoint, ok := internalList[cfg.API.EntryPoint]
+	if !ok {
+		return fmt.Errorf("api: unknown internal entryPoint %q", cfg.API.EntryPoint)
+	}
+	return entryPoint.Handle(api.Prefix, api.New(manager))
+}
+
+// setupPing exposes the liveness and readiness endpoints on their internal entry point.
+func setupPing(cfg *config.Config, internalList http.EntryPointList, ready func() bool) error {
+	if cfg.Ping == nil {
+		return nil
+	}
+	entryPoint, ok := internalList[cfg.Ping.EntryPoint]
+	if !ok {
+		return fmt.Errorf("ping: unknown internal entryPoint %q", cfg.Ping.EntryPoint)
+	}
+	handler := ping.New(ready)
+	if err := entryPoint.Handle(ping.LivenessPath, nethttp.HandlerFunc(handler.Ping)); err != nil {
+		return err
+	}
+	return entryPoint.Handle(ping.ReadinessPath, nethttp.HandlerFunc(handler.Ready))
+}
@@ -0,0 +1,116 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/20
+
+package config
+
+import "time"
+
+const (
+	// CommonFormat is the common log format (CLF).
+	CommonFormat = "common"
+
+	// JSONFormat is the JSON logging format.
+	JSONFormat = "json"
+)
+
+const (
+	// FieldModeKeep keeps the field.
+	FieldModeKeep = "keep"
+	// FieldModeDrop drops the field.
+	FieldModeDrop = "drop"
+	// FieldModeRedact keeps the header name but replaces its value.
+	FieldModeRedact = "redact"
+)
+
+// AccessLog holds the configuration settings for the access logger of an entry point.
+type AccessLog struct {
+	FilePath      string            `json:"filePath,omitempty" yaml:"filePath,omitempty"`
+	Format        string            `json:"format,omitempty" yaml:"format,omitempty"`
+	BufferingSize int64             `json:"bufferingSize,omitempty" yaml:"bufferingSize,omitempty"`
+	Filters       *AccessLogFilters `json:"filters,omitempty" yaml:"filters,omitempty"`
+	Fields        *AccessLogFields  `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// SetDefaults sets the default values.
+func (l *AccessLog) SetDefaults() {
+	l.Format = CommonFormat
+	l.FilePath = ""
+	l.Filters = &AccessLogFilters{}
+	l.Fields = &AccessLogFields{}
+	l.Fields.SetDefaults()
+}
+
+// AccessLogFilters holds filters configuration,
+// an entry is kept when it matches at least one of the filters.
+type AccessLogFilters struct {
+	StatusCodes   []string      `json:"statusCodes,omitempty" yaml:"statusCodes,omitempty"`
+	RetryAttempts bool          `json:"retryAttempts,omitempty" yaml:"retryAttempts,omitempty"`
+	MinDuration   time.Duration `json:"minDuration,omitempty" yaml:"minDuration,omitempty"`
+}
+
+// AccessLogFields holds configuration for access log fields.
+// The common format has fixed columns, only the redact mode of its Referer and User-Agent headers applies.
+type AccessLogFields struct {
+	DefaultMode string            `json:"defaultMode,omitempty" yaml:"defaultMode,omitempty"`
+	Names       map[string]string `json:"names,omitempty" yaml:"names,omitempty"`
+	Headers     *FieldHeaders     `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+// SetDefaults sets the default values.
+func (f *AccessLogFields) SetDefaults() {
+	f.DefaultMode = FieldModeKeep
+	f.Headers = &FieldHeaders{
+		DefaultMode: FieldModeDrop,
+	}
+}
+
+// Keep check if the field need to be kept or dropped.
+func (f *AccessLogFields) Keep(field string) bool {
+	defaultKeep := true
+	if f != nil {
+		defaultKeep = checkFieldValue(f.DefaultMode, defaultKeep)
+
+		if v, ok := f.Names[field]; ok {
+			return checkFieldValue(v, defaultKeep)
+		}
+	}
+	return defaultKeep
+}
+
+// KeepHeader checks if the headers need to be kept, dropped or redacted and returns the status.
+func (f *AccessLogFields) KeepHeader(header string) string {
+	defaultValue := FieldModeDrop
+	if f != nil && f.Headers != nil {
+		defaultValue = checkFieldHeaderValue(f.Headers.DefaultMode, defaultValue)
+
+		if v, ok := f.Headers.Names[header]; ok {
+			return checkFieldHeaderValue(v, defaultValue)
+		}
+	}
+	return defaultValue
+}
+
+func checkFieldValue(value string, defaultKeep bool) bool {
+	switch value {
+	case FieldModeKeep:
+		return true
+	case FieldModeDrop:
+		return false
+	default:
+		return defaultKeep
+	}
+}
+
+func checkFieldHeaderValue(value, defaultValue string) string {
+	if value == FieldModeKeep || value == FieldModeDrop || value == FieldModeRedact {
+		return value
+	}
+	return defaultValue
+}
+
+// FieldHeaders holds configuration for access log headers.
+type FieldHeaders struct {
+	DefaultMode string            `json:"defaultMode,omitempty" yaml:"defaultMode,omitempty"`
+	Names       map[string]string `json:"names,omitempty" yaml:"names,omitempty"`
+}
@@ -0,0 +1,73 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/26
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/crochee/proxy/tls"
+)
+
+// ACME holds the configuration of the certificates obtained from an ACME CA for the hosts of the routers.
+type ACME struct {
+	Email string `json:"email,omitempty" yaml:"email,omitempty"`
+	// AcceptTOS accepts the terms of service of the CA, the account is not registered without it.
+	AcceptTOS bool `json:"acceptTOS,omitempty" yaml:"acceptTOS,omitempty"`
+	// CAServer is the directory URL of the CA, Let's Encrypt when empty.
+	CAServer string `json:"caServer,omitempty" yaml:"caServer,omitempty"`
+	// Storage is the JSON file holding the account and the certificates, "acme.json" when empty.
+	// The proxies sharing the file lock it while they update it or order a certificate.
+	Storage string `json:"storage,omitempty" yaml:"storage,omitempty"`
+	// KeyType is the type of the certificate keys: EC256, EC384, RSA2048 or RSA4096, EC256 when empty.
+	KeyType string `json:"keyType,omitempty" yaml:"keyType,omitempty"`
+	// CACertificates are trusted in addition to the system roots to reach CAServer, such as the root of a Pebble test server.
+	CACertificates []tls.FileOrContent `json:"caCertificates,omitempty" yaml:"caCertificates,omitempty"`
+	// RenewBefore is how long before their expiry the certificates are renewed, 30 days when empty.
+	RenewBefore time.Duration `json:"renewBefore,omitempty" yaml:"renewBefore,omitempty"`
+	// HTTPChallenge solves the HTTP-01 challenges on the plain address of its entry point.
+	HTTPChallenge *ACMEChallenge `json:"httpChallenge,omitempty" yaml:"httpChallenge,omitempty"`
+	// TLSChallenge solves the TLS-ALPN-01 challenges on the TLS address of its entry point.
+	TLSChallenge *ACMEChallenge `json:"tlsChallenge,omitempty" yaml:"tlsChallenge,omitempty"`
+}
+
+// ACMEChallenge names the entry point solving a challenge.
+type ACMEChallenge struct {
+	EntryPoint ServerName `json:"entryPoint,omitempty" yaml:"entryPoint,omitempty"`
+}
+
+// Validate checks that the terms of service are accepted
+// and that the challenges are solved by entry points serving the matching protocol.
+func (a *ACME) Validate(entryPoints EntryPointList) error {
+	if !a.AcceptTOS {
+		return errors.New("acme: the terms of service of the CA must be accepted with acceptTOS")
+	}
+	if a.HTTPChallenge == nil && a.TLSChallenge == nil {
+		return errors.New("acme: an httpChallenge or a tlsChallenge is required")
+	}
+	if a.RenewBefore < 0 {
+		return fmt.Errorf("acme: invalid renewBefore %s", a.RenewBefore)
+	}
+	if a.HTTPChallenge != nil {
+		entryPoint, ok := entryPoints[a.HTTPChallenge.EntryPoint]
+		if !ok {
+			return fmt.Errorf("acme: unknown httpChallenge entryPoint %q", a.HTTPChallenge.EntryPoint)
+		}
+		if plain, _ := entryPoint.ListenAddresses(); plain == "" {
+			return fmt.Errorf("acme: httpChallenge entryPoint %s serves no plain HTTP", a.HTTPChallenge.EntryPoint)
+		}
+	}
+	if a.TLSChallenge != nil {
+		entryPoint, ok := entryPoints[a.TLSChallenge.EntryPoint]
+		if !ok {
+			return fmt.Errorf("acme: unknown tlsChallenge entryPoint %q", a.TLSChallenge.EntryPoint)
+		}
+		if entryPoint.TLS == nil {
+			return fmt.Errorf("acme: tlsChallenge entryPoint %s serves no TLS", a.TLSChallenge.EntryPoint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/26
+
+package config
+
+import "testing"
+
+func TestACMEValidate(t *testing.T) {
+	entryPoints := EntryPointList{
+		"web":       {Port: 80},
+		"websecure": {Port: 443, TLS: &EntryPointTLS{}},
+	}
+	testCases := []struct {
+		name  string
+		acme  ACME
+		valid bool
+	}{
+		{name: "http challenge", acme: ACME{AcceptTOS: true, HTTPChallenge: &ACMEChallenge{EntryPoint: "web"}}, valid: true},
+		{name: "tls challenge", acme: ACME{AcceptTOS: true, TLSChallenge: &ACMEChallenge{EntryPoint: "websecure"}}, valid: true},
+		{name: "terms of service not accepted", acme: ACME{HTTPChallenge: &ACMEChallenge{EntryPoint: "web"}}},
+		{name: "no challenge", acme: ACME{AcceptTOS: true}},
+		{name: "http challenge without plain http", acme: ACME{AcceptTOS: true, HTTPChallenge: &ACMEChallenge{EntryPoint: "websecure"}}},
+		{name: "tls challenge without tls", acme: ACME{AcceptTOS: true, TLSChallenge: &ACMEChallenge{EntryPoint: "web"}}},
+		{name: "negative renewBefore", acme: ACME{AcceptTOS: true, HTTPChallenge: &ACMEChallenge{EntryPoint: "web"}, RenewBefore: -1}},
+	}
+	for _, tc := range testCases {
+		err := tc.acme.Validate(entryPoints)
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
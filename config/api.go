@@ -0,0 +1,11 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/23
+
+package config
+
+// API holds the configuration of the admin REST API,
+// the endpoints are served under /api/ of the internal entry point EntryPoint.
+type API struct {
+	EntryPoint ServerName `json:"entryPoint,omitempty" yaml:"entryPoint,omitempty"`
+}
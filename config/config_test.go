@@ -66,3 +66,17 @@ func TestLoadYaml(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestValidateCircuitBreakerExpression(t *testing.T) {
+	var cfg Config
+	if err := yaml.Unmarshal([]byte("middleware:\n  circuitBreaker:\n    expression: NetworkErrorRatio() > 0.5\n"), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("the circuit breaker expression is silently ignored")
+	}
+	cfg.Middleware.CircuitBreaker = &dynamic.CircuitBreaker{ErrorPercentThreshold: 50}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
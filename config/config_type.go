@@ -4,16 +4,200 @@
 
 package config
 
-import "github.com/crochee/proxy/config/dynamic"
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/crochee/proxy/config/dynamic"
+	"github.com/crochee/proxy/tls"
+)
 
 type Config struct {
-	List       []*ProxyHost        `yaml:"list,omitempty"`
-	Spec       EntryPointList      `yaml:"spec,omitempty"`
-	Transport  *ServersTransport   `yaml:"transport,omitempty"`
-	Middleware *dynamic.Middleware `yaml:"middleware,omitempty"`
+	List              []*ProxyHost                 `json:"list,omitempty" yaml:"list,omitempty"`
+	TCP               []*TCPRouter                 `json:"tcp,omitempty" yaml:"tcp,omitempty"`
+	UDP               []*UDPRouter                 `json:"udp,omitempty" yaml:"udp,omitempty"`
+	Spec              EntryPointList               `json:"spec,omitempty" yaml:"spec,omitempty"`
+	Transport         *ServersTransport            `json:"transport,omitempty" yaml:"transport,omitempty"`
+	ServersTransports map[string]*ServersTransport `json:"serversTransports,omitempty" yaml:"serversTransports,omitempty"`
+	Middleware        *dynamic.Middleware          `json:"middleware,omitempty" yaml:"middleware,omitempty"`
+	Internal          EntryPointList               `json:"internal,omitempty" yaml:"internal,omitempty"`
+	Metrics           *Metrics                     `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+	Tracing           *Tracing                     `json:"tracing,omitempty" yaml:"tracing,omitempty"`
+	API               *API                         `json:"api,omitempty" yaml:"api,omitempty"`
+	Ping              *Ping                        `json:"ping,omitempty" yaml:"ping,omitempty"`
+	TLSOptions        map[string]*tls.Options      `json:"tlsOptions,omitempty" yaml:"tlsOptions,omitempty"`
+	ACME              *ACME                        `json:"acme,omitempty" yaml:"acme,omitempty"`
+	TLSMonitor        *TLSMonitor                  `json:"tlsMonitor,omitempty" yaml:"tlsMonitor,omitempty"`
+}
+
+// Validate checks the configuration before the entry points are built.
+func (c *Config) Validate() error {
+	if err := CheckAddresses(c.Spec, c.Internal); err != nil {
+		return err
+	}
+	if c.ACME != nil {
+		if err := c.ACME.Validate(c.Spec); err != nil {
+			return err
+		}
+	}
+	if c.Middleware != nil && c.Middleware.CircuitBreaker != nil {
+		if err := c.Middleware.CircuitBreaker.Validate(); err != nil {
+			return fmt.Errorf("circuitBreaker: %w", err)
+		}
+	}
+	if m := c.TLSMonitor; m != nil && (m.ExpiryThreshold < 0 || m.Interval < 0) {
+		return fmt.Errorf("tlsMonitor: invalid expiryThreshold %s or interval %s", m.ExpiryThreshold, m.Interval)
+	}
+	if _, ok := c.ServersTransports[DefaultServersTransport]; ok && c.Transport != nil {
+		return fmt.Errorf("serversTransport %s conflicts with transport", DefaultServersTransport)
+	}
+	for name, transport := range c.ServersTransports {
+		if transport == nil {
+			return fmt.Errorf("serversTransport %s is empty", name)
+		}
+	}
+	transports := c.GetServersTransports()
+	for name, transport := range transports {
+		if err := transport.Validate(); err != nil {
+			return fmt.Errorf("serversTransport %s: %w", name, err)
+		}
+	}
+	for _, proxyHost := range c.List {
+		if name := proxyHost.ServersTransport; name != "" && transports[name] == nil {
+			return fmt.Errorf("proxy host %s: unknown serversTransport %s", proxyHost.GetName(), name)
+		}
+	}
+	tcpRouters := make(map[string]struct{}, len(c.TCP))
+	for _, tcpRouter := range c.TCP {
+		if tcpRouter.Name == "" {
+			return fmt.Errorf("tcp router with targets %v has no name", tcpRouter.Target)
+		}
+		if _, ok := tcpRouters[tcpRouter.Name]; ok {
+			return fmt.Errorf("duplicate tcp router %s", tcpRouter.Name)
+		}
+		tcpRouters[tcpRouter.Name] = struct{}{}
+		if err := tcpRouter.Validate(c.Spec); err != nil {
+			return fmt.Errorf("tcp router %s: %w", tcpRouter.Name, err)
+		}
+	}
+	udpRouters := make(map[string]struct{}, len(c.UDP))
+	for _, udpRouter := range c.UDP {
+		if udpRouter.Name == "" {
+			return fmt.Errorf("udp router with targets %v has no name", udpRouter.Target)
+		}
+		if _, ok := udpRouters[udpRouter.Name]; ok {
+			return fmt.Errorf("duplicate udp router %s", udpRouter.Name)
+		}
+		udpRouters[udpRouter.Name] = struct{}{}
+		if err := udpRouter.Validate(c.Spec); err != nil {
+			return fmt.Errorf("udp router %s: %w", udpRouter.Name, err)
+		}
+	}
+	for name, options := range c.TLSOptions {
+		if options == nil {
+			continue
+		}
+		if err := options.Validate(); err != nil {
+			return fmt.Errorf("TLS options %s: %w", name, err)
+		}
+	}
+	for name, entryPoint := range c.Spec {
+		if err := entryPoint.Validate(); err != nil {
+			return fmt.Errorf("entryPoint %s: %w", name, err)
+		}
+		if entryPoint.TLS == nil {
+			continue
+		}
+		if entryPoint.TLS.Options != "" {
+			if _, ok := c.TLSOptions[entryPoint.TLS.Options]; !ok {
+				return fmt.Errorf("entryPoint %s: unknown TLS options %s", name, entryPoint.TLS.Options)
+			}
+		}
+		if entryPoint.TLS.ClientAuth != nil {
+			if err := entryPoint.TLS.ClientAuth.Validate(); err != nil {
+				return fmt.Errorf("entryPoint %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetTLSOptions returns the TLS options of the entry point, nil when it uses the crypto/tls defaults.
+func (c *Config) GetTLSOptions(entryPoint *EntryPoint) *tls.Options {
+	if entryPoint.TLS == nil {
+		return nil
+	}
+	name := entryPoint.TLS.Options
+	if name == "" {
+		name = tls.DefaultOptionsName
+	}
+	return c.TLSOptions[name]
+}
+
+// GetServersTransports returns the servers transports referenced by the proxy hosts,
+// Transport is named DefaultServersTransport.
+func (c *Config) GetServersTransports() map[string]*ServersTransport {
+	transports := make(map[string]*ServersTransport, len(c.ServersTransports)+1)
+	for name, transport := range c.ServersTransports {
+		transports[name] = transport
+	}
+	if c.Transport != nil {
+		transports[DefaultServersTransport] = c.Transport
+	}
+	return transports
+}
+
+// DeepCopy returns a copy of the configuration sharing no memory with it.
+func (c *Config) DeepCopy() (*Config, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("copy config: %w", err)
+	}
+	var config Config
+	if err = yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("copy config: %w", err)
+	}
+	return &config, nil
 }
 
 type ProxyHost struct {
-	Origin []string `yaml:"origin,omitempty"`
-	Target []string `yaml:"target,omitempty"`
+	// Name identifies the router and the service of the proxy host, it defaults to the first origin.
+	Name   string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Origin []string `json:"origin,omitempty" yaml:"origin,omitempty"`
+	Target []string `json:"target,omitempty" yaml:"target,omitempty"`
+	// Weight holds the weight of the targets, a target has a weight of 1 by default.
+	Weight map[string]int `json:"weight,omitempty" yaml:"weight,omitempty"`
+	// Drain lists the targets which no longer receive requests.
+	Drain []string `json:"drain,omitempty" yaml:"drain,omitempty"`
+	// ServersTransport is the name of the transport to the targets, DefaultServersTransport when empty.
+	ServersTransport string `json:"serversTransport,omitempty" yaml:"serversTransport,omitempty"`
+}
+
+// GetName returns the name of the proxy host.
+func (p *ProxyHost) GetName() string {
+	if p.Name != "" || len(p.Origin) == 0 {
+		return p.Name
+	}
+	return p.Origin[0]
+}
+
+// HasTarget reports whether target is one of the targets of the proxy host.
+func (p *ProxyHost) HasTarget(target string) bool {
+	for _, t := range p.Target {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDrained reports whether target is drained.
+func (p *ProxyHost) IsDrained(target string) bool {
+	for _, t := range p.Drain {
+		if t == target {
+			return true
+		}
+	}
+	return false
 }
@@ -6,52 +6,100 @@
 // Package dynamic
 package dynamic
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 // Middleware holds the Middleware configuration.
 type Middleware struct {
-	AddPrefix        *AddPrefix        `yaml:"addPrefix,omitempty"`
-	ReplaceHost      *ReplaceHost      `yaml:"replaceHost,omitempty"`
-	ReplacePath      *ReplacePath      `yaml:"replacePath,omitempty"`
-	ReplacePathRegex *ReplacePathRegex `yaml:"replacePathRegex,omitempty"`
-	RateLimit        *RateLimit        `yaml:"rateLimit,omitempty"`
-	CircuitBreaker   *CircuitBreaker   `yaml:"circuitBreaker,omitempty"`
-	Retry            *Retry            `yaml:"retry,omitempty"`
+	AddPrefix        *AddPrefix        `json:"addPrefix,omitempty" yaml:"addPrefix,omitempty"`
+	ReplaceHost      *ReplaceHost      `json:"replaceHost,omitempty" yaml:"replaceHost,omitempty"`
+	ReplacePath      *ReplacePath      `json:"replacePath,omitempty" yaml:"replacePath,omitempty"`
+	ReplacePathRegex *ReplacePathRegex `json:"replacePathRegex,omitempty" yaml:"replacePathRegex,omitempty"`
+	RateLimit        *RateLimit        `json:"rateLimit,omitempty" yaml:"rateLimit,omitempty"`
+	CircuitBreaker   *CircuitBreaker   `json:"circuitBreaker,omitempty" yaml:"circuitBreaker,omitempty"`
+	Retry            *Retry            `json:"retry,omitempty" yaml:"retry,omitempty"`
+	Errors           *ErrorPage        `json:"errors,omitempty" yaml:"errors,omitempty"`
+	RequestID        *RequestID        `json:"requestId,omitempty" yaml:"requestId,omitempty"`
+	GRPCWeb          *GRPCWeb          `json:"grpcWeb,omitempty" yaml:"grpcWeb,omitempty"`
 }
 
 // AddPrefix holds the AddPrefix configuration.
 type AddPrefix struct {
-	Prefix string `yaml:"prefix,omitempty"`
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
 }
 
 type ReplaceHost struct {
-	Scheme string `yaml:"scheme,omitempty"`
-	Host   string `yaml:"host,omitempty"`
+	Scheme string `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+	Host   string `json:"host,omitempty" yaml:"host,omitempty"`
 }
 
 // ReplacePath holds the ReplacePath configuration.
 type ReplacePath struct {
-	Path string `yaml:"path,omitempty"`
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
 }
 
 // ReplacePathRegex holds the ReplacePathRegex configuration.
 type ReplacePathRegex struct {
-	Regex       string `yaml:"regex,omitempty"`
-	Replacement string `yaml:"replacement,omitempty"`
+	Regex       string `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Replacement string `json:"replacement,omitempty" yaml:"replacement,omitempty"`
 }
 
 type RateLimit struct {
-	Every time.Duration `yaml:"every,omitempty"`
-	Burst int           `yaml:"burst,omitempty"`
+	Every time.Duration `json:"every,omitempty" yaml:"every,omitempty"`
+	Burst int           `json:"burst,omitempty" yaml:"burst,omitempty"`
 }
 
-// CircuitBreaker holds the circuit breaker configuration.
+// CircuitBreaker holds the configuration of the hystrix circuit of a service, the circuit opens once
+// RequestVolumeThreshold requests were seen and ErrorPercentThreshold percent of them failed with a 5xx,
+// and lets a request through again after SleepWindow. The zero values take the hystrix defaults.
 type CircuitBreaker struct {
-	Expression string `yaml:"expression,omitempty"`
+	// Expression is no longer supported, it is only kept to reject the configurations still setting it.
+	Expression             string        `json:"expression,omitempty" yaml:"expression,omitempty"`
+	RequestVolumeThreshold int           `json:"requestVolumeThreshold,omitempty" yaml:"requestVolumeThreshold,omitempty"`
+	ErrorPercentThreshold  int           `json:"errorPercentThreshold,omitempty" yaml:"errorPercentThreshold,omitempty"`
+	SleepWindow            time.Duration `json:"sleepWindow,omitempty" yaml:"sleepWindow,omitempty"`
+}
+
+// Validate rejects the expression of the previous circuit breaker configuration.
+func (c *CircuitBreaker) Validate() error {
+	if c.Expression != "" {
+		return errors.New("expression is no longer supported, " +
+			"use requestVolumeThreshold, errorPercentThreshold and sleepWindow")
+	}
+	return nil
 }
 
 // Retry holds the retry configuration.
 type Retry struct {
-	Attempts        int           `yaml:"attempts,omitempty"`
-	InitialInterval time.Duration `yaml:"initialInterval,omitempty"`
+	Attempts        int           `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	InitialInterval time.Duration `json:"initialInterval,omitempty" yaml:"initialInterval,omitempty"`
+}
+
+// ErrorPage holds the custom error page configuration.
+// The page is fetched from Service (an url such as http://127.0.0.1:8150), or read
+// from the templates of Directory when Service is not set or fails to answer a 2xx page,
+// Query may contain the {status} and {url} placeholders.
+type ErrorPage struct {
+	Status    []string `json:"status,omitempty" yaml:"status,omitempty"`
+	Service   string   `json:"service,omitempty" yaml:"service,omitempty"`
+	Directory string   `json:"directory,omitempty" yaml:"directory,omitempty"`
+	Query     string   `json:"query,omitempty" yaml:"query,omitempty"`
+}
+
+// RequestID holds the request id configuration.
+// An inbound id is reused only if Insecure is set or the client is one of TrustedIPs,
+// Generator is either uuid (default) or ulid.
+type RequestID struct {
+	Header     string   `json:"header,omitempty" yaml:"header,omitempty"`
+	Generator  string   `json:"generator,omitempty" yaml:"generator,omitempty"`
+	Insecure   bool     `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	TrustedIPs []string `json:"trustedIPs,omitempty" yaml:"trustedIPs,omitempty"`
+}
+
+// GRPCWeb holds the gRPC-Web configuration.
+// AllowOrigins are the origins of the CORS requests, "*" allows them all.
+type GRPCWeb struct {
+	AllowOrigins []string `json:"allowOrigins,omitempty" yaml:"allowOrigins,omitempty"`
 }
@@ -6,8 +6,13 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/crochee/proxy/tls"
 )
 
 const (
@@ -23,10 +28,211 @@ type EntryPointList map[ServerName]*EntryPoint
 
 // EntryPoint holds the entry point configuration.
 type EntryPoint struct {
-	Port             int                   `yaml:"port,omitempty"`
-	Protocol         string                `yaml:"protocol,omitempty"`
-	Transport        *EntryPointsTransport `yaml:"transport,omitempty"`
-	ForwardedHeaders *ForwardedHeaders     `yaml:"forwardedHeaders,omitempty"`
+	// Address is the host:port, [ipv6]:port or unix:/path.sock the entry point listens on, it overrides Port.
+	Address          string                `json:"address,omitempty" yaml:"address,omitempty"`
+	Port             int                   `json:"port,omitempty" yaml:"port,omitempty"`
+	Protocol         string                `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Transport        *EntryPointsTransport `json:"transport,omitempty" yaml:"transport,omitempty"`
+	ForwardedHeaders *ForwardedHeaders     `json:"forwardedHeaders,omitempty" yaml:"forwardedHeaders,omitempty"`
+	AccessLog        *AccessLog            `json:"accessLog,omitempty" yaml:"accessLog,omitempty"`
+	TLS              *EntryPointTLS        `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// H2C serves HTTP/2 without TLS on the plain address, with prior knowledge or by upgrade.
+	H2C bool `json:"h2c,omitempty" yaml:"h2c,omitempty"`
+	// HTTP3 serves HTTP/3 on the UDP port of the TLS address.
+	HTTP3 *HTTP3 `json:"http3,omitempty" yaml:"http3,omitempty"`
+	// ProxyProtocol reads the PROXY protocol header of the TCP connections.
+	ProxyProtocol *ProxyProtocol `json:"proxyProtocol,omitempty" yaml:"proxyProtocol,omitempty"`
+}
+
+// HTTP3 serves HTTP/3 over QUIC next to the TLS listener of an entry point,
+// the TLS responses advertise it with an Alt-Svc header.
+// An entry point of the udp protocol with TLS serves only HTTP/3.
+type HTTP3 struct {
+	// AdvertisedPort is the port announced in the Alt-Svc header, the UDP port when empty.
+	AdvertisedPort int `json:"advertisedPort,omitempty" yaml:"advertisedPort,omitempty"`
+}
+
+// EntryPointTLS makes an entry point serve TLS.
+// Without Address the entry point serves only TLS on its own address,
+// with it the entry point serves plain HTTP on its own address and TLS on this one.
+type EntryPointTLS struct {
+	Address      string           `json:"address,omitempty" yaml:"address,omitempty"`
+	Certificates tls.Certificates `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+	// DefaultCertificate is served when no certificate matches the SNI, a self-signed one is generated when empty.
+	DefaultCertificate *tls.Certificate `json:"defaultCertificate,omitempty" yaml:"defaultCertificate,omitempty"`
+	// Options is the name of the TLS options of Config.TLSOptions, "default" when empty.
+	Options string `json:"options,omitempty" yaml:"options,omitempty"`
+	// ClientAuth authenticates the clients by their certificate.
+	ClientAuth *tls.ClientAuth `json:"clientAuth,omitempty" yaml:"clientAuth,omitempty"`
+}
+
+// GetAddress returns the address of the entry point, ":Port" when no address is given.
+func (ep *EntryPoint) GetAddress() string {
+	if ep.Address != "" {
+		return ep.Address
+	}
+	return ":" + strconv.Itoa(ep.Port)
+}
+
+// ListenAddresses returns the plain and the TLS addresses of the entry point, empty when it is not served.
+// An entry point of the udp protocol has none, it listens only on UDP.
+func (ep *EntryPoint) ListenAddresses() (plain, secure string) {
+	if ep.IsUDP() {
+		return "", ""
+	}
+	if ep.TLS == nil {
+		return ep.GetAddress(), ""
+	}
+	if ep.TLS.Address == "" {
+		return "", ep.GetAddress()
+	}
+	return ep.GetAddress(), ep.TLS.Address
+}
+
+// HTTP3Address returns the UDP address serving HTTP/3, empty when the entry point does not serve it.
+func (ep *EntryPoint) HTTP3Address() string {
+	if ep.TLS == nil {
+		return ""
+	}
+	if ep.IsUDP() {
+		if ep.TLS.Address != "" {
+			return ep.TLS.Address
+		}
+		return ep.GetAddress()
+	}
+	if ep.HTTP3 == nil {
+		return ""
+	}
+	_, secure := ep.ListenAddresses()
+	return secure
+}
+
+// UDPAddress returns the address of the UDP listener of the entry point, empty when it has none.
+// An entry point of the udp protocol without TLS forwards the datagrams to its UDP router.
+func (ep *EntryPoint) UDPAddress() string {
+	if ep.IsUDP() && ep.TLS == nil {
+		return ep.GetAddress()
+	}
+	return ep.HTTP3Address()
+}
+
+// IsUDP reports whether the entry point is of the udp protocol.
+func (ep *EntryPoint) IsUDP() bool {
+	return strings.EqualFold(ep.Protocol, "udp")
+}
+
+// Validate checks the protocols served by the entry point.
+func (ep *EntryPoint) Validate() error {
+	if ep.HTTP3 != nil && ep.TLS == nil {
+		return fmt.Errorf("http3 requires tls")
+	}
+	if ep.H2C {
+		if plain, _ := ep.ListenAddresses(); plain == "" {
+			return fmt.Errorf("h2c requires a plain address")
+		}
+	}
+	if address := ep.UDPAddress(); address != "" {
+		if network, _, err := ParseAddress(address); err == nil && network != "tcp" {
+			return fmt.Errorf("udp cannot listen on %s", address)
+		}
+	}
+	if ep.ForwardedHeaders != nil {
+		if err := ep.ForwardedHeaders.Validate(); err != nil {
+			return err
+		}
+	}
+	if ep.ProxyProtocol != nil {
+		if plain, secure := ep.ListenAddresses(); plain == "" && secure == "" {
+			return fmt.Errorf("proxyProtocol requires a tcp listener")
+		}
+		return ep.ProxyProtocol.Validate()
+	}
+	return nil
+}
+
+// unixPrefix is the prefix of the unix socket addresses.
+const unixPrefix = "unix:"
+
+// ParseAddress returns the network and the address to listen on.
+func ParseAddress(address string) (network, addr string, err error) {
+	if strings.HasPrefix(address, unixPrefix) {
+		path := strings.TrimPrefix(address, unixPrefix)
+		if path == "" {
+			return "", "", fmt.Errorf("invalid address %s: empty socket path", address)
+		}
+		return "unix", path, nil
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid address %s: %w", address, err)
+	}
+	if p, convErr := strconv.Atoi(port); convErr != nil || p <= 0 || p > 65535 {
+		return "", "", fmt.Errorf("invalid address %s: bad port %s", address, port)
+	}
+	return "tcp", address, nil
+}
+
+// CheckAddresses validates the addresses of the entry points
+// and returns an error when two of them listen on the same socket or port.
+func CheckAddresses(lists ...EntryPointList) error {
+	type listener struct {
+		owner   string
+		network string
+		host    string
+		port    string
+	}
+	var listeners []listener
+	var names []string
+	entryPoints := make(map[string]*EntryPoint)
+	for _, list := range lists {
+		for name, entryPoint := range list {
+			if _, ok := entryPoints[string(name)]; ok {
+				return fmt.Errorf("entryPoint %s is declared twice", name)
+			}
+			entryPoints[string(name)] = entryPoint
+			names = append(names, string(name))
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		plain, secure := entryPoints[name].ListenAddresses()
+		udp := entryPoints[name].UDPAddress()
+		for i, address := range []string{plain, secure, udp} {
+			if address == "" {
+				continue
+			}
+			network, addr, err := ParseAddress(address)
+			if err != nil {
+				return fmt.Errorf("entryPoint %s: %w", name, err)
+			}
+			if i == 2 && network == "tcp" {
+				// the UDP ports do not collide with the TCP ones.
+				network = "udp"
+			}
+			current := listener{owner: name, network: network, host: addr}
+			if network == "tcp" || network == "udp" {
+				current.host, current.port, _ = net.SplitHostPort(addr)
+			}
+			for _, other := range listeners {
+				if other.network != current.network || other.port != current.port {
+					continue
+				}
+				if other.host == current.host || isWildcard(other.host) || isWildcard(current.host) {
+					return fmt.Errorf("entryPoint %s address %s collides with entryPoint %s", name, address, other.owner)
+				}
+			}
+			listeners = append(listeners, current)
+		}
+	}
+	return nil
+}
+
+func isWildcard(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
 }
 
 // GetProtocol returns the protocol part of the address field of the entry point.
@@ -47,8 +253,8 @@ func (ep *EntryPoint) SetDefaults() {
 
 // EntryPointsTransport configures communication between clients and Traefik.
 type EntryPointsTransport struct {
-	LifeCycle          *LifeCycle          `yaml:"lifeCycle,omitempty"`
-	RespondingTimeouts *RespondingTimeouts `yaml:"respondingTimeouts,omitempty"`
+	LifeCycle          *LifeCycle          `json:"lifeCycle,omitempty" yaml:"lifeCycle,omitempty"`
+	RespondingTimeouts *RespondingTimeouts `json:"respondingTimeouts,omitempty" yaml:"respondingTimeouts,omitempty"`
 }
 
 // SetDefaults sets the default values.
@@ -61,14 +267,69 @@ func (t *EntryPointsTransport) SetDefaults() {
 
 // ForwardedHeaders Trust client forwarding headers.
 type ForwardedHeaders struct {
-	Insecure   bool     `yaml:"insecure,omitempty"`
-	TrustedIPs []string `yaml:"trustedIPs,omitempty"`
+	Insecure   bool     `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	TrustedIPs []string `json:"trustedIPs,omitempty" yaml:"trustedIPs,omitempty"`
+	// TLSClientCert forwards the verified client certificate to the backends.
+	TLSClientCert *TLSClientCert `json:"tlsClientCert,omitempty" yaml:"tlsClientCert,omitempty"`
+	// Emit is the family of headers sent to the backends: x-forwarded, forwarded or both, x-forwarded when empty.
+	// The trusted headers of either family are read.
+	Emit string `json:"emit,omitempty" yaml:"emit,omitempty"`
+}
+
+// Families of the forwarded headers sent to the backends.
+const (
+	// ForwardedHeadersXForwarded sends the X-Forwarded-For, -Proto, -Host, -Port and -Server headers.
+	ForwardedHeadersXForwarded = "x-forwarded"
+	// ForwardedHeadersForwarded sends the Forwarded header of RFC 7239.
+	ForwardedHeadersForwarded = "forwarded"
+	// ForwardedHeadersBoth sends both families.
+	ForwardedHeadersBoth = "both"
+)
+
+// Validate checks the family of the forwarded headers.
+func (h *ForwardedHeaders) Validate() error {
+	switch h.Emit {
+	case "", ForwardedHeadersXForwarded, ForwardedHeadersForwarded, ForwardedHeadersBoth:
+		return nil
+	default:
+		return fmt.Errorf("unknown forwardedHeaders emit %s, valid values are: %s, %s, %s",
+			h.Emit, ForwardedHeadersXForwarded, ForwardedHeadersForwarded, ForwardedHeadersBoth)
+	}
+}
+
+// TLSClientCert selects what is forwarded of the verified client certificate,
+// the PEM in X-Forwarded-Tls-Client-Cert and the selected fields in X-Forwarded-Tls-Client-Cert-Info.
+type TLSClientCert struct {
+	PEM  bool               `json:"pem,omitempty" yaml:"pem,omitempty"`
+	Info *TLSClientCertInfo `json:"info,omitempty" yaml:"info,omitempty"`
+}
+
+// TLSClientCertInfo holds the fields of the client certificate forwarded in X-Forwarded-Tls-Client-Cert-Info.
+type TLSClientCertInfo struct {
+	NotAfter     bool                            `json:"notAfter,omitempty" yaml:"notAfter,omitempty"`
+	NotBefore    bool                            `json:"notBefore,omitempty" yaml:"notBefore,omitempty"`
+	Sans         bool                            `json:"sans,omitempty" yaml:"sans,omitempty"`
+	SerialNumber bool                            `json:"serialNumber,omitempty" yaml:"serialNumber,omitempty"`
+	Subject      *TLSClientCertDistinguishedName `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Issuer       *TLSClientCertDistinguishedName `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+}
+
+// TLSClientCertDistinguishedName holds the fields of a distinguished name forwarded in X-Forwarded-Tls-Client-Cert-Info.
+type TLSClientCertDistinguishedName struct {
+	Country            bool `json:"country,omitempty" yaml:"country,omitempty"`
+	Province           bool `json:"province,omitempty" yaml:"province,omitempty"`
+	Locality           bool `json:"locality,omitempty" yaml:"locality,omitempty"`
+	Organization       bool `json:"organization,omitempty" yaml:"organization,omitempty"`
+	OrganizationalUnit bool `json:"organizationalUnit,omitempty" yaml:"organizationalUnit,omitempty"`
+	CommonName         bool `json:"commonName,omitempty" yaml:"commonName,omitempty"`
+	SerialNumber       bool `json:"serialNumber,omitempty" yaml:"serialNumber,omitempty"`
+	DomainComponent    bool `json:"domainComponent,omitempty" yaml:"domainComponent,omitempty"`
 }
 
 // LifeCycle contains configurations relevant to the lifecycle (such as the shutdown phase) of Traefik.
 type LifeCycle struct {
-	RequestAcceptGraceTimeout time.Duration `yaml:"requestAcceptGraceTimeout,omitempty"`
-	GraceTimeOut              time.Duration `yaml:"graceTimeOut,omitempty"`
+	RequestAcceptGraceTimeout time.Duration `json:"requestAcceptGraceTimeout,omitempty" yaml:"requestAcceptGraceTimeout,omitempty"`
+	GraceTimeOut              time.Duration `json:"graceTimeOut,omitempty" yaml:"graceTimeOut,omitempty"`
 }
 
 // SetDefaults sets the default values.
@@ -78,9 +339,9 @@ func (a *LifeCycle) SetDefaults() {
 
 // RespondingTimeouts contains timeout configurations for incoming requests to the Traefik instance.
 type RespondingTimeouts struct {
-	ReadTimeout  time.Duration `yaml:"readTimeout,omitempty"`
-	WriteTimeout time.Duration `yaml:"writeTimeout,omitempty"`
-	IdleTimeout  time.Duration `yaml:"idleTimeout,omitempty"`
+	ReadTimeout  time.Duration `json:"readTimeout,omitempty" yaml:"readTimeout,omitempty"`
+	WriteTimeout time.Duration `json:"writeTimeout,omitempty" yaml:"writeTimeout,omitempty"`
+	IdleTimeout  time.Duration `json:"idleTimeout,omitempty" yaml:"idleTimeout,omitempty"`
 }
 
 // SetDefaults sets the default values.
@@ -0,0 +1,123 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/24
+
+package config
+
+import "testing"
+
+func TestCheckAddresses(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     EntryPointList
+		internal EntryPointList
+		valid    bool
+	}{
+		{
+			name: "distinct ports",
+			spec: EntryPointList{
+				"web":       {Port: 80},
+				"websecure": {Address: "[::1]:443", TLS: &EntryPointTLS{}},
+			},
+			internal: EntryPointList{"admin": {Address: "127.0.0.1:8080"}},
+			valid:    true,
+		},
+		{
+			name: "same port on distinct hosts",
+			spec: EntryPointList{
+				"a": {Address: "127.0.0.1:80"},
+				"b": {Address: "127.0.0.2:80"},
+			},
+			valid: true,
+		},
+		{
+			name: "unix sockets",
+			spec: EntryPointList{
+				"a": {Address: "unix:/tmp/a.sock"},
+				"b": {Address: "unix:/tmp/b.sock"},
+			},
+			valid: true,
+		},
+		{
+			name:     "port collides with wildcard",
+			spec:     EntryPointList{"web": {Port: 8080}},
+			internal: EntryPointList{"admin": {Address: "127.0.0.1:8080"}},
+		},
+		{
+			name: "tls address collides",
+			spec: EntryPointList{
+				"web":       {Address: ":80", TLS: &EntryPointTLS{Address: ":443"}},
+				"websecure": {Address: "0.0.0.0:443"},
+			},
+		},
+		{
+			name: "http3 on the tls port",
+			spec: EntryPointList{
+				"web":    {Address: ":80", TLS: &EntryPointTLS{Address: ":443"}, HTTP3: &HTTP3{}},
+				"quic":   {Address: ":8443", Protocol: "udp", TLS: &EntryPointTLS{}},
+				"secure": {Address: ":8443", TLS: &EntryPointTLS{}},
+			},
+			valid: true,
+		},
+		{
+			name: "http3 ports collide",
+			spec: EntryPointList{
+				"web":  {Address: ":80", TLS: &EntryPointTLS{Address: ":443"}, HTTP3: &HTTP3{}},
+				"quic": {Address: "127.0.0.1:443", Protocol: "udp", TLS: &EntryPointTLS{}},
+			},
+		},
+		{
+			name: "same socket",
+			spec: EntryPointList{
+				"a": {Address: "unix:/tmp/a.sock"},
+				"b": {Address: "unix:/tmp/a.sock"},
+			},
+		},
+		{
+			name: "invalid port",
+			spec: EntryPointList{"web": {Address: "localhost:http"}},
+		},
+		{
+			name:     "duplicate name",
+			spec:     EntryPointList{"web": {Port: 80}},
+			internal: EntryPointList{"web": {Port: 8080}},
+		},
+	}
+	for _, tc := range testCases {
+		err := CheckAddresses(tc.spec, tc.internal)
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestEntryPointValidate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		entryPoint EntryPoint
+		valid      bool
+	}{
+		{name: "h2c", entryPoint: EntryPoint{Port: 80, H2C: true}, valid: true},
+		{name: "h2c without plain address", entryPoint: EntryPoint{Port: 443, H2C: true, TLS: &EntryPointTLS{}}},
+		{name: "http3", entryPoint: EntryPoint{Port: 443, TLS: &EntryPointTLS{}, HTTP3: &HTTP3{}}, valid: true},
+		{name: "http3 without tls", entryPoint: EntryPoint{Port: 80, HTTP3: &HTTP3{}}},
+		{name: "http3 on unix socket", entryPoint: EntryPoint{Address: "unix:/tmp/a.sock", TLS: &EntryPointTLS{}, HTTP3: &HTTP3{}}},
+		{name: "proxy protocol", entryPoint: EntryPoint{Port: 80, ProxyProtocol: &ProxyProtocol{TrustedIPs: []string{"10.0.0.0/8"}}}, valid: true},
+		{name: "proxy protocol without trusted ips", entryPoint: EntryPoint{Port: 80, ProxyProtocol: &ProxyProtocol{}}},
+		{name: "forwarded", entryPoint: EntryPoint{Port: 80, ForwardedHeaders: &ForwardedHeaders{Emit: "forwarded"}}, valid: true},
+		{name: "unknown forwarded headers", entryPoint: EntryPoint{Port: 80, ForwardedHeaders: &ForwardedHeaders{Emit: "x-real-ip"}}},
+		{name: "proxy protocol on udp", entryPoint: EntryPoint{Port: 53, Protocol: "udp", ProxyProtocol: &ProxyProtocol{Insecure: true}}},
+	}
+	for _, tc := range testCases {
+		err := tc.entryPoint.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
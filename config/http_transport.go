@@ -5,6 +5,7 @@
 package config
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/crochee/proxy/tls"
@@ -12,19 +13,54 @@ import (
 
 type ServerName string
 
+// DefaultServersTransport is the name of Config.Transport, used by the proxy hosts without servers transport.
+const DefaultServersTransport = "default"
+
 // ServersTransport options to configure communication between Traefik and the servers.
 type ServersTransport struct {
-	ServerName         ServerName          `yaml:"serverName,omitempty"`
-	InsecureSkipVerify bool                `yaml:"insecureSkipVerify,omitempty"`
-	RootCAs            []tls.FileOrContent `yaml:"rootCAs,omitempty"`
-	Certificates       tls.Certificates    `yaml:"certificates,omitempty"`
-	MaxIdleConnPerHost int                 `yaml:"maxIdleConnPerHost,omitempty"`
-	ForwardingTimeouts *ForwardingTimeouts `yaml:"forwardingTimeouts,omitempty"`
+	ServerName         ServerName          `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+	InsecureSkipVerify bool                `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+	RootCAs            []tls.FileOrContent `json:"rootCAs,omitempty" yaml:"rootCAs,omitempty"`
+	Certificates       tls.Certificates    `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+	MaxIdleConnPerHost int                 `json:"maxIdleConnPerHost,omitempty" yaml:"maxIdleConnPerHost,omitempty"`
+	ForwardingTimeouts *ForwardingTimeouts `json:"forwardingTimeouts,omitempty" yaml:"forwardingTimeouts,omitempty"`
+	// Protocol is the HTTP protocol spoken to the servers: http1, http2 or h2c, http2 when empty.
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	// ProxyProtocol sends a PROXY protocol header on the connections to the servers,
+	// which then carry the requests of a single client over HTTP/1.1.
+	ProxyProtocol *ProxyProtocolHeader `json:"proxyProtocol,omitempty" yaml:"proxyProtocol,omitempty"`
+}
+
+// Protocols of the servers transports, the connection upgrades such as WebSocket always use HTTP/1.1.
+const (
+	// ProtocolHTTP1 only speaks HTTP/1.1.
+	ProtocolHTTP1 = "http1"
+	// ProtocolHTTP2 speaks HTTP/2 to the TLS servers negotiating it, HTTP/1.1 otherwise.
+	ProtocolHTTP2 = "http2"
+	// ProtocolH2C also speaks HTTP/2 with prior knowledge to the cleartext servers, such as the gRPC ones.
+	ProtocolH2C = "h2c"
+)
+
+// Validate checks the protocol of the transport.
+func (t *ServersTransport) Validate() error {
+	switch t.Protocol {
+	case "", ProtocolHTTP1, ProtocolHTTP2, ProtocolH2C:
+	default:
+		return fmt.Errorf("unknown protocol %s, valid protocols are: %s, %s, %s",
+			t.Protocol, ProtocolHTTP1, ProtocolHTTP2, ProtocolH2C)
+	}
+	if t.ProxyProtocol == nil {
+		return nil
+	}
+	if t.Protocol != "" && t.Protocol != ProtocolHTTP1 {
+		return fmt.Errorf("proxyProtocol requires the %s protocol", ProtocolHTTP1)
+	}
+	return t.ProxyProtocol.Validate()
 }
 
 // ForwardingTimeouts contains timeout configurations for forwarding requests to the backend servers.
 type ForwardingTimeouts struct {
-	DialTimeout           time.Duration `yaml:"dialTimeout,omitempty"`
-	ResponseHeaderTimeout time.Duration `yaml:"responseHeaderTimeout,omitempty"`
-	IdleConnTimeout       time.Duration `yaml:"idleConnTimeout,omitempty"`
+	DialTimeout           time.Duration `json:"dialTimeout,omitempty" yaml:"dialTimeout,omitempty"`
+	ResponseHeaderTimeout time.Duration `json:"responseHeaderTimeout,omitempty" yaml:"responseHeaderTimeout,omitempty"`
+	IdleConnTimeout       time.Duration `json:"idleConnTimeout,omitempty" yaml:"idleConnTimeout,omitempty"`
 }
@@ -0,0 +1,17 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/21
+
+package config
+
+// Metrics provides options to expose and send proxy metrics to different third party monitoring systems.
+type Metrics struct {
+	Prometheus *Prometheus `json:"prometheus,omitempty" yaml:"prometheus,omitempty"`
+}
+
+// Prometheus can contain specific configuration used by the Prometheus Metrics exporter,
+// the metrics are served on /metrics of the internal entry point EntryPoint.
+type Prometheus struct {
+	Buckets    []float64  `json:"buckets,omitempty" yaml:"buckets,omitempty"`
+	EntryPoint ServerName `json:"entryPoint,omitempty" yaml:"entryPoint,omitempty"`
+}
@@ -0,0 +1,11 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/24
+
+package config
+
+// Ping holds the configuration of the health endpoints of the proxy,
+// /ping and /ready are served on the internal entry point EntryPoint.
+type Ping struct {
+	EntryPoint ServerName `json:"entryPoint,omitempty" yaml:"entryPoint,omitempty"`
+}
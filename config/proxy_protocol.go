@@ -0,0 +1,55 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/3
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/crochee/proxy/util/ip"
+)
+
+// DefaultProxyProtocolVersion is the version of the PROXY protocol headers sent to the servers by default.
+const DefaultProxyProtocolVersion = 2
+
+// ProxyProtocol reads the PROXY protocol header, v1 or v2, of the connections of an entry point,
+// so that the clients behind an L4 load balancer are seen with their own addresses.
+// The connections of the untrusted sources and those without header are served as is.
+type ProxyProtocol struct {
+	Insecure   bool     `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	TrustedIPs []string `json:"trustedIPs,omitempty" yaml:"trustedIPs,omitempty"`
+}
+
+// Validate checks the trusted sources of the headers.
+func (p *ProxyProtocol) Validate() error {
+	if p.Insecure {
+		return nil
+	}
+	if _, err := ip.NewChecker(p.TrustedIPs); err != nil {
+		return fmt.Errorf("proxyProtocol: %w", err)
+	}
+	return nil
+}
+
+// ProxyProtocolHeader sends a PROXY protocol header with the client addresses on the connections to the servers.
+type ProxyProtocolHeader struct {
+	// Version is 1 or 2, DefaultProxyProtocolVersion when empty.
+	Version int `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// GetVersion returns the version of the headers.
+func (p *ProxyProtocolHeader) GetVersion() int {
+	if p.Version == 0 {
+		return DefaultProxyProtocolVersion
+	}
+	return p.Version
+}
+
+// Validate checks the version of the headers.
+func (p *ProxyProtocolHeader) Validate() error {
+	if v := p.GetVersion(); v != 1 && v != 2 {
+		return fmt.Errorf("unknown proxyProtocol version %d", v)
+	}
+	return nil
+}
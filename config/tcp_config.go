@@ -0,0 +1,113 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/1
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// HostSNICatchAll is the HostSNI of the TCP routers matching every connection.
+const HostSNICatchAll = "*"
+
+// TCPRouter forwards the TCP connections of its entry points to its targets.
+// A TLS connection is matched on the server name of its ClientHello, the connections matching no TCP router
+// are served by the HTTP routers of the entry point.
+type TCPRouter struct {
+	Name        string       `json:"name,omitempty" yaml:"name,omitempty"`
+	EntryPoints []ServerName `json:"entryPoints,omitempty" yaml:"entryPoints,omitempty"`
+	// HostSNI holds the server names matched, HostSNICatchAll matches the TLS connections matching no other router
+	// and, without TLS, every connection matching no other router.
+	HostSNI []string `json:"hostSNI,omitempty" yaml:"hostSNI,omitempty"`
+	// TLS makes the router match only TLS connections, terminated with the certificates of the entry point
+	// unless they are passed through.
+	TLS *TCPRouterTLS `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// Target holds the host:port of the servers.
+	Target []string `json:"target,omitempty" yaml:"target,omitempty"`
+	// Weight holds the weight of the targets, a target has a weight of 1 by default.
+	Weight map[string]int `json:"weight,omitempty" yaml:"weight,omitempty"`
+	// Drain lists the targets which no longer receive connections.
+	Drain []string `json:"drain,omitempty" yaml:"drain,omitempty"`
+	// IdleTimeout closes the connections without traffic in either direction, DefaultIdleTimeout when empty.
+	IdleTimeout time.Duration `json:"idleTimeout,omitempty" yaml:"idleTimeout,omitempty"`
+	// ProxyProtocol sends a PROXY protocol header with the client addresses on the connections to the targets.
+	ProxyProtocol *ProxyProtocolHeader `json:"proxyProtocol,omitempty" yaml:"proxyProtocol,omitempty"`
+}
+
+// TCPRouterTLS configures the TLS connections of a TCP router.
+type TCPRouterTLS struct {
+	// Passthrough forwards the TLS connections as is, the servers terminate them.
+	Passthrough bool `json:"passthrough,omitempty" yaml:"passthrough,omitempty"`
+}
+
+// Terminates reports whether the router terminates the TLS connections.
+func (r *TCPRouter) Terminates() bool {
+	return r.TLS != nil && !r.TLS.Passthrough
+}
+
+// IsDrained reports whether target no longer receives connections.
+func (r *TCPRouter) IsDrained(target string) bool {
+	for _, t := range r.Drain {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// GetIdleTimeout returns the idle timeout of the connections of the router.
+func (r *TCPRouter) GetIdleTimeout() time.Duration {
+	if r.IdleTimeout == 0 {
+		return DefaultIdleTimeout
+	}
+	return r.IdleTimeout
+}
+
+// Validate checks the TCP router against the entry points it is attached to.
+func (r *TCPRouter) Validate(entryPoints EntryPointList) error {
+	if len(r.EntryPoints) == 0 {
+		return fmt.Errorf("no entryPoints")
+	}
+	for _, name := range r.EntryPoints {
+		entryPoint, ok := entryPoints[name]
+		if !ok {
+			return fmt.Errorf("unknown entryPoint %s", name)
+		}
+		if plain, secure := entryPoint.ListenAddresses(); plain == "" && secure == "" {
+			return fmt.Errorf("entryPoint %s does not listen on TCP", name)
+		}
+		if r.Terminates() && entryPoint.TLS == nil {
+			return fmt.Errorf("entryPoint %s has no certificates to terminate TLS", name)
+		}
+	}
+	if len(r.HostSNI) == 0 {
+		return fmt.Errorf("no hostSNI")
+	}
+	for _, serverName := range r.HostSNI {
+		if serverName == "" || strings.ContainsAny(serverName, ": ") {
+			return fmt.Errorf("invalid hostSNI %q", serverName)
+		}
+		if serverName != HostSNICatchAll && r.TLS == nil {
+			return fmt.Errorf("hostSNI %s requires tls", serverName)
+		}
+	}
+	if len(r.Target) == 0 {
+		return fmt.Errorf("no target")
+	}
+	for _, target := range r.Target {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return fmt.Errorf("invalid target %s: %w", target, err)
+		}
+	}
+	if r.IdleTimeout < 0 {
+		return fmt.Errorf("invalid idleTimeout %s", r.IdleTimeout)
+	}
+	if r.ProxyProtocol != nil {
+		return r.ProxyProtocol.Validate()
+	}
+	return nil
+}
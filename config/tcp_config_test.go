@@ -0,0 +1,79 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/1
+
+package config
+
+import "testing"
+
+func TestTCPRouterValidate(t *testing.T) {
+	entryPoints := EntryPointList{
+		"web":       {Port: 80},
+		"websecure": {Port: 443, TLS: &EntryPointTLS{}},
+		"quic":      {Port: 443, Protocol: "udp", TLS: &EntryPointTLS{}},
+	}
+	testCases := []struct {
+		name   string
+		router TCPRouter
+		valid  bool
+	}{
+		{
+			name:   "catch-all",
+			router: TCPRouter{EntryPoints: []ServerName{"web"}, HostSNI: []string{"*"}, Target: []string{"10.0.0.1:5432"}},
+			valid:  true,
+		},
+		{
+			name: "passthrough",
+			router: TCPRouter{EntryPoints: []ServerName{"web"}, HostSNI: []string{"db.example.com"},
+				TLS: &TCPRouterTLS{Passthrough: true}, Target: []string{"10.0.0.1:5432"}},
+			valid: true,
+		},
+		{
+			name: "termination",
+			router: TCPRouter{EntryPoints: []ServerName{"websecure"}, HostSNI: []string{"db.example.com"},
+				TLS: &TCPRouterTLS{}, Target: []string{"10.0.0.1:5432"}},
+			valid: true,
+		},
+		{
+			name: "termination without certificates",
+			router: TCPRouter{EntryPoints: []ServerName{"web"}, HostSNI: []string{"db.example.com"},
+				TLS: &TCPRouterTLS{}, Target: []string{"10.0.0.1:5432"}},
+		},
+		{
+			name:   "server name without tls",
+			router: TCPRouter{EntryPoints: []ServerName{"web"}, HostSNI: []string{"db.example.com"}, Target: []string{"10.0.0.1:5432"}},
+		},
+		{
+			name:   "udp entry point",
+			router: TCPRouter{EntryPoints: []ServerName{"quic"}, HostSNI: []string{"*"}, Target: []string{"10.0.0.1:5432"}},
+		},
+		{
+			name:   "unknown entry point",
+			router: TCPRouter{EntryPoints: []ServerName{"db"}, HostSNI: []string{"*"}, Target: []string{"10.0.0.1:5432"}},
+		},
+		{
+			name: "proxy protocol",
+			router: TCPRouter{EntryPoints: []ServerName{"web"}, HostSNI: []string{"*"}, Target: []string{"10.0.0.1:5432"},
+				ProxyProtocol: &ProxyProtocolHeader{Version: 1}},
+			valid: true,
+		},
+		{
+			name: "unknown proxy protocol version",
+			router: TCPRouter{EntryPoints: []ServerName{"web"}, HostSNI: []string{"*"}, Target: []string{"10.0.0.1:5432"},
+				ProxyProtocol: &ProxyProtocolHeader{Version: 3}},
+		},
+		{
+			name:   "target without port",
+			router: TCPRouter{EntryPoints: []ServerName{"web"}, HostSNI: []string{"*"}, Target: []string{"10.0.0.1"}},
+		},
+	}
+	for _, tc := range testCases {
+		err := tc.router.Validate(entryPoints)
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
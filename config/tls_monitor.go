@@ -0,0 +1,15 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/28
+
+package config
+
+import "time"
+
+// TLSMonitor configures the periodic inspection of the configured certificates.
+type TLSMonitor struct {
+	// ExpiryThreshold is how long before its expiry a certificate is reported, 30 days when empty.
+	ExpiryThreshold time.Duration `json:"expiryThreshold,omitempty" yaml:"expiryThreshold,omitempty"`
+	// Interval is the period of the inspections, 12 hours when empty.
+	Interval time.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+}
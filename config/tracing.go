@@ -0,0 +1,17 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/22
+
+package config
+
+import "time"
+
+// Tracing holds the tracing configuration, spans are exported with OTLP/HTTP (JSON encoding).
+type Tracing struct {
+	ServiceName   string            `json:"serviceName,omitempty" yaml:"serviceName,omitempty"`
+	Endpoint      string            `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	SamplingRatio *float64          `json:"samplingRatio,omitempty" yaml:"samplingRatio,omitempty"`
+	BatchSize     int               `json:"batchSize,omitempty" yaml:"batchSize,omitempty"`
+	FlushInterval time.Duration     `json:"flushInterval,omitempty" yaml:"flushInterval,omitempty"`
+}
@@ -0,0 +1,93 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/2
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultUDPTimeout closes the UDP sessions without datagram in either direction.
+const DefaultUDPTimeout = 3 * time.Second
+
+// DefaultUDPMaxSessions bounds the UDP sessions of an entry point, each of them holds a socket.
+const DefaultUDPMaxSessions = 10000
+
+// UDPRouter forwards the datagrams of its entry points to its targets,
+// the datagrams of a client go to the same target until its session times out.
+type UDPRouter struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// EntryPoints holds the entry points of the udp protocol without TLS, each of them has a single UDP router.
+	EntryPoints []ServerName `json:"entryPoints,omitempty" yaml:"entryPoints,omitempty"`
+	// Target holds the host:port of the servers.
+	Target []string `json:"target,omitempty" yaml:"target,omitempty"`
+	// Weight holds the weight of the targets, a target has a weight of 1 by default.
+	Weight map[string]int `json:"weight,omitempty" yaml:"weight,omitempty"`
+	// Drain lists the targets which no longer receive new sessions.
+	Drain []string `json:"drain,omitempty" yaml:"drain,omitempty"`
+	// Timeout closes the sessions without datagram in either direction, DefaultUDPTimeout when empty.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// MaxSessions bounds the sessions of each entry point, DefaultUDPMaxSessions when empty.
+	// The datagrams of new clients are dropped while it is reached.
+	MaxSessions int `json:"maxSessions,omitempty" yaml:"maxSessions,omitempty"`
+}
+
+// IsDrained reports whether target no longer receives new sessions.
+func (r *UDPRouter) IsDrained(target string) bool {
+	for _, t := range r.Drain {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTimeout returns the timeout of the sessions of the router.
+func (r *UDPRouter) GetTimeout() time.Duration {
+	if r.Timeout == 0 {
+		return DefaultUDPTimeout
+	}
+	return r.Timeout
+}
+
+// GetMaxSessions returns the maximum number of sessions of each entry point of the router.
+func (r *UDPRouter) GetMaxSessions() int {
+	if r.MaxSessions == 0 {
+		return DefaultUDPMaxSessions
+	}
+	return r.MaxSessions
+}
+
+// Validate checks the UDP router against the entry points it is attached to.
+func (r *UDPRouter) Validate(entryPoints EntryPointList) error {
+	if len(r.EntryPoints) == 0 {
+		return fmt.Errorf("no entryPoints")
+	}
+	for _, name := range r.EntryPoints {
+		entryPoint, ok := entryPoints[name]
+		if !ok {
+			return fmt.Errorf("unknown entryPoint %s", name)
+		}
+		if !entryPoint.IsUDP() || entryPoint.TLS != nil {
+			return fmt.Errorf("entryPoint %s does not forward datagrams, it must be of the udp protocol without tls", name)
+		}
+	}
+	if len(r.Target) == 0 {
+		return fmt.Errorf("no target")
+	}
+	for _, target := range r.Target {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return fmt.Errorf("invalid target %s: %w", target, err)
+		}
+	}
+	if r.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s", r.Timeout)
+	}
+	if r.MaxSessions < 0 {
+		return fmt.Errorf("invalid maxSessions %d", r.MaxSessions)
+	}
+	return nil
+}
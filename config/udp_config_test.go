@@ -0,0 +1,39 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/2
+
+package config
+
+import "testing"
+
+func TestUDPRouterValidate(t *testing.T) {
+	entryPoints := EntryPointList{
+		"web":  {Port: 53},
+		"dns":  {Port: 53, Protocol: "udp"},
+		"quic": {Port: 443, Protocol: "udp", TLS: &EntryPointTLS{}},
+	}
+	testCases := []struct {
+		name   string
+		router UDPRouter
+		valid  bool
+	}{
+		{name: "udp entry point", router: UDPRouter{EntryPoints: []ServerName{"dns"}, Target: []string{"10.0.0.1:53"}}, valid: true},
+		{name: "tcp entry point", router: UDPRouter{EntryPoints: []ServerName{"web"}, Target: []string{"10.0.0.1:53"}}},
+		{name: "http3 entry point", router: UDPRouter{EntryPoints: []ServerName{"quic"}, Target: []string{"10.0.0.1:53"}}},
+		{name: "no target", router: UDPRouter{EntryPoints: []ServerName{"dns"}}},
+		{name: "target without port", router: UDPRouter{EntryPoints: []ServerName{"dns"}, Target: []string{"10.0.0.1"}}},
+		{name: "negative max sessions", router: UDPRouter{EntryPoints: []ServerName{"dns"}, Target: []string{"10.0.0.1:53"}, MaxSessions: -1}},
+	}
+	for _, tc := range testCases {
+		err := tc.router.Validate(entryPoints)
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+	if err := CheckAddresses(entryPoints); err != nil {
+		t.Errorf("the udp and tcp ports collide: %v", err)
+	}
+}
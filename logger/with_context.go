@@ -83,3 +83,22 @@ func FromContext(ctx context.Context) *Logger {
 	}
 	return logger
 }
+
+// NewContext returns a new context carrying the given logger.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// WithFields returns a child logger which adds the fields to every log line.
+func (l *Logger) WithFields(fields ...zap.Field) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := l.logger.With(fields...)
+	return &Logger{
+		level:       l.level,
+		path:        l.path,
+		logger:      child,
+		loggerSugar: child.Sugar(),
+	}
+}
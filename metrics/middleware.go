@@ -0,0 +1,164 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/21
+
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/crochee/proxy/middlewares"
+	"github.com/crochee/proxy/middlewares/retry"
+)
+
+const (
+	protocolHTTP      = "http"
+	protocolSSE       = "sse"
+	protocolWebsocket = "websocket"
+)
+
+// metricsMiddleware records the requests count and duration.
+type metricsMiddleware struct {
+	next         http.Handler
+	labels       []string
+	reqs         *prometheus.CounterVec
+	reqDurations *prometheus.HistogramVec
+}
+
+// NewEntryPointMiddleware creates a new metrics middleware for an entrypoint.
+func NewEntryPointMiddleware(next http.Handler, entryPoint string) http.Handler {
+	if promState == nil {
+		return next
+	}
+	return &metricsMiddleware{
+		next:         next,
+		labels:       []string{entryPointLabel, entryPoint},
+		reqs:         promState.entryPointReqs,
+		reqDurations: promState.entryPointReqDurations,
+	}
+}
+
+// NewRouterMiddleware creates a new metrics middleware for a router.
+func NewRouterMiddleware(next http.Handler, router, service string) http.Handler {
+	if promState == nil {
+		return next
+	}
+	return &metricsMiddleware{
+		next:         next,
+		labels:       []string{routerLabel, router, serviceLabel, service},
+		reqs:         promState.routerReqs,
+		reqDurations: promState.routerReqDurations,
+	}
+}
+
+// NewServiceMiddleware creates a new metrics middleware for a service.
+func NewServiceMiddleware(next http.Handler, service string) http.Handler {
+	if promState == nil {
+		return next
+	}
+	return &metricsMiddleware{
+		next:         next,
+		labels:       []string{serviceLabel, service},
+		reqs:         promState.serviceReqs,
+		reqDurations: promState.serviceReqDurations,
+	}
+}
+
+func (m *metricsMiddleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	recorder := middlewares.NewResponseWriter(rw)
+	m.next.ServeHTTP(recorder, req)
+
+	labels := prometheus.Labels{
+		codeLabel:     strconv.Itoa(recorder.Status()),
+		methodLabel:   getMethod(req),
+		protocolLabel: getRequestProtocol(req),
+	}
+	for i := 0; i < len(m.labels); i += 2 {
+		labels[m.labels[i]] = m.labels[i+1]
+	}
+	m.reqs.With(labels).Inc()
+	m.reqDurations.With(labels).Observe(time.Since(start).Seconds())
+}
+
+func getRequestProtocol(req *http.Request) string {
+	switch {
+	case isWebsocketRequest(req):
+		return protocolWebsocket
+	case isSSERequest(req):
+		return protocolSSE
+	default:
+		return protocolHTTP
+	}
+}
+
+// isWebsocketRequest determines if the specified HTTP request is a websocket handshake request.
+func isWebsocketRequest(req *http.Request) bool {
+	return containsHeader(req, "Connection", "upgrade") && containsHeader(req, "Upgrade", "websocket")
+}
+
+// isSSERequest determines if the specified HTTP request is a request for an event subscription.
+func isSSERequest(req *http.Request) bool {
+	return containsHeader(req, "Accept", "text/event-stream")
+}
+
+func containsHeader(req *http.Request, name, value string) bool {
+	items := strings.Split(req.Header.Get(name), ",")
+	for _, item := range items {
+		if value == strings.ToLower(strings.TrimSpace(item)) {
+			return true
+		}
+	}
+	return false
+}
+
+// getMethod keeps the cardinality of the method label under control.
+func getMethod(req *http.Request) string {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return req.Method
+	default:
+		return "EXTENSION_METHOD"
+	}
+}
+
+// ConnState returns a http.Server ConnState hook counting the open connections of an entrypoint.
+func ConnState(entryPoint string) func(net.Conn, http.ConnState) {
+	if promState == nil {
+		return nil
+	}
+	gauge := promState.entryPointOpenConns.WithLabelValues(entryPoint)
+	return func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			gauge.Inc()
+		case http.StateHijacked, http.StateClosed:
+			gauge.Dec()
+		}
+	}
+}
+
+// retryListener counts the retries of a service.
+type retryListener struct {
+	counter prometheus.Counter
+}
+
+// NewRetryListener instantiates a retry.Listener counting the retries of the service.
+func NewRetryListener(service string) retry.Listener {
+	if promState == nil {
+		return retry.Listeners{}
+	}
+	return &retryListener{counter: promState.serviceRetries.WithLabelValues(service)}
+}
+
+// Retried implements retry.Listener.
+func (r *retryListener) Retried(_ *http.Request, _ int) {
+	r.counter.Inc()
+}
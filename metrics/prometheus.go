@@ -0,0 +1,314 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/21
+
+package metrics
+
+import (
+	"crypto/x509"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/crochee/proxy/config"
+)
+
+const (
+	// MetricNamePrefix prefix of all metric names.
+	MetricNamePrefix = "proxy_"
+
+	entryPointLabel = "entrypoint"
+	routerLabel     = "router"
+	serviceLabel    = "service"
+	codeLabel       = "code"
+	methodLabel     = "method"
+	protocolLabel   = "protocol"
+	urlLabel        = "url"
+	reasonLabel     = "reason"
+	nameLabel       = "name"
+	statusLabel     = "status"
+)
+
+// prometheusState holds the collectors, it is nil as long as prometheus is not enabled.
+type prometheusState struct {
+	registry *prometheus.Registry
+
+	entryPointReqs         *prometheus.CounterVec
+	entryPointReqDurations *prometheus.HistogramVec
+	entryPointOpenConns    *prometheus.GaugeVec
+
+	routerReqs         *prometheus.CounterVec
+	routerReqDurations *prometheus.HistogramVec
+
+	serviceReqs          *prometheus.CounterVec
+	serviceReqDurations  *prometheus.HistogramVec
+	serviceRetries       *prometheus.CounterVec
+	serviceServerEnabled *prometheus.GaugeVec
+
+	rateLimitRejected *prometheus.CounterVec
+	tlsCertsNotAfter  *prometheus.GaugeVec
+	tlsOCSPRequests   *prometheus.CounterVec
+	tlsOCSPNextUpdate *prometheus.GaugeVec
+	tlsCertsExpiring  *prometheus.GaugeVec
+	tlsCertsChain     *prometheus.GaugeVec
+	circuitBreakers   *circuitBreakerCollector
+}
+
+var (
+	promState *prometheusState
+	promOnce  sync.Once
+)
+
+// InitPrometheus creates and registers the prometheus collectors, it only has effect once.
+func InitPrometheus(cfg *config.Prometheus) {
+	promOnce.Do(func() {
+		buckets := prometheus.DefBuckets
+		if len(cfg.Buckets) > 0 {
+			buckets = cfg.Buckets
+		}
+		promState = newPrometheusState(buckets)
+	})
+}
+
+func newPrometheusState(buckets []float64) *prometheusState {
+	state := &prometheusState{
+		registry: prometheus.NewRegistry(),
+		entryPointReqs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MetricNamePrefix + "entrypoint_requests_total",
+			Help: "How many HTTP requests processed on an entrypoint, partitioned by status code, protocol, and method.",
+		}, []string{entryPointLabel, codeLabel, methodLabel, protocolLabel}),
+		entryPointReqDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    MetricNamePrefix + "entrypoint_request_duration_seconds",
+			Help:    "How long it took to process the request on an entrypoint, partitioned by status code, protocol, and method.",
+			Buckets: buckets,
+		}, []string{entryPointLabel, codeLabel, methodLabel, protocolLabel}),
+		entryPointOpenConns: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: MetricNamePrefix + "entrypoint_open_connections",
+			Help: "How many open connections exist on an entrypoint.",
+		}, []string{entryPointLabel}),
+		routerReqs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MetricNamePrefix + "router_requests_total",
+			Help: "How many HTTP requests are processed on a router, partitioned by service, status code, protocol, and method.",
+		}, []string{routerLabel, serviceLabel, codeLabel, methodLabel, protocolLabel}),
+		routerReqDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    MetricNamePrefix + "router_request_duration_seconds",
+			Help:    "How long it took to process the request on a router, partitioned by service, status code, protocol, and method.",
+			Buckets: buckets,
+		}, []string{routerLabel, serviceLabel, codeLabel, methodLabel, protocolLabel}),
+		serviceReqs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MetricNamePrefix + "service_requests_total",
+			Help: "How many HTTP requests processed on a service, partitioned by status code, protocol, and method.",
+		}, []string{serviceLabel, codeLabel, methodLabel, protocolLabel}),
+		serviceReqDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    MetricNamePrefix + "service_request_duration_seconds",
+			Help:    "How long it took to process the request on a service, partitioned by status code, protocol, and method.",
+			Buckets: buckets,
+		}, []string{serviceLabel, codeLabel, methodLabel, protocolLabel}),
+		serviceRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MetricNamePrefix + "service_retries_total",
+			Help: "How many request retries happened on a service.",
+		}, []string{serviceLabel}),
+		serviceServerEnabled: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: MetricNamePrefix + "service_server_enabled",
+			Help: "service server is enabled, neither drained nor weighted 0 by the configuration or the admin API, described by gauge value of 0 or 1.",
+		}, []string{serviceLabel, urlLabel}),
+		rateLimitRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MetricNamePrefix + "ratelimit_rejected_total",
+			Help: "How many requests were rejected by a rate limiter, partitioned by router, service and reason.",
+		}, []string{routerLabel, serviceLabel, reasonLabel}),
+		tlsCertsNotAfter: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: MetricNamePrefix + "tls_certs_not_after",
+			Help: "Certificate expiration timestamp",
+		}, []string{"cn", "serial", "sans"}),
+		tlsOCSPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MetricNamePrefix + "tls_ocsp_requests_total",
+			Help: "How many OCSP requests were made for the served certificates, partitioned by status.",
+		}, []string{"cn", "serial", statusLabel}),
+		tlsOCSPNextUpdate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: MetricNamePrefix + "tls_ocsp_next_update",
+			Help: "NextUpdate timestamp of the last OCSP response, 0 when the last request failed.",
+		}, []string{"cn", "serial"}),
+		tlsCertsExpiring: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: MetricNamePrefix + "tls_certs_expiring",
+			Help: "1 when the configured certificate expires within the threshold of the TLS monitor, 0 otherwise.",
+		}, []string{"cn", "serial", "source"}),
+		tlsCertsChain: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: MetricNamePrefix + "tls_certs_chain_valid",
+			Help: "1 when the chain of the configured certificate verifies, 0 otherwise.",
+		}, []string{"cn", "serial", "source"}),
+		circuitBreakers: newCircuitBreakerCollector(),
+	}
+	state.registry.MustRegister(
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		prometheus.NewGoCollector(),
+		state.entryPointReqs,
+		state.entryPointReqDurations,
+		state.entryPointOpenConns,
+		state.routerReqs,
+		state.routerReqDurations,
+		state.serviceReqs,
+		state.serviceReqDurations,
+		state.serviceRetries,
+		state.serviceServerEnabled,
+		state.rateLimitRejected,
+		state.tlsCertsNotAfter,
+		state.tlsOCSPRequests,
+		state.tlsOCSPNextUpdate,
+		state.tlsCertsExpiring,
+		state.tlsCertsChain,
+		state.circuitBreakers,
+	)
+	return state
+}
+
+// Enabled reports whether prometheus metrics are collected.
+func Enabled() bool {
+	return promState != nil
+}
+
+// Handler returns the http.Handler exposing the metrics in the prometheus text format.
+func Handler() http.Handler {
+	if promState == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(promState.registry, promhttp.HandlerOpts{})
+}
+
+// SetServerEnabled records whether the server url of a service is enabled, an admin state
+// set by the drain and the weight of the server, not the health of the server.
+func SetServerEnabled(service, url string, enabled bool) {
+	if promState == nil {
+		return
+	}
+	var value float64
+	if enabled {
+		value = 1
+	}
+	promState.serviceServerEnabled.WithLabelValues(service, url).Set(value)
+}
+
+// RateLimitRejected counts a request rejected by a rate limiter before it reached router and service,
+// both are empty when the request matches no router.
+func RateLimitRejected(router, service, reason string) {
+	if promState == nil {
+		return
+	}
+	promState.rateLimitRejected.WithLabelValues(router, service, reason).Inc()
+}
+
+// SetCertificateExpiry records the expiration date of a served certificate.
+func SetCertificateExpiry(cert *x509.Certificate) {
+	if promState == nil || cert == nil {
+		return
+	}
+	promState.tlsCertsNotAfter.WithLabelValues(certificateLabels(cert)...).Set(float64(cert.NotAfter.Unix()))
+}
+
+// DeleteCertificate removes the expiration date and the OCSP state of a certificate no longer served,
+// such as the previous certificate of a reloaded or renewed one.
+func DeleteCertificate(cert *x509.Certificate) {
+	if promState == nil || cert == nil {
+		return
+	}
+	promState.tlsCertsNotAfter.DeleteLabelValues(certificateLabels(cert)...)
+	promState.tlsOCSPNextUpdate.DeleteLabelValues(cert.Subject.CommonName, cert.SerialNumber.String())
+}
+
+// certificateLabels returns the cn, serial and sans labels of cert.
+func certificateLabels(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses))
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sort.Strings(sans)
+	return []string{cert.Subject.CommonName, cert.SerialNumber.String(), strings.Join(sans, ",")}
+}
+
+// ObserveOCSP records an OCSP request for a served certificate, nextUpdate is zero when the request failed.
+func ObserveOCSP(cert *x509.Certificate, status string, nextUpdate time.Time) {
+	if promState == nil || cert == nil {
+		return
+	}
+	serial := cert.SerialNumber.String()
+	promState.tlsOCSPRequests.WithLabelValues(cert.Subject.CommonName, serial, status).Inc()
+	var value float64
+	if !nextUpdate.IsZero() {
+		value = float64(nextUpdate.Unix())
+	}
+	promState.tlsOCSPNextUpdate.WithLabelValues(cert.Subject.CommonName, serial).Set(value)
+}
+
+// ObserveCertificateCheck records an inspection of a configured certificate by the TLS monitor.
+func ObserveCertificateCheck(cert *x509.Certificate, source string, expiring, chainValid bool) {
+	if promState == nil || cert == nil {
+		return
+	}
+	serial := cert.SerialNumber.String()
+	promState.tlsCertsExpiring.WithLabelValues(cert.Subject.CommonName, serial, source).Set(boolValue(expiring))
+	promState.tlsCertsChain.WithLabelValues(cert.Subject.CommonName, serial, source).Set(boolValue(chainValid))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// RegisterCircuitBreaker exposes the state of the hystrix circuit with the given name.
+func RegisterCircuitBreaker(name string) {
+	if promState == nil {
+		return
+	}
+	promState.circuitBreakers.add(name)
+}
+
+// circuitBreakerCollector reads the state of the hystrix circuits on scrape.
+type circuitBreakerCollector struct {
+	desc  *prometheus.Desc
+	mu    sync.RWMutex
+	names map[string]struct{}
+}
+
+func newCircuitBreakerCollector() *circuitBreakerCollector {
+	return &circuitBreakerCollector{
+		desc: prometheus.NewDesc(MetricNamePrefix+"circuit_breaker_open",
+			"circuit breaker is open, described by gauge value of 0 or 1.", []string{nameLabel}, nil),
+		names: make(map[string]struct{}),
+	}
+}
+
+func (c *circuitBreakerCollector) add(name string) {
+	c.mu.Lock()
+	c.names[name] = struct{}{}
+	c.mu.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (c *circuitBreakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *circuitBreakerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name := range c.names {
+		circuit, _, err := hystrix.GetCircuit(name)
+		if err != nil {
+			continue
+		}
+		var value float64
+		if circuit.IsOpen() {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, value, name)
+	}
+}
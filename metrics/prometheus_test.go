@@ -0,0 +1,185 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/21
+
+package metrics
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// withPrometheus runs fn with fresh collectors.
+func withPrometheus(t *testing.T, fn func()) {
+	t.Helper()
+	previous := promState
+	promState = newPrometheusState(prometheus.DefBuckets)
+	defer func() { promState = previous }()
+	fn()
+}
+
+func TestDisabled(t *testing.T) {
+	previous := promState
+	promState = nil
+	defer func() { promState = previous }()
+
+	if ConnState("web") != nil {
+		t.Error("the connections are counted without prometheus")
+	}
+	// the recorders are no-ops.
+	SetServerEnabled("whoami", "http://10.0.0.1", true)
+	RateLimitRejected("whoami", "whoami", "burst")
+	RegisterCircuitBreaker("whoami")
+	NewRetryListener("whoami").Retried(nil, 1)
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got %d, want no metrics", rec.Code)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	withPrometheus(t, func() {
+		next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/missing" {
+				rw.WriteHeader(http.StatusNotFound)
+			}
+		})
+		testCases := []struct {
+			method, path string
+			header       http.Header
+			labels       []string
+		}{
+			{method: http.MethodGet, path: "/", labels: []string{"web", "200", http.MethodGet, protocolHTTP}},
+			{method: http.MethodPost, path: "/missing", labels: []string{"web", "404", http.MethodPost, protocolHTTP}},
+			{method: "PURGE", path: "/", labels: []string{"web", "200", "EXTENSION_METHOD", protocolHTTP}},
+			{
+				method: http.MethodGet, path: "/",
+				header: http.Header{"Connection": {"keep-alive, Upgrade"}, "Upgrade": {"websocket"}},
+				labels: []string{"web", "200", http.MethodGet, protocolWebsocket},
+			},
+			{
+				method: http.MethodGet, path: "/",
+				header: http.Header{"Accept": {"text/event-stream"}},
+				labels: []string{"web", "200", http.MethodGet, protocolSSE},
+			},
+		}
+		handler := NewEntryPointMiddleware(next, "web")
+		for _, tc := range testCases {
+			req := httptest.NewRequest(tc.method, "http://example.com"+tc.path, nil)
+			req.Header = tc.header
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if got := testutil.ToFloat64(promState.entryPointReqs.WithLabelValues(tc.labels...)); got != 1 {
+				t.Errorf("%v: got %v requests, want 1", tc.labels, got)
+			}
+		}
+
+		handler = NewServiceMiddleware(NewRouterMiddleware(next, "whoami", "whoami"), "whoami")
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		if got := testutil.ToFloat64(promState.routerReqs.WithLabelValues("whoami", "whoami", "200", http.MethodGet, protocolHTTP)); got != 1 {
+			t.Errorf("got %v router requests, want 1", got)
+		}
+		if got := testutil.ToFloat64(promState.serviceReqs.WithLabelValues("whoami", "200", http.MethodGet, protocolHTTP)); got != 1 {
+			t.Errorf("got %v service requests, want 1", got)
+		}
+	})
+}
+
+func TestConnState(t *testing.T) {
+	withPrometheus(t, func() {
+		hook := ConnState("web")
+		for _, state := range []http.ConnState{http.StateNew, http.StateNew, http.StateActive, http.StateIdle,
+			http.StateClosed, http.StateNew, http.StateHijacked} {
+			hook(nil, state)
+		}
+		if got := testutil.ToFloat64(promState.entryPointOpenConns.WithLabelValues("web")); got != 1 {
+			t.Errorf("got %v open connections, want 1", got)
+		}
+	})
+}
+
+func TestRecorders(t *testing.T) {
+	withPrometheus(t, func() {
+		listener := NewRetryListener("whoami")
+		listener.Retried(nil, 1)
+		listener.Retried(nil, 2)
+		if got := testutil.ToFloat64(promState.serviceRetries.WithLabelValues("whoami")); got != 2 {
+			t.Errorf("got %v retries, want 2", got)
+		}
+
+		SetServerEnabled("whoami", "http://10.0.0.1", true)
+		SetServerEnabled("whoami", "http://10.0.0.2", true)
+		SetServerEnabled("whoami", "http://10.0.0.2", false)
+		if got := testutil.ToFloat64(promState.serviceServerEnabled.WithLabelValues("whoami", "http://10.0.0.1")); got != 1 {
+			t.Errorf("got the server enabled %v, want 1", got)
+		}
+		if got := testutil.ToFloat64(promState.serviceServerEnabled.WithLabelValues("whoami", "http://10.0.0.2")); got != 0 {
+			t.Errorf("got the server enabled %v, want 0", got)
+		}
+
+		RateLimitRejected("whoami", "whoami", "burst")
+		RateLimitRejected("whoami", "whoami", "delay")
+		RateLimitRejected("whoami", "whoami", "delay")
+		RateLimitRejected("", "", "delay")
+		if got := testutil.ToFloat64(promState.rateLimitRejected.WithLabelValues("whoami", "whoami", "delay")); got != 2 {
+			t.Errorf("got %v rejected requests, want 2", got)
+		}
+
+		notAfter := time.Date(2031, time.January, 21, 0, 0, 0, 0, time.UTC)
+		SetCertificateExpiry(&x509.Certificate{
+			Subject:      pkix.Name{CommonName: "example.com"},
+			SerialNumber: big.NewInt(42),
+			DNSNames:     []string{"www.example.com", "example.com"},
+			NotAfter:     notAfter,
+		})
+		if got := testutil.ToFloat64(promState.tlsCertsNotAfter.WithLabelValues(
+			"example.com", "42", "example.com,www.example.com")); got != float64(notAfter.Unix()) {
+			t.Errorf("got the expiry %v, want %d", got, notAfter.Unix())
+		}
+		// the renewed certificate replaces the series of the previous one.
+		DeleteCertificate(&x509.Certificate{
+			Subject:      pkix.Name{CommonName: "example.com"},
+			SerialNumber: big.NewInt(41),
+			DNSNames:     []string{"example.com", "www.example.com"},
+		})
+		if n := testutil.CollectAndCount(promState.tlsCertsNotAfter); n != 1 {
+			t.Errorf("got %d certificate series, want 1", n)
+		}
+		DeleteCertificate(&x509.Certificate{
+			Subject:      pkix.Name{CommonName: "example.com"},
+			SerialNumber: big.NewInt(42),
+			DNSNames:     []string{"example.com", "www.example.com"},
+		})
+		if n := testutil.CollectAndCount(promState.tlsCertsNotAfter); n != 0 {
+			t.Errorf("got %d certificate series, want 0", n)
+		}
+
+		RegisterCircuitBreaker("whoami")
+
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		for _, line := range []string{
+			`proxy_circuit_breaker_open{name="whoami"} 0`,
+			`proxy_service_retries_total{service="whoami"} 2`,
+			`proxy_ratelimit_rejected_total{reason="burst",router="whoami",service="whoami"} 1`,
+			`proxy_ratelimit_rejected_total{reason="delay",router="",service=""} 1`,
+			`proxy_service_server_enabled{service="whoami",url="http://10.0.0.2"} 0`,
+		} {
+			if !strings.Contains(rec.Body.String(), line) {
+				t.Errorf("missing %s", line)
+			}
+		}
+	})
+}
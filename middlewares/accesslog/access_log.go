@@ -0,0 +1,310 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/20
+
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/middlewares"
+	"github.com/crochee/proxy/middlewares/requestid"
+	"github.com/crochee/proxy/util"
+)
+
+type key string
+
+const (
+	// DataTableKey is the key within the request context used to store the Log Data Table.
+	DataTableKey key = "LogDataTable"
+)
+
+// GetLogData gets the request context object that contains logging data.
+// This creates data as the request passes through the middleware chain.
+func GetLogData(req *http.Request) *LogData {
+	if ld, ok := req.Context().Value(DataTableKey).(*LogData); ok {
+		return ld
+	}
+	return nil
+}
+
+// Handler will write each request and its response to the access log.
+type Handler struct {
+	next           http.Handler
+	entryPointName string
+	config         config.AccessLog
+	formatter      formatter
+	writer         io.Writer
+	closer         io.Closer
+	httpCodeRanges util.HTTPCodeRanges
+	logChan        chan *LogData
+	wg             sync.WaitGroup
+	mu             sync.Mutex
+	closeMu        sync.RWMutex
+	closed         bool
+	ctx            context.Context
+}
+
+// New creates a new access log middleware for the given entry point.
+// Entries are written to FilePath, rotated like the application logs, or to stdout when it is empty.
+func New(ctx context.Context, next http.Handler, cfg config.AccessLog, entryPointName string) (*Handler, error) {
+	var f formatter
+	switch cfg.Format {
+	case "", config.CommonFormat:
+		f = commonFormatter{fields: canonicalFields(cfg.Fields)}
+	case config.JSONFormat:
+		f = jsonFormatter{fields: canonicalFields(cfg.Fields)}
+	default:
+		return nil, fmt.Errorf("unsupported access log format: %q, proxy only supports %q and %q",
+			cfg.Format, config.CommonFormat, config.JSONFormat)
+	}
+
+	h := &Handler{
+		next:           next,
+		entryPointName: entryPointName,
+		config:         cfg,
+		formatter:      f,
+		ctx:            ctx,
+	}
+	if cfg.FilePath == "" {
+		h.writer = os.Stdout
+	} else {
+		w := logger.SetLoggerWriter(cfg.FilePath)
+		h.writer = w
+		if c, ok := w.(io.Closer); ok {
+			h.closer = c
+		}
+	}
+
+	if cfg.Filters != nil && len(cfg.Filters.StatusCodes) != 0 {
+		var err error
+		if h.httpCodeRanges, err = util.NewHTTPCodeRanges(cfg.Filters.StatusCodes); err != nil {
+			return nil, fmt.Errorf("invalid access log status code filter: %w", err)
+		}
+	}
+
+	if cfg.BufferingSize > 0 {
+		h.logChan = make(chan *LogData, cfg.BufferingSize)
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			for data := range h.logChan {
+				h.logTheRoundTrip(data)
+			}
+		}()
+	}
+	return h, nil
+}
+
+// canonicalFields returns a copy of fields in which header names are canonical.
+func canonicalFields(fields *config.AccessLogFields) *config.AccessLogFields {
+	if fields == nil || fields.Headers == nil {
+		return fields
+	}
+	copied := *fields
+	headers := *fields.Headers
+	headers.Names = make(map[string]string, len(fields.Headers.Names))
+	for name, mode := range fields.Headers.Names {
+		headers.Names[http.CanonicalHeaderKey(name)] = mode
+	}
+	copied.Headers = &headers
+	return &copied
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	now := time.Now().UTC()
+
+	core := CoreLogData{
+		StartUTC:       now,
+		StartLocal:     now.Local(),
+		EntryPointName: h.entryPointName,
+	}
+	logDataTable := &LogData{Core: core, Request: req.Header.Clone()}
+
+	reqWithDataTable := req.WithContext(context.WithValue(req.Context(), DataTableKey, logDataTable))
+
+	var crr *captureRequestReader
+	if req.Body != nil {
+		crr = &captureRequestReader{source: req.Body}
+		reqWithDataTable.Body = crr
+	}
+
+	if id := requestid.FromContext(req.Context()); id != "" {
+		core[RequestID] = id
+	}
+	core[RequestAddr] = req.Host
+	core[RequestHost], core[RequestPort] = silentSplitHostPort(req.Host)
+	// copy the URL without the scheme, hostname etc
+	urlCopy := &url.URL{
+		Path:       req.URL.Path,
+		RawPath:    req.URL.RawPath,
+		RawQuery:   req.URL.RawQuery,
+		ForceQuery: req.URL.ForceQuery,
+		Fragment:   req.URL.Fragment,
+	}
+	core[RequestPath] = urlCopy.String()
+	core[RequestProtocol] = req.Proto
+	core[RequestScheme] = "http"
+	if req.TLS != nil {
+		core[RequestScheme] = "https"
+	}
+	core[RequestMethod] = req.Method
+	core[ClientAddr] = req.RemoteAddr
+	core[ClientHost], core[ClientPort] = silentSplitHostPort(req.RemoteAddr)
+	if req.URL.User != nil {
+		if username := req.URL.User.Username(); username != "" {
+			core[ClientUsername] = username
+		}
+	}
+
+	crw := middlewares.NewResponseWriter(rw)
+
+	h.next.ServeHTTP(crw, reqWithDataTable)
+
+	core[Duration] = time.Since(now)
+	if crr != nil {
+		core[RequestContentSize] = crr.count
+	}
+	core[DownstreamStatus] = crw.Status()
+	core[DownstreamContentSize] = crw.Size()
+	logDataTable.DownstreamResponse = crw.Header().Clone()
+
+	// the read lock keeps Close from closing the channel and the writer during the send,
+	// the entries of the requests outliving Close, such as hijacked connections, are dropped.
+	h.closeMu.RLock()
+	defer h.closeMu.RUnlock()
+	if h.closed {
+		return
+	}
+	if h.logChan != nil {
+		h.logChan <- logDataTable
+		return
+	}
+	h.logTheRoundTrip(logDataTable)
+}
+
+// Close closes the Logger (i.e. the file, drain logHandlerChan, etc).
+func (h *Handler) Close() error {
+	h.closeMu.Lock()
+	if h.closed {
+		h.closeMu.Unlock()
+		return nil
+	}
+	h.closed = true
+	h.closeMu.Unlock()
+
+	if h.logChan != nil {
+		close(h.logChan)
+		h.wg.Wait()
+	}
+	if h.closer != nil {
+		return h.closer.Close()
+	}
+	return nil
+}
+
+func (h *Handler) logTheRoundTrip(logDataTable *LogData) {
+	core := logDataTable.Core
+
+	retryAttempts, ok := core[RetryAttempts].(int)
+	if !ok {
+		retryAttempts = 0
+	}
+	core[RetryAttempts] = retryAttempts
+
+	status, _ := core[DownstreamStatus].(int)
+	duration, _ := core[Duration].(time.Duration)
+	if !h.keepAccessLog(status, retryAttempts, duration) {
+		return
+	}
+
+	line, err := h.formatter.Format(logDataTable)
+	if err != nil {
+		logger.FromContext(h.ctx).Errorf("Error while formatting access log entry: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err = h.writer.Write(line); err != nil {
+		logger.FromContext(h.ctx).Errorf("Error while writing access log entry: %v", err)
+	}
+}
+
+func (h *Handler) keepAccessLog(statusCode, retryAttempts int, duration time.Duration) bool {
+	filters := h.config.Filters
+	if filters == nil {
+		// no filters were specified
+		return true
+	}
+
+	if len(h.httpCodeRanges) == 0 && !filters.RetryAttempts && filters.MinDuration == 0 {
+		// an empty filters section was specified
+		return true
+	}
+
+	if h.httpCodeRanges.Contains(statusCode) {
+		return true
+	}
+
+	if filters.RetryAttempts && retryAttempts > 0 {
+		return true
+	}
+
+	if filters.MinDuration > 0 && duration > filters.MinDuration {
+		return true
+	}
+
+	return false
+}
+
+func silentSplitHostPort(value string) (host, port string) {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return value, "-"
+	}
+	return host, port
+}
+
+// captureRequestReader counts the bytes of the request body.
+type captureRequestReader struct {
+	source io.ReadCloser
+	count  int64
+}
+
+func (r *captureRequestReader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+func (r *captureRequestReader) Close() error {
+	return r.source.Close()
+}
+
+// toLog returns the value of the field, or "-" when missing.
+func toLog(fields CoreLogData, key string) interface{} {
+	if v, ok := fields[key]; ok && v != nil && v != "" {
+		return v
+	}
+	return "-"
+}
+
+// headerValue returns the value of the header, or "-" when missing.
+func headerValue(headers http.Header, key string) string {
+	if v := strings.Join(headers.Values(key), ","); v != "" {
+		return v
+	}
+	return "-"
+}
@@ -0,0 +1,215 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/20
+
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/config"
+)
+
+func testLogData() *LogData {
+	start := time.Date(2021, time.January, 20, 10, 30, 0, 0, time.UTC)
+	return &LogData{
+		Core: CoreLogData{
+			StartUTC:              start,
+			StartLocal:            start,
+			Duration:              25 * time.Millisecond,
+			ClientHost:            "192.0.2.1",
+			RequestMethod:         http.MethodGet,
+			RequestPath:           "/a?b=c",
+			RequestProtocol:       "HTTP/1.1",
+			DownstreamStatus:      http.StatusOK,
+			DownstreamContentSize: int64(5),
+			RetryAttempts:         1,
+			RouterName:            "web",
+			ServiceAddr:           "10.0.0.1:8080",
+		},
+		Request: http.Header{
+			"Referer":       {"http://example.com/"},
+			"User-Agent":    {"curl"},
+			"Authorization": {"Bearer secret"},
+		},
+		DownstreamResponse: http.Header{"Content-Type": {"text/plain"}},
+	}
+}
+
+func TestCommonFormatter(t *testing.T) {
+	testCases := []struct {
+		name   string
+		fields *config.AccessLogFields
+		want   string
+	}{
+		{
+			name: "default",
+			want: `192.0.2.1 - - [20/Jan/2021:10:30:00 +0000] "GET /a?b=c HTTP/1.1" 200 5 "http://example.com/" "curl" 1 "web" "10.0.0.1:8080" "-" 25ms` + "\n",
+		},
+		{
+			name: "redacted",
+			fields: &config.AccessLogFields{
+				DefaultMode: config.FieldModeDrop,
+				Headers: &config.FieldHeaders{
+					DefaultMode: config.FieldModeDrop,
+					Names:       map[string]string{"User-Agent": config.FieldModeRedact},
+				},
+			},
+			want: `192.0.2.1 - - [20/Jan/2021:10:30:00 +0000] "GET /a?b=c HTTP/1.1" 200 5 "http://example.com/" "REDACTED" 1 "web" "10.0.0.1:8080" "-" 25ms` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		line, err := commonFormatter{fields: canonicalFields(tc.fields)}.Format(testLogData())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if string(line) != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, line, tc.want)
+		}
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	testCases := []struct {
+		name    string
+		fields  *config.AccessLogFields
+		want    map[string]interface{}
+		missing []string
+	}{
+		{
+			name: "default",
+			want: map[string]interface{}{
+				ClientHost:       "192.0.2.1",
+				DownstreamStatus: float64(http.StatusOK),
+				Duration:         float64(25 * time.Millisecond),
+			},
+			missing: []string{RequestUserAgentHeader, "request_Authorization"},
+		},
+		{
+			name: "filtered",
+			fields: &config.AccessLogFields{
+				DefaultMode: config.FieldModeKeep,
+				Names:       map[string]string{ClientHost: config.FieldModeDrop},
+				Headers: &config.FieldHeaders{
+					DefaultMode: config.FieldModeDrop,
+					Names: map[string]string{
+						"user-agent":    config.FieldModeKeep,
+						"Authorization": config.FieldModeRedact,
+						"Content-Type":  config.FieldModeKeep,
+					},
+				},
+			},
+			want: map[string]interface{}{
+				RouterName:                "web",
+				RequestUserAgentHeader:    "curl",
+				"request_Authorization":   "REDACTED",
+				"downstream_Content-Type": "text/plain",
+			},
+			missing: []string{ClientHost, RequestRefererHeader},
+		},
+		{
+			name: "dropped",
+			fields: &config.AccessLogFields{
+				DefaultMode: config.FieldModeDrop,
+				Names:       map[string]string{DownstreamStatus: config.FieldModeKeep},
+			},
+			want:    map[string]interface{}{DownstreamStatus: float64(http.StatusOK)},
+			missing: []string{ClientHost, RouterName, Duration},
+		},
+	}
+	for _, tc := range testCases {
+		line, err := jsonFormatter{fields: canonicalFields(tc.fields)}.Format(testLogData())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var entry map[string]interface{}
+		if err = json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		for k, v := range tc.want {
+			if entry[k] != v {
+				t.Errorf("%s: got %s %v, want %v", tc.name, k, entry[k], v)
+			}
+		}
+		for _, k := range tc.missing {
+			if v, ok := entry[k]; ok {
+				t.Errorf("%s: got %s %v, want it dropped", tc.name, k, v)
+			}
+		}
+	}
+}
+
+func TestKeepAccessLog(t *testing.T) {
+	testCases := []struct {
+		name          string
+		filters       *config.AccessLogFilters
+		status        int
+		retryAttempts int
+		duration      time.Duration
+		keep          bool
+	}{
+		{name: "no filters", status: http.StatusOK, keep: true},
+		{name: "empty filters", filters: &config.AccessLogFilters{}, status: http.StatusOK, keep: true},
+		{name: "status kept", filters: &config.AccessLogFilters{StatusCodes: []string{"400-499", "502"}}, status: http.StatusNotFound, keep: true},
+		{name: "status dropped", filters: &config.AccessLogFilters{StatusCodes: []string{"400-499", "502"}}, status: http.StatusOK},
+		{name: "retried", filters: &config.AccessLogFilters{RetryAttempts: true}, status: http.StatusOK, retryAttempts: 1, keep: true},
+		{name: "not retried", filters: &config.AccessLogFilters{RetryAttempts: true}, status: http.StatusOK},
+		{name: "slow", filters: &config.AccessLogFilters{MinDuration: time.Second}, duration: 2 * time.Second, keep: true},
+		{name: "fast", filters: &config.AccessLogFilters{MinDuration: time.Second}, duration: time.Millisecond},
+	}
+	for _, tc := range testCases {
+		h, err := New(context.Background(), http.NotFoundHandler(), config.AccessLog{Filters: tc.filters}, "web")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if keep := h.keepAccessLog(tc.status, tc.retryAttempts, tc.duration); keep != tc.keep {
+			t.Errorf("%s: got %v, want %v", tc.name, keep, tc.keep)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	for _, bufferingSize := range []int64{0, 10} {
+		h, err := New(context.Background(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			_, _ = ioutil.ReadAll(req.Body)
+			rw.WriteHeader(http.StatusTeapot)
+			_, _ = rw.Write([]byte("hello"))
+		}), config.AccessLog{Format: config.JSONFormat, BufferingSize: bufferingSize}, "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		h.writer = &buf
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/a", strings.NewReader("body"))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if err = h.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var entry map[string]interface{}
+		if err = json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("buffering %d: %v", bufferingSize, err)
+		}
+		if entry[DownstreamStatus] != float64(http.StatusTeapot) || entry[DownstreamContentSize] != float64(5) ||
+			entry[RequestContentSize] != float64(4) || entry[EntryPointName] != "web" {
+			t.Errorf("buffering %d: got %v", bufferingSize, entry)
+		}
+
+		// the requests served after Close, such as hijacked connections, neither panic nor log.
+		buf.Reset()
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if buf.Len() != 0 {
+			t.Errorf("buffering %d: logged %q after Close", bufferingSize, buf.String())
+		}
+		if err = h.Close(); err != nil {
+			t.Errorf("buffering %d: closed twice: %v", bufferingSize, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/20
+
+package accesslog
+
+import (
+	"net/http"
+
+	"github.com/crochee/proxy/middlewares"
+)
+
+// FieldApply function hook to add data in accesslog.
+type FieldApply func(rw http.ResponseWriter, r *http.Request, next http.Handler, data *LogData)
+
+// FieldHandler sends a new field to the logger.
+type FieldHandler struct {
+	next    http.Handler
+	name    string
+	value   string
+	applyFn FieldApply
+}
+
+// NewFieldHandler creates a Field handler.
+func NewFieldHandler(next http.Handler, name, value string, applyFn FieldApply) http.Handler {
+	return &FieldHandler{next: next, name: name, value: value, applyFn: applyFn}
+}
+
+func (f *FieldHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	table := GetLogData(req)
+	if table == nil {
+		f.next.ServeHTTP(rw, req)
+		return
+	}
+
+	table.Core[f.name] = f.value
+
+	if f.applyFn != nil {
+		f.applyFn(rw, req, f.next, table)
+	} else {
+		f.next.ServeHTTP(rw, req)
+	}
+}
+
+// AddServiceFields add service fields.
+func AddServiceFields(rw http.ResponseWriter, req *http.Request, next http.Handler, data *LogData) {
+	data.Core[ServiceURL] = req.URL.Scheme + "://" + req.URL.Host
+	data.Core[ServiceAddr] = req.URL.Host
+
+	crw := middlewares.NewResponseWriter(rw)
+	next.ServeHTTP(crw, req)
+
+	data.Core[OriginStatus] = crw.Status()
+	data.Core[OriginContentSize] = crw.Size()
+}
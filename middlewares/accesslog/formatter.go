@@ -0,0 +1,113 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/20
+
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/crochee/proxy/config"
+)
+
+// default format for time presentation.
+const commonLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// redacted replaces the value of the redacted headers.
+const redacted = "REDACTED"
+
+type formatter interface {
+	Format(data *LogData) ([]byte, error)
+}
+
+// commonFormatter provides formatting in the Common Log Format,
+// extended with the retry attempts, router, upstream and duration.
+// Its columns are fixed: no field is dropped, the Referer and User-Agent are only redacted.
+type commonFormatter struct {
+	fields *config.AccessLogFields
+}
+
+// Format formats the log entry in the Common Log Format.
+func (c commonFormatter) Format(data *LogData) ([]byte, error) {
+	b := &bytes.Buffer{}
+
+	var timestamp string
+	if v, ok := data.Core[StartLocal].(time.Time); ok {
+		timestamp = v.Format(commonLogTimeFormat)
+	}
+
+	var elapsedMillis int64
+	if v, ok := data.Core[Duration].(time.Duration); ok {
+		elapsedMillis = v.Nanoseconds() / int64(time.Millisecond)
+	}
+
+	_, err := fmt.Fprintf(b, "%s - %s [%s] \"%s %s %s\" %v %v %q %q %v %q %q %q %dms\n",
+		toLog(data.Core, ClientHost),
+		toLog(data.Core, ClientUsername),
+		timestamp,
+		toLog(data.Core, RequestMethod),
+		toLog(data.Core, RequestPath),
+		toLog(data.Core, RequestProtocol),
+		toLog(data.Core, DownstreamStatus),
+		toLog(data.Core, DownstreamContentSize),
+		c.header(data.Request, "Referer"),
+		c.header(data.Request, "User-Agent"),
+		toLog(data.Core, RetryAttempts),
+		toLog(data.Core, RouterName),
+		toLog(data.Core, ServiceAddr),
+		toLog(data.Core, RequestID),
+		elapsedMillis)
+
+	return b.Bytes(), err
+}
+
+// header returns the value of the header, replaced when its mode is redact.
+func (c commonFormatter) header(headers map[string][]string, key string) string {
+	if c.fields != nil && c.fields.Headers != nil && c.fields.KeepHeader(key) == config.FieldModeRedact {
+		return redacted
+	}
+	return headerValue(headers, key)
+}
+
+// jsonFormatter writes one JSON object per entry, filtered by the configured fields.
+type jsonFormatter struct {
+	fields *config.AccessLogFields
+}
+
+// Format formats the log entry as a JSON object.
+func (j jsonFormatter) Format(data *LogData) ([]byte, error) {
+	entry := make(map[string]interface{}, len(data.Core))
+	for k, v := range data.Core {
+		if !j.fields.Keep(k) {
+			continue
+		}
+		if d, ok := v.(time.Duration); ok {
+			entry[k] = d.Nanoseconds()
+			continue
+		}
+		entry[k] = v
+	}
+
+	addHeaders(entry, "request_", data.Request, j.fields)
+	addHeaders(entry, "downstream_", data.DownstreamResponse, j.fields)
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func addHeaders(entry map[string]interface{}, prefix string, headers map[string][]string, fields *config.AccessLogFields) {
+	for k := range headers {
+		switch fields.KeepHeader(k) {
+		case config.FieldModeKeep:
+			entry[prefix+k] = headerValue(headers, k)
+		case config.FieldModeRedact:
+			entry[prefix+k] = redacted
+		}
+	}
+}
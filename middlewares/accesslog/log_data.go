@@ -0,0 +1,83 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/20
+
+package accesslog
+
+import "net/http"
+
+const (
+	// StartUTC is the map key used for the time at which request processing started.
+	StartUTC = "StartUTC"
+	// StartLocal is the map key used for the local time at which request processing started.
+	StartLocal = "StartLocal"
+	// Duration is the map key used for the total time taken by processing the response, including the origin server's time but
+	// not the log writing time.
+	Duration = "Duration"
+
+	// EntryPointName is the map key used for the name of the entry point.
+	EntryPointName = "EntryPointName"
+	// RouterName is the map key used for the name of the router.
+	RouterName = "RouterName"
+	// ServiceName is the map key used for the name of the service.
+	ServiceName = "ServiceName"
+	// ServiceURL is the map key used for the URL of the upstream server.
+	ServiceURL = "ServiceURL"
+	// ServiceAddr is the map key used for the IP:port of the upstream server.
+	ServiceAddr = "ServiceAddr"
+
+	// ClientAddr is the map key used for the remote address in its original form (usually IP:port).
+	ClientAddr = "ClientAddr"
+	// ClientHost is the map key used for the remote IP address from which the client request was received.
+	ClientHost = "ClientHost"
+	// ClientPort is the map key used for the remote TCP port from which the client request was received.
+	ClientPort = "ClientPort"
+	// ClientUsername is the map key used for the username provided in the URL, if present.
+	ClientUsername = "ClientUsername"
+	// RequestID is the map key used for the request id, if any.
+	RequestID = "RequestID"
+	// RequestAddr is the map key used for the HTTP Host header (usually IP:port).
+	RequestAddr = "RequestAddr"
+	// RequestHost is the map key used for the HTTP Host server name (not including port).
+	RequestHost = "RequestHost"
+	// RequestPort is the map key used for the TCP port from the HTTP Host.
+	RequestPort = "RequestPort"
+	// RequestMethod is the map key used for the HTTP method.
+	RequestMethod = "RequestMethod"
+	// RequestPath is the map key used for the HTTP request URI, not including the scheme, host or port.
+	RequestPath = "RequestPath"
+	// RequestProtocol is the map key used for the version of HTTP requested.
+	RequestProtocol = "RequestProtocol"
+	// RequestScheme is the map key used for the HTTP request scheme.
+	RequestScheme = "RequestScheme"
+	// RequestContentSize is the map key used for the number of bytes in the request entity (a.k.a. body) sent by the client.
+	RequestContentSize = "RequestContentSize"
+	// RequestRefererHeader is the Referer header in the request.
+	RequestRefererHeader = "request_Referer"
+	// RequestUserAgentHeader is the User-Agent header in the request.
+	RequestUserAgentHeader = "request_User-Agent"
+
+	// OriginStatus is the map key used for the HTTP status code returned by the origin server.
+	// If the request was handled by this proxy, the value will be absent.
+	OriginStatus = "OriginStatus"
+	// OriginContentSize is the map key used for the content length specified by the origin server, or 0 if unspecified.
+	OriginContentSize = "OriginContentSize"
+
+	// DownstreamStatus is the map key used for the HTTP status code returned to the client.
+	DownstreamStatus = "DownstreamStatus"
+	// DownstreamContentSize is the map key used for the number of bytes in the response entity returned to the client.
+	DownstreamContentSize = "DownstreamContentSize"
+
+	// RetryAttempts is the map key used for the amount of attempts the request was retried.
+	RetryAttempts = "RetryAttempts"
+)
+
+// CoreLogData holds the fields computed from the request/response.
+type CoreLogData map[string]interface{}
+
+// LogData is the data captured by the middleware so that it can be logged.
+type LogData struct {
+	Core               CoreLogData
+	Request            http.Header
+	DownstreamResponse http.Header
+}
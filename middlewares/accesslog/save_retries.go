@@ -0,0 +1,25 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/20
+
+package accesslog
+
+import (
+	"net/http"
+)
+
+// SaveRetries is an implementation of retry.Listener that stores RetryAttempts in the LogDataTable.
+type SaveRetries struct{}
+
+// Retried implements the retry.Listener interface and will be called for each retry that happens.
+func (s *SaveRetries) Retried(req *http.Request, attempt int) {
+	// it is the request attempt x, but the retry attempt is x-1
+	if attempt > 0 {
+		attempt--
+	}
+
+	table := GetLogData(req)
+	if table != nil {
+		table.Core[RetryAttempts] = attempt
+	}
+}
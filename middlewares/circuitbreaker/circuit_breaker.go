@@ -8,35 +8,67 @@ package circuitbreaker
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/afex/hystrix-go/hystrix"
+
 	"github.com/crochee/proxy/config/dynamic"
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/metrics"
+	"github.com/crochee/proxy/middlewares"
 )
 
 type circuitBreaker struct {
-	name string
-	next http.Handler
-	ctx  context.Context
+	name    string
+	next    http.Handler
+	circuit *hystrix.CircuitBreaker
+	ctx     context.Context
 }
 
-// New creates a new circuit breaker middleware.
+// New creates a new circuit breaker middleware reporting the responses of next to the hystrix circuit name,
+// the requests are answered 503 Service Unavailable while the circuit is open.
 func New(ctx context.Context, next http.Handler, breaker dynamic.CircuitBreaker, name string) (http.Handler, error) {
+	if breaker.RequestVolumeThreshold < 0 || breaker.ErrorPercentThreshold < 0 || breaker.SleepWindow < 0 {
+		return nil, fmt.Errorf("invalid circuit breaker of %s: negative threshold or sleep window", name)
+	}
 	hystrix.ConfigureCommand(name, hystrix.CommandConfig{
-		Timeout:                0,
-		MaxConcurrentRequests:  0,
-		RequestVolumeThreshold: 0,
-		SleepWindow:            0,
-		ErrorPercentThreshold:  0,
+		RequestVolumeThreshold: breaker.RequestVolumeThreshold,
+		SleepWindow:            int(breaker.SleepWindow / time.Millisecond),
+		ErrorPercentThreshold:  breaker.ErrorPercentThreshold,
 	})
+	circuit, _, err := hystrix.GetCircuit(name)
+	if err != nil {
+		return nil, err
+	}
+	metrics.RegisterCircuitBreaker(name)
 	return &circuitBreaker{
-		name: name,
-		next: next,
-		ctx:  ctx,
+		name:    name,
+		next:    next,
+		circuit: circuit,
+		ctx:     ctx,
 	}, nil
 }
 
-// todo 熔断器待实现
 func (c *circuitBreaker) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	c.next.ServeHTTP(rw, req)
+	start := time.Now()
+	if !c.circuit.AllowRequest() {
+		c.report("short-circuit", start)
+		http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	recorder := middlewares.NewResponseWriter(rw)
+	c.next.ServeHTTP(recorder, req)
+	if recorder.Status() >= http.StatusInternalServerError {
+		c.report("failure", start)
+		return
+	}
+	c.report("success", start)
+}
+
+func (c *circuitBreaker) report(event string, start time.Time) {
+	if err := c.circuit.ReportEvent([]string{event}, start, time.Since(start)); err != nil {
+		logger.FromContext(c.ctx).Errorf("circuit breaker %s failed to report %s: %v", c.name, event, err)
+	}
 }
@@ -0,0 +1,60 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2020-2020. All rights reserved.
+// Description:
+// Author: l30002214
+// Create: 2021/1/21
+
+package circuitbreaker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/config/dynamic"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls int
+	next := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		calls++
+		rw.WriteHeader(http.StatusBadGateway)
+	})
+	handler, err := New(context.Background(), next, dynamic.CircuitBreaker{
+		RequestVolumeThreshold: 2,
+		ErrorPercentThreshold:  50,
+		SleepWindow:            time.Hour,
+	}, "TestCircuitBreaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		if rec.Code != http.StatusBadGateway {
+			t.Fatalf("request %d: got %d, want the response of next", i, rec.Code)
+		}
+	}
+	// the circuit counts the failures asynchronously.
+	deadline := time.Now().Add(5 * time.Second)
+	for !handler.(*circuitBreaker).circuit.IsOpen() {
+		if time.Now().After(deadline) {
+			t.Fatal("the circuit is not opened by the failures")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if rec.Code != http.StatusServiceUnavailable || calls != 2 {
+		t.Errorf("got %d after %d calls, want 503 without calling next", rec.Code, calls)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(context.Background(), http.NotFoundHandler(), dynamic.CircuitBreaker{
+		SleepWindow: -time.Second,
+	}, "TestNewInvalid"); err == nil {
+		t.Error("expected an error for a negative sleep window")
+	}
+}
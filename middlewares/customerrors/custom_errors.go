@@ -0,0 +1,334 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/18
+
+package customerrors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+
+	"github.com/crochee/proxy/config/dynamic"
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/util"
+)
+
+// customErrors is a middleware that replaces the body of responses whose status code
+// is in the configured ranges with a page served by an error backend or a local directory.
+type customErrors struct {
+	next           http.Handler
+	backendHandler http.Handler
+	directory      string
+	httpCodeRanges util.HTTPCodeRanges
+	query          string
+	ctx            context.Context
+}
+
+// New creates a new custom error pages middleware.
+// The error page is fetched from backend when it is not nil, and read from the directory
+// when the backend fails or is not set.
+func New(ctx context.Context, next http.Handler, config dynamic.ErrorPage, backend http.Handler) (http.Handler, error) {
+	httpCodeRanges, err := util.NewHTTPCodeRanges(config.Status)
+	if err != nil {
+		return nil, err
+	}
+	if config.Directory == "" && backend == nil {
+		return nil, errors.New("error pages need a service or a directory")
+	}
+	return &customErrors{
+		next:           next,
+		backendHandler: backend,
+		directory:      config.Directory,
+		httpCodeRanges: httpCodeRanges,
+		query:          config.Query,
+		ctx:            ctx,
+	}, nil
+}
+
+func (c *customErrors) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	catcher := newCodeCatcher(rw, c.httpCodeRanges)
+	c.next.ServeHTTP(catcher, req)
+	if !catcher.isFilteredCode() {
+		return
+	}
+
+	code := catcher.getCode()
+	log := logger.FromContext(c.ctx)
+	log.Debugf("Caught HTTP Status Code %d, returning error page", code)
+
+	query := c.buildQuery(code, req)
+
+	// the page of the error backend comes first, then the one of the directory,
+	// the original response is sent when neither can be served.
+	if c.backendHandler != nil {
+		header, body, err := c.backendPage(query, req)
+		if err == nil {
+			writePage(c.ctx, rw, header, code, body)
+			return
+		}
+		log.Errorf("Unable to fetch error page for %d: %v", code, err)
+	}
+	if c.directory != "" {
+		header, body, err := c.filePage(query, code, req)
+		if err == nil {
+			writePage(c.ctx, rw, header, code, body)
+			return
+		}
+		log.Errorf("Unable to read error page for %d: %v", code, err)
+	}
+	writePage(c.ctx, rw, catcher.Header(), code, catcher.body.Bytes())
+}
+
+func (c *customErrors) buildQuery(code int, req *http.Request) string {
+	query := "/"
+	if len(c.query) > 0 {
+		query = strings.ReplaceAll(c.query, "{status}", strconv.Itoa(code))
+		query = strings.ReplaceAll(query, "{url}", url.QueryEscape(req.URL.String()))
+	}
+	return query
+}
+
+// backendPage fetches the error page from the backend, which must answer with a 2xx status.
+func (c *customErrors) backendPage(query string, req *http.Request) (http.Header, []byte, error) {
+	pageReq, err := newRequest("http://" + req.Host + query)
+	if err != nil {
+		return nil, nil, err
+	}
+	pageReq = pageReq.WithContext(req.Context())
+
+	recorder := newResponseRecorder()
+	c.backendHandler.ServeHTTP(recorder, pageReq)
+	if recorder.code < http.StatusOK || recorder.code >= http.StatusMultipleChoices {
+		return nil, nil, fmt.Errorf("error page backend answered %d", recorder.code)
+	}
+	return recorder.Header(), recorder.body.Bytes(), nil
+}
+
+// pageData is the data passed to the templates of the error page directory.
+type pageData struct {
+	Status     int
+	StatusText string
+	URL        string
+}
+
+// filePage executes the template of the directory matching the path of query.
+func (c *customErrors) filePage(query string, code int, req *http.Request) (http.Header, []byte, error) {
+	u, err := url.Parse(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := filepath.Join(c.directory, filepath.FromSlash(path.Clean("/"+u.Path)))
+	var content []byte
+	if content, err = ioutil.ReadFile(name); err != nil {
+		return nil, nil, err
+	}
+
+	data := pageData{
+		Status:     code,
+		StatusText: http.StatusText(code),
+		URL:        req.URL.String(),
+	}
+	var body bytes.Buffer
+	header := make(http.Header)
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".html" || ext == ".htm" {
+		var tpl *template.Template
+		if tpl, err = template.New(filepath.Base(name)).Parse(util.String(content)); err != nil {
+			return nil, nil, fmt.Errorf("parse %s failed: %w", name, err)
+		}
+		err = tpl.Execute(&body, data)
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	} else {
+		var tpl *textTemplate.Template
+		if tpl, err = textTemplate.New(filepath.Base(name)).Parse(util.String(content)); err != nil {
+			return nil, nil, fmt.Errorf("parse %s failed: %w", name, err)
+		}
+		err = tpl.Execute(&body, data)
+		header.Set("Content-Type", contentType(ext))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("execute %s failed: %w", name, err)
+	}
+	return header, body.Bytes(), nil
+}
+
+func contentType(ext string) string {
+	switch ext {
+	case ".json":
+		return "application/json"
+	case ".xml":
+		return "application/xml"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// writePage sends the page with the status code of the caught response.
+func writePage(ctx context.Context, rw http.ResponseWriter, header http.Header, code int, body []byte) {
+	copyHeaders(rw.Header(), header)
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rw.WriteHeader(code)
+	if _, err := rw.Write(body); err != nil {
+		logger.FromContext(ctx).Errorf("Error while writing error page: %v", err)
+	}
+}
+
+func newRequest(baseURL string) (*http.Request, error) {
+	u, err := url.ParseRequestURI(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("error pages: error when parse URL: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("error pages: error when create query: %w", err)
+	}
+
+	req.RequestURI = u.RequestURI()
+	return req, nil
+}
+
+func copyHeaders(dst, src http.Header) {
+	for k, vv := range src {
+		dst[k] = append(dst[k][:0], vv...)
+	}
+	dst.Del("Content-Length")
+}
+
+// codeCatcher is a response writer that detects as soon as possible whether the
+// response is a code within the ranges of codes it watches for. If it is, it
+// keeps the data of the response, sent back when no error page can be served.
+// Otherwise, it forwards it directly to the original client (its responseWriter)
+// without any buffering.
+type codeCatcher struct {
+	headerMap          http.Header
+	body               bytes.Buffer
+	code               int
+	httpCodeRanges     util.HTTPCodeRanges
+	caughtFilteredCode bool
+	responseWriter     http.ResponseWriter
+	headersSent        bool
+}
+
+func newCodeCatcher(rw http.ResponseWriter, httpCodeRanges util.HTTPCodeRanges) *codeCatcher {
+	return &codeCatcher{
+		headerMap:      make(http.Header),
+		code:           http.StatusOK, // If backend does not call WriteHeader on us, we consider it's a 200.
+		responseWriter: rw,
+		httpCodeRanges: httpCodeRanges,
+	}
+}
+
+func (cc *codeCatcher) Header() http.Header {
+	if cc.headerMap == nil {
+		cc.headerMap = make(http.Header)
+	}
+	return cc.headerMap
+}
+
+func (cc *codeCatcher) getCode() int {
+	return cc.code
+}
+
+// isFilteredCode returns whether the codeCatcher received a response code among the ones it is watching,
+// and for which the response should be deferred to the error handler.
+func (cc *codeCatcher) isFilteredCode() bool {
+	return cc.caughtFilteredCode
+}
+
+func (cc *codeCatcher) Write(buf []byte) (int, error) {
+	// If WriteHeader was already called from the caller, this is a NOOP.
+	// Otherwise, cc.code is actually a 200 here.
+	cc.WriteHeader(cc.code)
+
+	if cc.caughtFilteredCode {
+		// The contents are replaced by the error page,
+		// they are only kept for when it cannot be served.
+		return cc.body.Write(buf)
+	}
+	return cc.responseWriter.Write(buf)
+}
+
+func (cc *codeCatcher) WriteHeader(code int) {
+	if cc.headersSent || cc.caughtFilteredCode {
+		return
+	}
+
+	cc.code = code
+	if cc.httpCodeRanges.Contains(code) {
+		cc.caughtFilteredCode = true
+		return
+	}
+
+	copyHeaders(cc.responseWriter.Header(), cc.Header())
+	if length := cc.Header().Get("Content-Length"); length != "" {
+		cc.responseWriter.Header().Set("Content-Length", length)
+	}
+	cc.responseWriter.WriteHeader(cc.code)
+	cc.headersSent = true
+}
+
+// Hijack hijacks the connection.
+func (cc *codeCatcher) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := cc.responseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, fmt.Errorf("%T is not a http.Hijacker", cc.responseWriter)
+}
+
+// Flush sends the headers and the buffered data to the client, unless the code is caught for an error page.
+func (cc *codeCatcher) Flush() {
+	// If WriteHeader was already called from the caller, this is a NOOP.
+	// Otherwise, cc.code is actually a 200 here.
+	cc.WriteHeader(cc.code)
+
+	if cc.caughtFilteredCode {
+		return
+	}
+	if flusher, ok := cc.responseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// responseRecorder collects the error page served by the backend.
+type responseRecorder struct {
+	headerMap http.Header
+	body      *bytes.Buffer
+	code      int
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		headerMap: make(http.Header),
+		body:      new(bytes.Buffer),
+		code:      http.StatusOK,
+	}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.headerMap
+}
+
+func (r *responseRecorder) Write(buf []byte) (int, error) {
+	return r.body.Write(buf)
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	r.code = code
+}
+
+// Flush is a NOOP, the recorded page is written once the backend is done.
+func (r *responseRecorder) Flush() {}
@@ -0,0 +1,157 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/5
+
+package customerrors
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/crochee/proxy/config/dynamic"
+)
+
+// statusHandler answers with the status of the code query parameter.
+var statusHandler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+	var code int
+	_, _ = fmt.Sscan(req.URL.Query().Get("code"), &code)
+	rw.Header().Set("X-Origin", "next")
+	rw.WriteHeader(code)
+	_, _ = rw.Write([]byte("original"))
+})
+
+func TestCustomErrorsBackend(t *testing.T) {
+	var pageURI string
+	backend := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		pageURI = req.RequestURI
+		rw.Header().Set("Content-Type", "text/html")
+		_, _ = rw.Write([]byte("error page"))
+	})
+	handler, err := New(context.Background(), statusHandler, dynamic.ErrorPage{
+		Status: []string{"404", "500-599"},
+		Query:  "/{status}.html?from={url}",
+	}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		code     int
+		caught   bool
+		wantBody string
+	}{
+		{code: http.StatusOK, wantBody: "original"},
+		{code: http.StatusForbidden, wantBody: "original"},
+		{code: http.StatusNotFound, caught: true, wantBody: "error page"},
+		{code: http.StatusBadGateway, caught: true, wantBody: "error page"},
+		{code: 599, caught: true, wantBody: "error page"},
+	}
+	for _, tc := range testCases {
+		pageURI = ""
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com/a?code=%d", tc.code), nil))
+		if rw.Code != tc.code {
+			t.Errorf("%d: got the status %d", tc.code, rw.Code)
+		}
+		if body := rw.Body.String(); body != tc.wantBody {
+			t.Errorf("%d: got the body %q, want %q", tc.code, body, tc.wantBody)
+		}
+		if !tc.caught {
+			// the response passes through with its headers, the error backend is not queried.
+			if rw.Header().Get("X-Origin") != "next" || pageURI != "" {
+				t.Errorf("%d: the response is not passed through", tc.code)
+			}
+			continue
+		}
+		want := fmt.Sprintf("/%d.html?from=%s", tc.code, "http%3A%2F%2Fexample.com%2Fa%3Fcode%3D"+fmt.Sprint(tc.code))
+		if pageURI != want {
+			t.Errorf("%d: the error backend is queried with %s, want %s", tc.code, pageURI, want)
+		}
+		if ct := rw.Header().Get("Content-Type"); ct != "text/html" {
+			t.Errorf("%d: got the content type %q of the error page", tc.code, ct)
+		}
+	}
+}
+
+func TestCustomErrorsDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "error.html"),
+		[]byte("<p>{{.Status}} {{.StatusText}} {{.URL}}</p>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := New(context.Background(), statusHandler, dynamic.ErrorPage{
+		Status:    []string{"500-503"},
+		Directory: dir,
+		Query:     "/error.html",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/?code=503&a=<b>", nil))
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("got the status %d", rw.Code)
+	}
+	if want := "<p>503 Service Unavailable http://example.com/?code=503&amp;a=&lt;b&gt;</p>"; rw.Body.String() != want {
+		t.Errorf("got the body %q, want %q", rw.Body.String(), want)
+	}
+
+	// a status out of the range passes through.
+	rw = httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/?code=504", nil))
+	if rw.Code != http.StatusGatewayTimeout || rw.Body.String() != "original" {
+		t.Errorf("got %d %q, want the original response", rw.Code, rw.Body.String())
+	}
+}
+
+func TestCustomErrorsBackendFailure(t *testing.T) {
+	// the error backend has no page for the status.
+	backend := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		_, _ = rw.Write([]byte("no page"))
+	})
+	handler, err := New(context.Background(), statusHandler, dynamic.ErrorPage{
+		Status: []string{"500-599"},
+		Query:  "/error.html",
+	}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/?code=502", nil))
+	if rw.Code != http.StatusBadGateway || rw.Body.String() != "original" || rw.Header().Get("X-Origin") != "next" {
+		t.Errorf("got %d %q, want the original response", rw.Code, rw.Body.String())
+	}
+
+	// the page of the directory is served instead when there is one.
+	dir := t.TempDir()
+	if err = ioutil.WriteFile(filepath.Join(dir, "error.html"), []byte("<p>{{.Status}}</p>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if handler, err = New(context.Background(), statusHandler, dynamic.ErrorPage{
+		Status:    []string{"500-599"},
+		Directory: dir,
+		Query:     "/error.html",
+	}, backend); err != nil {
+		t.Fatal(err)
+	}
+	rw = httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/?code=502", nil))
+	if rw.Code != http.StatusBadGateway || rw.Body.String() != "<p>502</p>" {
+		t.Errorf("got %d %q, want the page of the directory", rw.Code, rw.Body.String())
+	}
+}
+
+func TestNewWithoutPage(t *testing.T) {
+	if _, err := New(context.Background(), statusHandler, dynamic.ErrorPage{Status: []string{"500"}}, nil); err == nil {
+		t.Error("expected an error without service nor directory")
+	}
+	if _, err := New(context.Background(), statusHandler, dynamic.ErrorPage{Status: []string{"5xx"}, Directory: "."}, nil); err == nil {
+		t.Error("expected an error for an invalid status range")
+	}
+}
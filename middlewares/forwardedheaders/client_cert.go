@@ -0,0 +1,121 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/25
+
+package forwardedheaders
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/crochee/proxy/config"
+)
+
+// setClientCertHeaders sets the client certificate headers from the verified chain of the connection.
+func setClientCertHeaders(req *http.Request, clientCert *config.TLSClientCert) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.PeerCertificates) == 0 {
+		return
+	}
+	certificates := req.TLS.PeerCertificates
+	if clientCert.PEM {
+		encoded := make([]string, 0, len(certificates))
+		for _, certificate := range certificates {
+			encoded = append(encoded, base64.StdEncoding.EncodeToString(certificate.Raw))
+		}
+		req.Header.Set(xForwardedTLSClientCert, url.QueryEscape(strings.Join(encoded, ",")))
+	}
+	if clientCert.Info != nil {
+		infos := make([]string, 0, len(certificates))
+		for _, certificate := range certificates {
+			if info := certificateInfo(certificate, clientCert.Info); info != "" {
+				infos = append(infos, info)
+			}
+		}
+		if len(infos) != 0 {
+			req.Header.Set(xForwardedTLSClientCertInfo, url.QueryEscape(strings.Join(infos, ",")))
+		}
+	}
+}
+
+// certificateInfo formats the selected fields of a certificate as
+// Subject="C=FR,CN=client";Issuer="CN=ca";SerialNumber="1";NotBefore="1600000000";NotAfter="1700000000";SANs="a,b".
+func certificateInfo(certificate *x509.Certificate, info *config.TLSClientCertInfo) string {
+	var fields []string
+	if info.Subject != nil {
+		if dn := distinguishedName(certificate.Subject, info.Subject); dn != "" {
+			fields = append(fields, fmt.Sprintf("Subject=%q", dn))
+		}
+	}
+	if info.Issuer != nil {
+		if dn := distinguishedName(certificate.Issuer, info.Issuer); dn != "" {
+			fields = append(fields, fmt.Sprintf("Issuer=%q", dn))
+		}
+	}
+	if info.SerialNumber && certificate.SerialNumber != nil {
+		fields = append(fields, fmt.Sprintf("SerialNumber=%q", certificate.SerialNumber.String()))
+	}
+	if info.NotBefore {
+		fields = append(fields, fmt.Sprintf("NotBefore=%q", strconv.FormatInt(certificate.NotBefore.Unix(), 10)))
+	}
+	if info.NotAfter {
+		fields = append(fields, fmt.Sprintf("NotAfter=%q", strconv.FormatInt(certificate.NotAfter.Unix(), 10)))
+	}
+	if info.Sans {
+		if sans := subjectAltNames(certificate); len(sans) != 0 {
+			fields = append(fields, fmt.Sprintf("SANs=%q", strings.Join(sans, ",")))
+		}
+	}
+	return strings.Join(fields, ";")
+}
+
+func distinguishedName(name pkix.Name, selected *config.TLSClientCertDistinguishedName) string {
+	var parts []string
+	add := func(enabled bool, key string, values ...string) {
+		if !enabled {
+			return
+		}
+		for _, value := range values {
+			if value != "" {
+				parts = append(parts, key+"="+value)
+			}
+		}
+	}
+	if selected.DomainComponent {
+		for _, attribute := range name.Names {
+			if attribute.Type.Equal(oidDomainComponent) {
+				add(true, "DC", fmt.Sprint(attribute.Value))
+			}
+		}
+	}
+	add(selected.Country, "C", name.Country...)
+	add(selected.Province, "ST", name.Province...)
+	add(selected.Locality, "L", name.Locality...)
+	add(selected.Organization, "O", name.Organization...)
+	add(selected.OrganizationalUnit, "OU", name.OrganizationalUnit...)
+	add(selected.CommonName, "CN", name.CommonName)
+	add(selected.SerialNumber, "SN", name.SerialNumber)
+	return strings.Join(parts, ",")
+}
+
+// oidDomainComponent is the object identifier of the domainComponent attribute.
+var oidDomainComponent = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}
+
+func subjectAltNames(certificate *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, certificate.DNSNames...)
+	sans = append(sans, certificate.EmailAddresses...)
+	for _, ip := range certificate.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range certificate.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
@@ -0,0 +1,75 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/25
+
+package forwardedheaders
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/config"
+)
+
+func TestClientCertHeaders(t *testing.T) {
+	certificate := &x509.Certificate{
+		Raw:          []byte("raw"),
+		SerialNumber: big.NewInt(42),
+		Subject: pkix.Name{
+			Country:      []string{"FR"},
+			Organization: []string{"Cheese"},
+			CommonName:   "client",
+		},
+		Issuer:    pkix.Name{CommonName: "ca"},
+		NotBefore: time.Unix(1600000000, 0),
+		NotAfter:  time.Unix(1700000000, 0),
+		DNSNames:  []string{"client.local"},
+	}
+	clientCert := &config.TLSClientCert{
+		PEM: true,
+		Info: &config.TLSClientCertInfo{
+			NotAfter: true,
+			Sans:     true,
+			Subject:  &config.TLSClientCertDistinguishedName{Country: true, CommonName: true},
+			Issuer:   &config.TLSClientCertDistinguishedName{CommonName: true},
+		},
+	}
+	var got http.Header
+	handler, err := NewXForwarded(true, nil, clientCert, "", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		got = req.Header.Clone()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://proxy.local/", nil)
+	req.Header.Set(xForwardedTLSClientCertInfo, "spoofed")
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{certificate},
+		VerifiedChains:   [][]*x509.Certificate{{certificate}},
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got.Get(xForwardedTLSClientCert) != "cmF3" {
+		t.Errorf("unexpected certificate header %q", got.Get(xForwardedTLSClientCert))
+	}
+	info, _ := url.QueryUnescape(got.Get(xForwardedTLSClientCertInfo))
+	if want := `Subject="C=FR,CN=client";Issuer="CN=ca";NotAfter="1700000000";SANs="client.local"`; info != want {
+		t.Errorf("info = %s, want %s", info, want)
+	}
+
+	// an unverified certificate is not forwarded and the spoofed headers are removed, even in insecure mode.
+	req = httptest.NewRequest(http.MethodGet, "https://proxy.local/", nil)
+	req.Header.Set(xForwardedTLSClientCertInfo, "spoofed")
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got.Get(xForwardedTLSClientCert) != "" || got.Get(xForwardedTLSClientCertInfo) != "" {
+		t.Errorf("unverified certificate forwarded: %v", got)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/4
+
+package forwardedheaders
+
+import (
+	"strings"
+)
+
+// forwarded is the header of RFC 7239.
+const forwarded = "Forwarded"
+
+// forwardedPair is a parameter of a forwarded element, its key is lowercase.
+type forwardedPair struct {
+	key   string
+	value string
+}
+
+// forwardedElement holds the parameters added by a proxy to the Forwarded header.
+type forwardedElement []forwardedPair
+
+// get returns the value of the parameter key, empty when it is missing.
+func (e forwardedElement) get(key string) string {
+	for _, pair := range e {
+		if pair.key == key {
+			return pair.value
+		}
+	}
+	return ""
+}
+
+// parseForwarded parses the elements of the Forwarded header values,
+// nil is returned for a malformed header which is then ignored.
+func parseForwarded(values []string) []forwardedElement {
+	var elements []forwardedElement
+	for _, value := range values {
+		p := &forwardedParser{s: value}
+		for {
+			element, ok := p.element()
+			if !ok {
+				return nil
+			}
+			if len(element) != 0 {
+				elements = append(elements, element)
+			}
+			p.skipSpaces()
+			if p.done() {
+				break
+			}
+			if p.s[p.i] != ',' {
+				return nil
+			}
+			p.i++
+		}
+	}
+	return elements
+}
+
+type forwardedParser struct {
+	s string
+	i int
+}
+
+func (p *forwardedParser) done() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *forwardedParser) skipSpaces() {
+	for !p.done() && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+// element parses the pairs separated by semicolons up to the next comma.
+func (p *forwardedParser) element() (forwardedElement, bool) {
+	var element forwardedElement
+	for {
+		p.skipSpaces()
+		if p.done() || p.s[p.i] == ',' {
+			return element, true
+		}
+		key := p.token()
+		if key == "" || p.done() || p.s[p.i] != '=' {
+			return nil, false
+		}
+		p.i++
+		var value string
+		if !p.done() && p.s[p.i] == '"' {
+			var ok bool
+			if value, ok = p.quoted(); !ok {
+				return nil, false
+			}
+		} else if value = p.token(); value == "" {
+			return nil, false
+		}
+		element = append(element, forwardedPair{key: strings.ToLower(key), value: value})
+		p.skipSpaces()
+		switch {
+		case p.done() || p.s[p.i] == ',':
+			return element, true
+		case p.s[p.i] == ';':
+			p.i++
+		default:
+			return nil, false
+		}
+	}
+}
+
+func (p *forwardedParser) token() string {
+	start := p.i
+	for !p.done() && isTokenChar(p.s[p.i]) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// quoted parses a quoted-string, its escaped characters are unescaped.
+func (p *forwardedParser) quoted() (string, bool) {
+	var b strings.Builder
+	for p.i++; !p.done(); p.i++ {
+		switch c := p.s[p.i]; c {
+		case '"':
+			p.i++
+			return b.String(), true
+		case '\\':
+			if p.i++; p.done() {
+				return "", false
+			}
+			b.WriteByte(p.s[p.i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", false
+}
+
+// isTokenChar reports whether c is a tchar of RFC 7230.
+func isTokenChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	default:
+		return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+	}
+}
+
+// formatForwarded formats the elements of a Forwarded header, the values which are not tokens are quoted.
+func formatForwarded(elements []forwardedElement) string {
+	var b strings.Builder
+	for i, element := range elements {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		for j, pair := range element {
+			if j > 0 {
+				b.WriteByte(';')
+			}
+			b.WriteString(pair.key)
+			b.WriteByte('=')
+			b.WriteString(quoteIfNeeded(pair.value))
+		}
+	}
+	return b.String()
+}
+
+func quoteIfNeeded(value string) string {
+	for i := 0; i < len(value); i++ {
+		if !isTokenChar(value[i]) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+		}
+	}
+	if value == "" {
+		return `""`
+	}
+	return value
+}
+
+// forwardedNode returns the node of an IP for the for and by parameters, the IPv6 addresses are bracketed.
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "[" + ip + "]"
+	}
+	return ip
+}
+
+// nodeIP returns the IP, or the identifier such as unknown, of a node without its brackets and port.
+func nodeIP(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if end := strings.IndexByte(node, ']'); end > 0 {
+			return node[1:end]
+		}
+		return node
+	}
+	if i := strings.IndexByte(node, ':'); i >= 0 {
+		return node[:i]
+	}
+	return node
+}
@@ -5,11 +5,13 @@
 package forwardedheaders
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"strings"
 
+	"github.com/crochee/proxy/config"
 	"github.com/crochee/proxy/util/ip"
 )
 
@@ -28,6 +30,15 @@ const (
 	upgrade                     = "Upgrade"
 )
 
+// xForwardedFamily holds the headers replaced by Forwarded.
+var xForwardedFamily = []string{
+	xForwardedProto,
+	xForwardedFor,
+	xForwardedHost,
+	xForwardedPort,
+	xForwardedServer,
+}
+
 var xHeaders = []string{
 	xForwardedProto,
 	xForwardedFor,
@@ -41,7 +52,7 @@ var xHeaders = []string{
 	xRealIP,
 }
 
-// XForwarded is an HTTP handler wrapper that sets the X-Forwarded headers,
+// XForwarded is an HTTP handler wrapper that sets the X-Forwarded headers or the Forwarded header of RFC 7239,
 // and other relevant headers for a reverse-proxy.
 // Unless insecure is set,
 // it first removes all the existing values for those headers if the remote address is not one of the trusted ones.
@@ -51,31 +62,48 @@ type XForwarded struct {
 	ipChecker  *ip.Checker
 	next       http.Handler
 	hostname   string
+	clientCert *config.TLSClientCert
+	// emitXForwarded and emitForwarded select the families of headers sent to the servers.
+	emitXForwarded bool
+	emitForwarded  bool
 }
 
-// NewXForwarded creates a new XForwarded.
-func NewXForwarded(insecure bool, trustedIps []string, next http.Handler) (*XForwarded, error) {
-	var ipChecker *ip.Checker
+// NewXForwarded creates a new XForwarded,
+// the verified client certificate is forwarded according to clientCert when it is not nil.
+// emit is one of the config.ForwardedHeaders families, the X-Forwarded headers when empty.
+func NewXForwarded(insecure bool, trustedIps []string, clientCert *config.TLSClientCert, emit string,
+	next http.Handler) (*XForwarded, error) {
+	x := &XForwarded{
+		insecure:   insecure,
+		trustedIps: trustedIps,
+		next:       next,
+		clientCert: clientCert,
+	}
+	switch emit {
+	case "", config.ForwardedHeadersXForwarded:
+		x.emitXForwarded = true
+	case config.ForwardedHeadersForwarded:
+		x.emitForwarded = true
+	case config.ForwardedHeadersBoth:
+		x.emitXForwarded = true
+		x.emitForwarded = true
+	default:
+		return nil, fmt.Errorf("unknown forwarded headers %s", emit)
+	}
+
 	if len(trustedIps) > 0 {
 		var err error
-		ipChecker, err = ip.NewChecker(trustedIps)
+		x.ipChecker, err = ip.NewChecker(trustedIps)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		hostname = "localhost"
+	var err error
+	if x.hostname, err = os.Hostname(); err != nil {
+		x.hostname = "localhost"
 	}
-
-	return &XForwarded{
-		insecure:   insecure,
-		trustedIps: trustedIps,
-		ipChecker:  ipChecker,
-		next:       next,
-		hostname:   hostname,
-	}, nil
+	return x, nil
 }
 
 func (x *XForwarded) isTrustedIP(ip string) bool {
@@ -105,7 +133,7 @@ func isWebsocketRequest(req *http.Request) bool {
 	return containsHeader(connection, "upgrade") && containsHeader(upgrade, "websocket")
 }
 
-func forwardedPort(req *http.Request) string {
+func forwardedPort(req *http.Request, proto string) string {
 	if req == nil {
 		return ""
 	}
@@ -114,7 +142,7 @@ func forwardedPort(req *http.Request) string {
 		return port
 	}
 
-	if req.Header.Get(xForwardedProto) == "https" || req.Header.Get(xForwardedProto) == "wss" {
+	if proto == "https" || proto == "wss" {
 		return "443"
 	}
 
@@ -126,37 +154,87 @@ func forwardedPort(req *http.Request) string {
 }
 
 func (x *XForwarded) rewrite(req *http.Request) {
-	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-		clientIP = removeIPv6Zone(clientIP)
+	var clientIP string
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		clientIP = removeIPv6Zone(host)
 
 		if req.Header.Get(xRealIP) == "" {
 			req.Header.Set(xRealIP, clientIP)
 		}
 	}
 
+	// the trusted hops of one family stand for those of the other when it is missing.
+	hops := parseForwarded(req.Header.Values(forwarded))
+	priorFor := splitForwardedFor(req.Header.Values(xForwardedFor))
+	if x.emitForwarded {
+		x.rewriteForwarded(req, clientIP, hops, priorFor)
+	} else {
+		req.Header.Del(forwarded)
+	}
+	if x.emitXForwarded {
+		x.rewriteXForwarded(req, clientIP, hops, priorFor)
+	} else {
+		for _, h := range xForwardedFamily {
+			req.Header.Del(h)
+		}
+	}
+}
+
+// rewriteXForwarded appends the client to X-Forwarded-For and sets the other X-Forwarded headers
+// when the trusted proxies have not.
+func (x *XForwarded) rewriteXForwarded(req *http.Request, clientIP string, hops []forwardedElement, priorFor []string) {
+	if len(priorFor) == 0 {
+		for _, hop := range hops {
+			if node := hop.get("for"); node != "" {
+				priorFor = append(priorFor, nodeIP(node))
+			}
+		}
+	}
+	if clientIP != "" {
+		priorFor = append(priorFor, clientIP)
+	}
+	if len(priorFor) != 0 {
+		req.Header.Set(xForwardedFor, strings.Join(priorFor, ", "))
+	}
+
+	var first forwardedElement
+	if len(hops) != 0 {
+		first = hops[0]
+	}
 	xfProto := req.Header.Get(xForwardedProto)
+	if xfProto == "" {
+		xfProto = first.get("proto")
+	}
 	if xfProto == "" {
 		if isWebsocketRequest(req) {
 			if req.TLS != nil {
-				req.Header.Set(xForwardedProto, "wss")
+				xfProto = "wss"
 			} else {
-				req.Header.Set(xForwardedProto, "ws")
+				xfProto = "ws"
 			}
 		} else {
 			if req.TLS != nil {
-				req.Header.Set(xForwardedProto, "https")
+				xfProto = "https"
 			} else {
-				req.Header.Set(xForwardedProto, "http")
+				xfProto = "http"
 			}
 		}
 	}
+	req.Header.Set(xForwardedProto, xfProto)
 
 	if xfPort := req.Header.Get(xForwardedPort); xfPort == "" {
-		req.Header.Set(xForwardedPort, forwardedPort(req))
+		req.Header.Set(xForwardedPort, forwardedPort(req, xfProto))
 	}
 
-	if xfHost := req.Header.Get(xForwardedHost); xfHost == "" && req.Host != "" {
-		req.Header.Set(xForwardedHost, req.Host)
+	xfHost := req.Header.Get(xForwardedHost)
+	if xfHost == "" {
+		xfHost = first.get("host")
+	}
+	if xfHost == "" {
+		xfHost = req.Host
+	}
+	if xfHost != "" {
+		req.Header.Set(xForwardedHost, xfHost)
 	}
 
 	if x.hostname != "" {
@@ -164,15 +242,62 @@ func (x *XForwarded) rewrite(req *http.Request) {
 	}
 }
 
+// rewriteForwarded appends to the Forwarded header the element of the client connection.
+func (x *XForwarded) rewriteForwarded(req *http.Request, clientIP string, hops []forwardedElement, priorFor []string) {
+	if len(hops) == 0 {
+		for _, node := range priorFor {
+			hops = append(hops, forwardedElement{{key: "for", value: forwardedNode(node)}})
+		}
+	}
+	hop := forwardedElement{{key: "for", value: "unknown"}}
+	if clientIP != "" {
+		hop[0].value = forwardedNode(clientIP)
+	}
+	if local, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if host, _, err := net.SplitHostPort(local.String()); err == nil {
+			hop = append(hop, forwardedPair{key: "by", value: forwardedNode(removeIPv6Zone(host))})
+		}
+	}
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	hop = append(hop, forwardedPair{key: "proto", value: proto})
+	if req.Host != "" {
+		hop = append(hop, forwardedPair{key: "host", value: req.Host})
+	}
+	req.Header.Set(forwarded, formatForwarded(append(hops, hop)))
+}
+
+// splitForwardedFor returns the addresses of the X-Forwarded-For values.
+func splitForwardedFor(values []string) []string {
+	var addresses []string
+	for _, value := range values {
+		for _, address := range strings.Split(value, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses
+}
+
 // ServeHTTP implements http.Handler.
 func (x *XForwarded) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !x.insecure && !x.isTrustedIP(r.RemoteAddr) {
 		for _, h := range xHeaders {
 			r.Header.Del(h)
 		}
+		r.Header.Del(forwarded)
 	}
 
 	x.rewrite(r)
+	if x.clientCert != nil {
+		// the client certificate headers are never trusted, they only come from the TLS connection.
+		r.Header.Del(xForwardedTLSClientCert)
+		r.Header.Del(xForwardedTLSClientCertInfo)
+		setClientCertHeaders(r, x.clientCert)
+	}
 
 	x.next.ServeHTTP(w, r)
 }
@@ -0,0 +1,129 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/4
+
+package forwardedheaders
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/crochee/proxy/config"
+)
+
+func TestParseForwarded(t *testing.T) {
+	elements := parseForwarded([]string{
+		`for=192.0.2.60;proto=http;by=203.0.113.43`,
+		`For="[2001:db8:cafe::17]:4711", for=unknown;host="example.com:8443"`,
+	})
+	if len(elements) != 3 {
+		t.Fatalf("got %d elements, want 3", len(elements))
+	}
+	for i, want := range []struct{ ip, proto, host string }{
+		{ip: "192.0.2.60", proto: "http"},
+		{ip: "2001:db8:cafe::17"},
+		{ip: "unknown", host: "example.com:8443"},
+	} {
+		if got := nodeIP(elements[i].get("for")); got != want.ip {
+			t.Errorf("element %d: got for %s, want %s", i, got, want.ip)
+		}
+		if got := elements[i].get("proto"); got != want.proto {
+			t.Errorf("element %d: got proto %s, want %s", i, got, want.proto)
+		}
+		if got := elements[i].get("host"); got != want.host {
+			t.Errorf("element %d: got host %s, want %s", i, got, want.host)
+		}
+	}
+	if got := formatForwarded(elements); got != `for=192.0.2.60;proto=http;by=203.0.113.43, `+
+		`for="[2001:db8:cafe::17]:4711", for=unknown;host="example.com:8443"` {
+		t.Errorf("formatted as %s", got)
+	}
+
+	for _, value := range []string{`for=`, `for="192.0.2.60`, `for=192.0.2.60 proto=http`, `=192.0.2.60`} {
+		if elements = parseForwarded([]string{value}); elements != nil {
+			t.Errorf("%s: got %v, want a malformed header", value, elements)
+		}
+	}
+}
+
+func TestXForwardedEmit(t *testing.T) {
+	testCases := []struct {
+		name       string
+		emit       string
+		remoteAddr string
+		header     http.Header
+		want       http.Header
+	}{
+		{
+			name:       "untrusted",
+			remoteAddr: "192.168.1.1:51234",
+			header:     http.Header{xForwardedFor: {"192.0.2.1"}, forwarded: {"for=192.0.2.1"}},
+			want:       http.Header{xForwardedFor: {"192.168.1.1"}, forwarded: nil},
+		},
+		{
+			name:       "trusted",
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{xForwardedFor: {"192.0.2.1, 192.0.2.2", "192.0.2.3"}},
+			want:       http.Header{xForwardedFor: {"192.0.2.1, 192.0.2.2, 192.0.2.3, 10.0.0.1"}},
+		},
+		{
+			name:       "trusted forwarded",
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{forwarded: {`for="[2001:db8::1]:4711";proto=https;host=example.com`}},
+			want: http.Header{
+				xForwardedFor:   {"2001:db8::1, 10.0.0.1"},
+				xForwardedProto: {"https"},
+				xForwardedHost:  {"example.com"},
+				forwarded:       nil,
+			},
+		},
+		{
+			name:       "forwarded",
+			emit:       config.ForwardedHeadersForwarded,
+			remoteAddr: "[2001:db8::2]:51234",
+			header:     http.Header{xForwardedFor: {"192.0.2.1"}},
+			want: http.Header{
+				forwarded:       {`for=192.0.2.1, for="[2001:db8::2]";by="[::1]";proto=http;host=example.org`},
+				xForwardedFor:   nil,
+				xForwardedProto: nil,
+				xRealIP:         {"2001:db8::2"},
+			},
+		},
+		{
+			name:       "both",
+			emit:       config.ForwardedHeadersBoth,
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{forwarded: {"for=192.0.2.1;proto=http"}},
+			want: http.Header{
+				forwarded:     {`for=192.0.2.1;proto=http, for=10.0.0.1;by="[::1]";proto=http;host=example.org`},
+				xForwardedFor: {"192.0.2.1, 10.0.0.1"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		var got http.Header
+		handler, err := NewXForwarded(false, []string{"10.0.0.0/8", "2001:db8::/32"}, nil, tc.emit,
+			http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+				got = req.Header
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "http://example.org/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		req.Header = tc.header
+		req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey,
+			&net.TCPAddr{IP: net.IPv6loopback, Port: 80}))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		// a nil value expects the header to be missing.
+		for key, values := range tc.want {
+			if !reflect.DeepEqual(got.Values(key), values) {
+				t.Errorf("%s: got %s %q, want %q", tc.name, key, got.Values(key), values)
+			}
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/31
+
+// Package grpcweb translates the gRPC-Web calls of the browsers to gRPC calls.
+package grpcweb
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/crochee/proxy/config/dynamic"
+)
+
+const (
+	grpcContentType    = "application/grpc"
+	grpcWebContentType = "application/grpc-web"
+	grpcWebTextSuffix  = "-text"
+	// trailerFrameFlag marks the frame carrying the trailers at the end of a gRPC-Web response body.
+	trailerFrameFlag = 0x80
+)
+
+// grpcWeb is a middleware translating the gRPC-Web requests, in the binary and the base64 text modes,
+// to gRPC requests and their responses back to gRPC-Web, the trailers in a trailer frame of the body.
+type grpcWeb struct {
+	next         http.Handler
+	allowOrigins map[string]struct{}
+	allowAll     bool
+}
+
+// New creates a new gRPC-Web middleware,
+// the CORS requests are allowed from the origins of config, all of them for "*".
+func New(_ context.Context, next http.Handler, config dynamic.GRPCWeb) (http.Handler, error) {
+	g := &grpcWeb{
+		next:         next,
+		allowOrigins: make(map[string]struct{}, len(config.AllowOrigins)),
+	}
+	for _, origin := range config.AllowOrigins {
+		if origin == "*" {
+			g.allowAll = true
+		}
+		g.allowOrigins[strings.ToLower(origin)] = struct{}{}
+	}
+	return g, nil
+}
+
+func (g *grpcWeb) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if isPreflight(req) {
+		g.preflight(rw, req)
+		return
+	}
+	contentType := req.Header.Get("Content-Type")
+	if req.Method != http.MethodPost || !strings.HasPrefix(contentType, grpcWebContentType) {
+		g.next.ServeHTTP(rw, req)
+		return
+	}
+	subtype := contentType[len(grpcWebContentType):]
+	text := strings.HasPrefix(subtype, grpcWebTextSuffix)
+	if text {
+		subtype = subtype[len(grpcWebTextSuffix):]
+	}
+
+	req.Header.Set("Content-Type", grpcContentType+subtype)
+	// the gRPC servers require the clients to accept the trailers.
+	req.Header.Set("Te", "trailers")
+	req.Header.Del("Content-Length")
+	if text {
+		req.Body = &textDecoder{body: req.Body, r: bufio.NewReader(req.Body)}
+		req.ContentLength = -1
+	}
+
+	if origin := req.Header.Get("Origin"); origin != "" && g.allowed(origin) {
+		header := rw.Header()
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Expose-Headers", "grpc-status, grpc-message")
+		header.Add("Vary", "Origin")
+	}
+	w := &responseWriter{rw: rw, text: text}
+	g.next.ServeHTTP(w, req)
+	w.finish()
+}
+
+// isPreflight reports whether the request is the CORS preflight of a gRPC-Web call.
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions && req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != "" &&
+		httpguts.HeaderValuesContainsToken(req.Header["Access-Control-Request-Headers"], "x-grpc-web")
+}
+
+func (g *grpcWeb) preflight(rw http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	if !g.allowed(origin) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+	header := rw.Header()
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	header.Set("Access-Control-Allow-Headers", strings.Join(req.Header["Access-Control-Request-Headers"], ", "))
+	header.Set("Access-Control-Max-Age", "600")
+	header.Add("Vary", "Origin")
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (g *grpcWeb) allowed(origin string) bool {
+	if g.allowAll {
+		return true
+	}
+	_, ok := g.allowOrigins[strings.ToLower(origin)]
+	return ok
+}
+
+// responseWriter writes the gRPC response as a gRPC-Web one.
+type responseWriter struct {
+	rw   http.ResponseWriter
+	text bool
+	// trailer holds the headers written after WriteHeader, the trailers among them are sent in the trailer frame.
+	trailer     http.Header
+	announced   []string
+	wroteHeader bool
+	// pending holds the bytes of the text mode not yet encoded, less than a base64 quantum.
+	pending []byte
+}
+
+func (w *responseWriter) Header() http.Header {
+	if w.wroteHeader {
+		return w.trailer
+	}
+	return w.rw.Header()
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	header := w.rw.Header()
+	for _, value := range header["Trailer"] {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				w.announced = append(w.announced, http.CanonicalHeaderKey(key))
+			}
+		}
+	}
+	header.Del("Trailer")
+	if contentType := header.Get("Content-Type"); strings.HasPrefix(contentType, grpcContentType) {
+		subtype := contentType[len(grpcContentType):]
+		if w.text {
+			subtype = grpcWebTextSuffix + subtype
+		}
+		header.Set("Content-Type", grpcWebContentType+subtype)
+	}
+	header.Del("Content-Length")
+	w.trailer = make(http.Header)
+	w.rw.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.text {
+		return w.rw.Write(p)
+	}
+	data := append(w.pending, p...)
+	full := len(data) / 3 * 3
+	if full != 0 {
+		if _, err := w.rw.Write([]byte(base64.StdEncoding.EncodeToString(data[:full]))); err != nil {
+			return 0, err
+		}
+	}
+	w.pending = append([]byte(nil), data[full:]...)
+	return len(p), nil
+}
+
+// Flush sends the bytes written so far, those of the text mode padded to a whole base64 quantum.
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.flushText()
+	if flusher, ok := w.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseWriter) flushText() {
+	if len(w.pending) == 0 {
+		return
+	}
+	_, _ = w.rw.Write([]byte(base64.StdEncoding.EncodeToString(w.pending)))
+	w.pending = nil
+}
+
+// finish ends the body with the trailer frame.
+func (w *responseWriter) finish() {
+	if !w.wroteHeader {
+		return
+	}
+	trailer := make(http.Header)
+	for _, key := range w.announced {
+		if values, ok := w.trailer[key]; ok {
+			trailer[key] = values
+		}
+	}
+	for key, values := range w.trailer {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			trailer[http.CanonicalHeaderKey(key[len(http.TrailerPrefix):])] = values
+		}
+	}
+	if len(trailer) == 0 {
+		w.flushText()
+		return
+	}
+	keys := make([]string, 0, len(trailer))
+	for key := range trailer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var block strings.Builder
+	for _, key := range keys {
+		for _, value := range trailer[key] {
+			block.WriteString(strings.ToLower(key) + ": " + value + "\r\n")
+		}
+	}
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = trailerFrameFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	frame = append(frame, block.String()...)
+	if w.text {
+		// the trailer frame is encoded on its own, after the padded messages.
+		w.flushText()
+		_, _ = w.rw.Write([]byte(base64.StdEncoding.EncodeToString(frame)))
+	} else {
+		_, _ = w.rw.Write(frame)
+	}
+	if flusher, ok := w.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// textDecoder decodes a base64 request body, made of padded chunks that may be concatenated.
+type textDecoder struct {
+	body    io.Closer
+	r       *bufio.Reader
+	quantum [4]byte
+	out     [3]byte
+	decoded []byte
+	err     error
+}
+
+func (t *textDecoder) Read(p []byte) (int, error) {
+	for len(t.decoded) == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		n, err := io.ReadFull(t.r, t.quantum[:])
+		switch {
+		case n == 0 && err == io.EOF:
+			t.err = io.EOF
+			continue
+		case err == io.ErrUnexpectedEOF:
+			t.err = base64.CorruptInputError(n)
+			continue
+		case err != nil:
+			t.err = err
+			continue
+		}
+		var m int
+		if m, err = base64.StdEncoding.Decode(t.out[:], t.quantum[:]); err != nil {
+			t.err = err
+			continue
+		}
+		t.decoded = t.out[:m]
+	}
+	n := copy(p, t.decoded)
+	t.decoded = t.decoded[n:]
+	return n, nil
+}
+
+func (t *textDecoder) Close() error {
+	return t.body.Close()
+}
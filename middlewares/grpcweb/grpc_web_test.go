@@ -0,0 +1,124 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/31
+
+package grpcweb
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/crochee/proxy/config/dynamic"
+)
+
+func frame(flag byte, payload string) []byte {
+	f := make([]byte, 5+len(payload))
+	f[0] = flag
+	binary.BigEndian.PutUint32(f[1:5], uint32(len(payload)))
+	copy(f[5:], payload)
+	return f
+}
+
+func TestGRPCWeb(t *testing.T) {
+	// next answers like the reverse proxy forwarding to a gRPC server:
+	// the announced trailers are set after the body, the others with http.TrailerPrefix.
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Content-Type") != "application/grpc+proto" || req.Header.Get("Te") != "trailers" {
+			t.Errorf("unexpected gRPC request headers %v", req.Header)
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		rw.Header().Set("Content-Type", "application/grpc+proto")
+		rw.Header().Set("Trailer", "Grpc-Status")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write(body)
+		rw.(http.Flusher).Flush()
+		rw.Header().Set("Grpc-Status", "0")
+		rw.Header().Set(http.TrailerPrefix+"Grpc-Message", "OK")
+	})
+	handler, err := New(context.Background(), next, dynamic.GRPCWeb{AllowOrigins: []string{"https://app.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := frame(0, "hello")
+	trailer := frame(trailerFrameFlag, "grpc-message: OK\r\ngrpc-status: 0\r\n")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		want        []byte
+	}{
+		{
+			name:        "binary",
+			contentType: "application/grpc-web+proto",
+			body:        message,
+			want:        append(append([]byte{}, message...), trailer...),
+		},
+		{
+			name:        "text",
+			contentType: "application/grpc-web-text+proto",
+			// the client may send concatenated padded chunks.
+			body: []byte(base64.StdEncoding.EncodeToString(message[:4]) + base64.StdEncoding.EncodeToString(message[4:])),
+			want: []byte(base64.StdEncoding.EncodeToString(message) + base64.StdEncoding.EncodeToString(trailer)),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/echo.Echo/Unary", bytes.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			req.Header.Set("Origin", "https://app.example.com")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if got := recorder.Header().Get("Content-Type"); got != test.contentType {
+				t.Errorf("got the content type %s, want %s", got, test.contentType)
+			}
+			if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+				t.Errorf("got Access-Control-Allow-Origin %q", got)
+			}
+			if _, ok := recorder.Header()["Trailer"]; ok {
+				t.Error("the trailers are announced as HTTP trailers")
+			}
+			if !bytes.Equal(recorder.Body.Bytes(), test.want) {
+				t.Errorf("got the body %q, want %q", recorder.Body.Bytes(), test.want)
+			}
+		})
+	}
+}
+
+func TestGRPCWebPreflight(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Errorf("the preflight %s %s reached the service", req.Method, req.URL)
+	})
+	handler, err := New(context.Background(), next, dynamic.GRPCWeb{AllowOrigins: []string{"https://app.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for origin, want := range map[string]int{
+		"https://app.example.com":  http.StatusNoContent,
+		"https://evil.example.com": http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodOptions, "/echo.Echo/Unary", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != want {
+			t.Errorf("%s: got the status %d, want %d", origin, recorder.Code, want)
+		}
+		if want == http.StatusNoContent &&
+			recorder.Header().Get("Access-Control-Allow-Headers") != "content-type,x-grpc-web,x-user-agent" {
+			t.Errorf("%s: unexpected CORS headers %v", origin, recorder.Header())
+		}
+	}
+}
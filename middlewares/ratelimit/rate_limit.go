@@ -16,21 +16,27 @@ import (
 
 	"github.com/crochee/proxy/config/dynamic"
 	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/metrics"
 	"github.com/crochee/proxy/util"
 )
 
+// Route returns the router and the service a request is sent to, the labels of its rejection.
+type Route func(req *http.Request) (router, service string)
+
 type rateLimiter struct {
 	limiter  *rate.Limiter // reqs/s
 	next     http.Handler
+	route    Route
 	maxDelay time.Duration
 	ctx      context.Context
 }
 
-// New returns a rate limiter middleware.
-func New(ctx context.Context, next http.Handler, limit dynamic.RateLimit) (http.Handler, error) {
+// New returns a rate limiter middleware, route may be nil when the requests are not attributed.
+func New(ctx context.Context, next http.Handler, limit dynamic.RateLimit, route Route) (http.Handler, error) {
 	rateLimiter := &rateLimiter{
-		next: next,
-		ctx:  ctx,
+		next:  next,
+		route: route,
+		ctx:   ctx,
 	}
 	every := rate.Every(limit.Every)
 	if every < 1 {
@@ -45,6 +51,7 @@ func New(ctx context.Context, next http.Handler, limit dynamic.RateLimit) (http.
 func (rl *rateLimiter) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	res := rl.limiter.Reserve()
 	if !res.OK() {
+		rl.rejected(req, "burst")
 		http.Error(rw, "No bursty traffic allowed", http.StatusTooManyRequests)
 		return
 	}
@@ -52,6 +59,7 @@ func (rl *rateLimiter) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	delay := res.Delay()
 	if delay > rl.maxDelay {
 		res.Cancel()
+		rl.rejected(req, "delay")
 		rl.serveDelayError(rw, delay)
 		return
 	}
@@ -60,6 +68,14 @@ func (rl *rateLimiter) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	rl.next.ServeHTTP(rw, req)
 }
 
+func (rl *rateLimiter) rejected(req *http.Request, reason string) {
+	var router, service string
+	if rl.route != nil {
+		router, service = rl.route(req)
+	}
+	metrics.RateLimitRejected(router, service, reason)
+}
+
 func (rl *rateLimiter) serveDelayError(w http.ResponseWriter, delay time.Duration) {
 	w.Header().Set("Retry-After", fmt.Sprintf("%.0f", delay.Seconds()))
 	w.Header().Set("X-Retry-In", delay.String())
@@ -0,0 +1,84 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/19
+
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/crochee/proxy/util"
+)
+
+// crockford is the base32 alphabet of ULID.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewUUID generates a random (version 4) UUID.
+func NewUUID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // variant RFC 4122
+
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return util.String(buf), nil
+}
+
+// NewULID generates a ULID, 48 bits of milliseconds timestamp followed by 80 random bits,
+// encoded as 26 characters of Crockford's base32 so that ids sort by time.
+func NewULID() (string, error) {
+	var u [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	if _, err := rand.Read(u[6:]); err != nil {
+		return "", err
+	}
+
+	// 128 bits are encoded from the most significant bit, the first character holds only 3 bits.
+	buf := make([]byte, 26)
+	buf[0] = crockford[(u[0]&224)>>5]
+	buf[1] = crockford[u[0]&31]
+	buf[2] = crockford[(u[1]&248)>>3]
+	buf[3] = crockford[((u[1]&7)<<2)|((u[2]&192)>>6)]
+	buf[4] = crockford[(u[2]&62)>>1]
+	buf[5] = crockford[((u[2]&1)<<4)|((u[3]&240)>>4)]
+	buf[6] = crockford[((u[3]&15)<<1)|((u[4]&128)>>7)]
+	buf[7] = crockford[(u[4]&124)>>2]
+	buf[8] = crockford[((u[4]&3)<<3)|((u[5]&224)>>5)]
+	buf[9] = crockford[u[5]&31]
+	buf[10] = crockford[(u[6]&248)>>3]
+	buf[11] = crockford[((u[6]&7)<<2)|((u[7]&192)>>6)]
+	buf[12] = crockford[(u[7]&62)>>1]
+	buf[13] = crockford[((u[7]&1)<<4)|((u[8]&240)>>4)]
+	buf[14] = crockford[((u[8]&15)<<1)|((u[9]&128)>>7)]
+	buf[15] = crockford[(u[9]&124)>>2]
+	buf[16] = crockford[((u[9]&3)<<3)|((u[10]&224)>>5)]
+	buf[17] = crockford[u[10]&31]
+	buf[18] = crockford[(u[11]&248)>>3]
+	buf[19] = crockford[((u[11]&7)<<2)|((u[12]&192)>>6)]
+	buf[20] = crockford[(u[12]&62)>>1]
+	buf[21] = crockford[((u[12]&1)<<4)|((u[13]&240)>>4)]
+	buf[22] = crockford[((u[13]&15)<<1)|((u[14]&128)>>7)]
+	buf[23] = crockford[(u[14]&124)>>2]
+	buf[24] = crockford[((u[14]&3)<<3)|((u[15]&224)>>5)]
+	buf[25] = crockford[u[15]&31]
+	return util.String(buf), nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/19
+
+package requestid
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/crochee/proxy/config/dynamic"
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/util/ip"
+)
+
+// DefaultHeader is the header carrying the request id.
+const DefaultHeader = "X-Request-Id"
+
+// maxLength is the longest inbound request id that will be reused.
+const maxLength = 128
+
+type requestIDKey struct{}
+
+// WithContext returns a new context carrying the request id.
+func WithContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// FromContext gets the request id from context.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestID is a middleware that makes sure every request carries a request id.
+type requestID struct {
+	next      http.Handler
+	header    string
+	insecure  bool
+	ipChecker *ip.Checker
+	generate  func() (string, error)
+	ctx       context.Context
+}
+
+// New creates a new request id middleware.
+// The inbound id is reused only when insecure is set or the remote address is one of the trusted IPs.
+func New(ctx context.Context, next http.Handler, config dynamic.RequestID) (http.Handler, error) {
+	r := &requestID{
+		next:     next,
+		header:   config.Header,
+		insecure: config.Insecure,
+		ctx:      ctx,
+	}
+	if r.header == "" {
+		r.header = DefaultHeader
+	}
+	switch config.Generator {
+	case "", "uuid":
+		r.generate = NewUUID
+	case "ulid":
+		r.generate = NewULID
+	default:
+		return nil, fmt.Errorf("unknown request id generator %s", config.Generator)
+	}
+	if len(config.TrustedIPs) > 0 {
+		var err error
+		if r.ipChecker, err = ip.NewChecker(config.TrustedIPs); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *requestID) isTrusted(remoteAddr string) bool {
+	if r.insecure {
+		return true
+	}
+	if r.ipChecker == nil {
+		return false
+	}
+	return r.ipChecker.IsAuthorized(remoteAddr) == nil
+}
+
+func (r *requestID) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	id := req.Header.Get(r.header)
+	if id == "" || len(id) > maxLength || !r.isTrusted(req.RemoteAddr) {
+		var err error
+		if id, err = r.generate(); err != nil {
+			logger.FromContext(r.ctx).Errorf("could not generate request id: %v", err)
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	req.Header.Set(r.header, id)
+	rw.Header().Set(r.header, id)
+
+	ctx := req.Context()
+	log := logger.FromContext(ctx)
+	if log == nil {
+		log = logger.FromContext(r.ctx)
+	}
+	ctx = logger.NewContext(WithContext(ctx, id), log.WithFields(zap.String("request_id", id)))
+
+	r.next.ServeHTTP(rw, req.WithContext(ctx))
+}
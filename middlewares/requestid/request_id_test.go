@@ -0,0 +1,142 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/5
+
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/config/dynamic"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulidPattern = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+)
+
+func TestNewUUID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := NewUUID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !uuidPattern.MatchString(id) {
+			t.Fatalf("%s is not a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("%s generated twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	first, err := NewULID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	second, err := NewULID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{first, second} {
+		if !ulidPattern.MatchString(id) {
+			t.Fatalf("%s is not a ULID", id)
+		}
+	}
+	// the ids of different milliseconds sort by time.
+	if first >= second {
+		t.Errorf("%s does not sort before %s", first, second)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	testCases := []struct {
+		name       string
+		config     dynamic.RequestID
+		remoteAddr string
+		inbound    string
+		reused     bool
+		pattern    *regexp.Regexp
+	}{
+		{name: "generated", remoteAddr: "10.0.0.1:1234", pattern: uuidPattern},
+		{name: "ulid", config: dynamic.RequestID{Generator: "ulid"}, remoteAddr: "10.0.0.1:1234", pattern: ulidPattern},
+		{
+			name:       "trusted",
+			config:     dynamic.RequestID{TrustedIPs: []string{"10.0.0.0/8"}},
+			remoteAddr: "10.0.0.1:1234",
+			inbound:    "abc",
+			reused:     true,
+		},
+		{
+			name:       "untrusted",
+			config:     dynamic.RequestID{TrustedIPs: []string{"10.0.0.0/8"}},
+			remoteAddr: "192.168.0.1:1234",
+			inbound:    "abc",
+			pattern:    uuidPattern,
+		},
+		{name: "insecure", config: dynamic.RequestID{Insecure: true}, remoteAddr: "192.168.0.1:1234", inbound: "abc", reused: true},
+		{
+			name:       "too long",
+			config:     dynamic.RequestID{Insecure: true},
+			remoteAddr: "10.0.0.1:1234",
+			inbound:    strings.Repeat("a", maxLength+1),
+			pattern:    uuidPattern,
+		},
+		{
+			name:       "custom header",
+			config:     dynamic.RequestID{Header: "X-Correlation-Id", Insecure: true},
+			remoteAddr: "10.0.0.1:1234",
+			inbound:    "abc",
+			reused:     true,
+		},
+	}
+	for _, tc := range testCases {
+		header := tc.config.Header
+		if header == "" {
+			header = DefaultHeader
+		}
+		var upstream, fromContext string
+		handler, err := New(context.Background(), http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			upstream = req.Header.Get(header)
+			fromContext = FromContext(req.Context())
+		}), tc.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.inbound != "" {
+			req.Header.Set(header, tc.inbound)
+		}
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		id := rw.Header().Get(header)
+		if tc.reused && id != tc.inbound {
+			t.Errorf("%s: got %q, want the inbound id %q", tc.name, id, tc.inbound)
+		}
+		if !tc.reused && (id == tc.inbound || !tc.pattern.MatchString(id)) {
+			t.Errorf("%s: got %q, want a generated id", tc.name, id)
+		}
+		// the same id goes upstream, in the context and back on the response.
+		if upstream != id || fromContext != id {
+			t.Errorf("%s: the upstream %q and context %q ids differ from the response %q", tc.name, upstream, fromContext, id)
+		}
+	}
+}
+
+func TestNewUnknownGenerator(t *testing.T) {
+	if _, err := New(context.Background(), http.NotFoundHandler(), dynamic.RequestID{Generator: "snowflake"}); err == nil {
+		t.Error("expected an error for an unknown generator")
+	}
+}
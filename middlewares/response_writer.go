@@ -0,0 +1,75 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/20
+
+package middlewares
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter is a wrapper of type http.ResponseWriter
+// that tracks the status and the size of the response.
+type ResponseWriter struct {
+	rw     http.ResponseWriter
+	status int
+	size   int64
+}
+
+// NewResponseWriter wraps rw.
+func NewResponseWriter(rw http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{rw: rw}
+}
+
+func (w *ResponseWriter) Header() http.Header {
+	return w.rw.Header()
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	size, err := w.rw.Write(b)
+	w.size += int64(size)
+	return size, err
+}
+
+func (w *ResponseWriter) WriteHeader(s int) {
+	w.rw.WriteHeader(s)
+	// the informational responses precede the final one, except 101 which switches the protocol.
+	if w.status == 0 && (s >= http.StatusOK || s == http.StatusSwitchingProtocols) {
+		w.status = s
+	}
+}
+
+// Flush sends any buffered data to the client.
+func (w *ResponseWriter) Flush() {
+	if f, ok := w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the connection.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.rw.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("%T is not a http.Hijacker", w.rw)
+}
+
+// Status returns the status code written to the client,
+// net/http sends 200 when the handler returns without writing any.
+func (w *ResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Size returns the number of bytes written to the client.
+func (w *ResponseWriter) Size() int64 {
+	return w.size
+}
@@ -0,0 +1,54 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/20
+
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseWriterStatus(t *testing.T) {
+	testCases := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    int
+	}{
+		{
+			name:    "nothing written",
+			handler: func(http.ResponseWriter, *http.Request) {},
+			want:    http.StatusOK,
+		},
+		{
+			name: "flushed",
+			handler: func(rw http.ResponseWriter, _ *http.Request) {
+				rw.(http.Flusher).Flush()
+			},
+			want: http.StatusOK,
+		},
+		{
+			name: "informational",
+			handler: func(rw http.ResponseWriter, _ *http.Request) {
+				rw.WriteHeader(http.StatusEarlyHints)
+				rw.WriteHeader(http.StatusNotFound)
+			},
+			want: http.StatusNotFound,
+		},
+		{
+			name: "switching protocols",
+			handler: func(rw http.ResponseWriter, _ *http.Request) {
+				rw.WriteHeader(http.StatusSwitchingProtocols)
+			},
+			want: http.StatusSwitchingProtocols,
+		},
+	}
+	for _, tc := range testCases {
+		w := NewResponseWriter(httptest.NewRecorder())
+		tc.handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if status := w.Status(); status != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, status, tc.want)
+		}
+	}
+}
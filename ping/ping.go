@@ -0,0 +1,54 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/24
+
+package ping
+
+import (
+	"net/http"
+)
+
+const (
+	// LivenessPath is the path of the liveness endpoint.
+	LivenessPath = "/ping"
+	// ReadinessPath is the path of the readiness endpoint.
+	ReadinessPath = "/ready"
+)
+
+// Handler serves the liveness and readiness endpoints of the proxy.
+type Handler struct {
+	ready func() bool
+}
+
+// New creates a Handler, ready reports whether the proxy accepts requests.
+func New(ready func() bool) *Handler {
+	return &Handler{ready: ready}
+}
+
+// Ping answers as long as the process is able to serve requests.
+func (h *Handler) Ping(rw http.ResponseWriter, req *http.Request) {
+	writeStatus(rw, req, http.StatusOK)
+}
+
+// Ready answers 503 during the startup, the shutdown grace timeout or when no entry point is serving.
+func (h *Handler) Ready(rw http.ResponseWriter, req *http.Request) {
+	if h.ready == nil || !h.ready() {
+		writeStatus(rw, req, http.StatusServiceUnavailable)
+		return
+	}
+	writeStatus(rw, req, http.StatusOK)
+}
+
+func writeStatus(rw http.ResponseWriter, req *http.Request, statusCode int) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		rw.Header().Set("Allow", "GET, HEAD")
+		statusCode = http.StatusMethodNotAllowed
+	}
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(statusCode)
+	if req.Method == http.MethodHead {
+		return
+	}
+	_, _ = rw.Write([]byte(http.StatusText(statusCode)))
+}
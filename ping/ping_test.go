@@ -0,0 +1,39 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/24
+
+package ping
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReady(t *testing.T) {
+	ready := false
+	handler := New(func() bool { return ready })
+	for _, tc := range []struct {
+		ready  bool
+		method string
+		status int
+	}{
+		{ready: false, method: http.MethodGet, status: http.StatusServiceUnavailable},
+		{ready: true, method: http.MethodGet, status: http.StatusOK},
+		{ready: true, method: http.MethodHead, status: http.StatusOK},
+		{ready: true, method: http.MethodPost, status: http.StatusMethodNotAllowed},
+	} {
+		ready = tc.ready
+		rec := httptest.NewRecorder()
+		handler.Ready(rec, httptest.NewRequest(tc.method, ReadinessPath, nil))
+		if rec.Code != tc.status {
+			t.Errorf("ready=%v %s: got %d, want %d", tc.ready, tc.method, rec.Code, tc.status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.Ping(rec, httptest.NewRequest(http.MethodGet, LivenessPath, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "OK" {
+		t.Errorf("ping: got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -4,19 +4,50 @@
 
 package router
 
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNoServer is returned when a server is unknown to the balancer.
+var ErrNoServer = errors.New("server not found")
+
 type Balancer interface {
 	Servers() []string
 	RemoveServer(host string) error
 	UpsertServer(host string, options ...ServerOption) error
 	Next() string
+	// ServerStates returns every server, including the drained ones.
+	ServerStates() []ServerState
 }
 
 type ServerOption func(*server) error
 
+// Weight sets the weight of the server, a zero weight never receives requests.
+func Weight(weight int) ServerOption {
+	return func(s *server) error {
+		if weight < 0 {
+			return fmt.Errorf("invalid weight %d for server %s", weight, s.host)
+		}
+		s.weight = weight
+		return nil
+	}
+}
+
+// Status sets the status of the server, a Down server is drained.
+func Status(status ServerStatus) ServerOption {
+	return func(s *server) error {
+		s.status = status
+		return nil
+	}
+}
+
 type server struct {
-	host   string
-	weight int
-	status ServerStatus
+	host          string
+	weight        int
+	status        ServerStatus
+	currentWeight int
 }
 
 type ServerStatus uint8
@@ -26,11 +57,52 @@ const (
 	Up   ServerStatus = 1
 )
 
+func (s ServerStatus) String() string {
+	if s == Up {
+		return "up"
+	}
+	return "down"
+}
+
+// MarshalText encodes the status as "up" or "down".
+func (s ServerStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes "up" or "down".
+func (s *ServerStatus) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "up":
+		*s = Up
+	case "down":
+		*s = Down
+	default:
+		return fmt.Errorf("invalid server status %q", text)
+	}
+	return nil
+}
+
+// ServerState is the state of a server of a balancer.
+type ServerState struct {
+	Host   string       `json:"host"`
+	Weight int          `json:"weight"`
+	Status ServerStatus `json:"status"`
+}
+
+// Robin is a smooth weighted round robin balancer.
 type Robin struct {
+	mu         sync.Mutex
 	serverList []*server
 }
 
+// NewRobin creates an empty Robin.
+func NewRobin() *Robin {
+	return &Robin{}
+}
+
 func (r *Robin) Servers() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	list := make([]string, 0, len(r.serverList))
 	for _, server := range r.serverList {
 		if server.weight != 0 && server.status != Down {
@@ -40,31 +112,95 @@ func (r *Robin) Servers() []string {
 	return list
 }
 
-func (r Robin) RemoveServer(host string) error {
+func (r *Robin) ServerStates() []ServerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]ServerState, 0, len(r.serverList))
 	for _, server := range r.serverList {
+		list = append(list, ServerState{Host: server.host, Weight: server.weight, Status: server.status})
+	}
+	return list
+}
+
+func (r *Robin) RemoveServer(host string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, server := range r.serverList {
 		if server.host == host {
-			server.status = Down
+			r.serverList = append(r.serverList[:i], r.serverList[i+1:]...)
+			return nil
 		}
 	}
-	return nil
+	return fmt.Errorf("%w: %s", ErrNoServer, host)
 }
 
-func (r Robin) UpsertServer(host string, options ...ServerOption) error {
+func (r *Robin) UpsertServer(host string, options ...ServerOption) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.serverList {
+		if s.host == host {
+			updated := *s
+			for _, option := range options {
+				if err := option(&updated); err != nil {
+					return err
+				}
+			}
+			*s = updated
+			return nil
+		}
+	}
+	s := &server{
+		host:   host,
+		weight: 1,
+		status: Up,
+	}
 	for _, option := range options {
-		if err := option(&server{
-			host:   host,
-			weight: 1,
-			status: Up,
-		}); err != nil {
+		if err := option(s); err != nil {
 			return err
 		}
 	}
+	r.serverList = append(r.serverList, s)
 	return nil
 }
 
+// CopyState carries the round robin position of the servers of previous over to the servers of r
+// with the same host, so that a balancer rebuilt on reload goes on where previous stopped.
+func (r *Robin) CopyState(previous *Robin) {
+	previous.mu.Lock()
+	currentWeights := make(map[string]int, len(previous.serverList))
+	for _, s := range previous.serverList {
+		currentWeights[s.host] = s.currentWeight
+	}
+	previous.mu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.serverList {
+		s.currentWeight = currentWeights[s.host]
+	}
+}
+
+// Next returns the next available server, or an empty string when every server is drained.
 func (r *Robin) Next() string {
-	if len(r.serverList) != 0 {
-		return r.serverList[0].host
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		best  *server
+		total int
+	)
+	for _, s := range r.serverList {
+		if s.weight == 0 || s.status == Down {
+			continue
+		}
+		s.currentWeight += s.weight
+		total += s.weight
+		if best == nil || s.currentWeight > best.currentWeight {
+			best = s
+		}
+	}
+	if best == nil {
+		return ""
 	}
-	return ""
+	best.currentWeight -= total
+	return best.host
 }
@@ -33,32 +33,59 @@ type HostMap struct {
 
 func (h *HostMap) Server(host string) string {
 	h.RLock()
-	list := h.HostList[host]
+	list, ok := h.HostList[host]
 	h.RUnlock()
+	if !ok {
+		return ""
+	}
 	return list.Next()
 }
 
-var (
-	singleton *HostMap
-	once      sync.Once
-)
+// NewHostMap maps the origins of the proxy hosts to the balancer of their targets.
+func NewHostMap(list []*config.ProxyHost) (*HostMap, error) {
+	hostMap := &HostMap{
+		HostList: make(map[string]Balancer, len(list)),
+	}
+	for _, proxyHost := range list {
+		balancer, err := NewBalancer(proxyHost)
+		if err != nil {
+			return nil, err
+		}
+		for _, origin := range proxyHost.Origin {
+			hostMap.HostList[origin] = balancer
+		}
+	}
+	return hostMap, nil
+}
+
+// NewBalancer creates the balancer of the targets of a proxy host with their weight and drain status.
+func NewBalancer(proxyHost *config.ProxyHost) (*Robin, error) {
+	return newBalancer(proxyHost.Target, proxyHost.Weight, proxyHost.IsDrained)
+}
 
-func NewHostMap(list []*config.ProxyHost) *HostMap {
-	once.Do(func() {
-		singleton = &HostMap{
-			HostList: make(map[string]Balancer, len(list)),
+// NewTCPBalancer creates the balancer of the targets of a TCP router with their weight and drain status.
+func NewTCPBalancer(tcpRouter *config.TCPRouter) (*Robin, error) {
+	return newBalancer(tcpRouter.Target, tcpRouter.Weight, tcpRouter.IsDrained)
+}
+
+// NewUDPBalancer creates the balancer of the targets of a UDP router with their weight and drain status.
+func NewUDPBalancer(udpRouter *config.UDPRouter) (*Robin, error) {
+	return newBalancer(udpRouter.Target, udpRouter.Weight, udpRouter.IsDrained)
+}
+
+func newBalancer(targets []string, weights map[string]int, isDrained func(string) bool) (*Robin, error) {
+	balancer := NewRobin()
+	for _, target := range targets {
+		options := []ServerOption{Status(Up)}
+		if weight, ok := weights[target]; ok {
+			options = append(options, Weight(weight))
+		}
+		if isDrained(target) {
+			options = append(options, Status(Down))
 		}
-		for _, proxyHost := range list {
-			for _, origin := range proxyHost.Origin {
-				hostList, ok := singleton.HostList[origin]
-				if !ok {
-					singleton.HostList[origin] = &Robin{serverList: make([]*server, 0, len(list))}
-				}
-				for _, target := range proxyHost.Target {
-					_ = hostList.UpsertServer(target)
-				}
-			}
+		if err := balancer.UpsertServer(target, options...); err != nil {
+			return nil, err
 		}
-	})
-	return singleton
+	}
+	return balancer, nil
 }
@@ -0,0 +1,77 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/21
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/middlewares"
+)
+
+// NewInternalEntryPointList creates the entry points serving the endpoints of the proxy itself.
+func NewInternalEntryPointList(entryPointsConfig config.EntryPointList) (EntryPointList, error) {
+	serverEntryPointList := make(EntryPointList, len(entryPointsConfig))
+	for entryPointName, entryPoint := range entryPointsConfig {
+		if entryPoint.Transport == nil {
+			entryPoint.Transport = &config.EntryPointsTransport{}
+			entryPoint.Transport.SetDefaults()
+		}
+		ctx := logger.With(context.Background(), logger.Enable(true),
+			logger.Level(strings.ToUpper("DEBUG")),
+			logger.LogPath(fmt.Sprintf("./log/%s.log", entryPointName)))
+		var err error
+		serverEntryPointList[entryPointName], err = NewInternalEntryPoint(ctx, entryPoint)
+		if err != nil {
+			return nil, fmt.Errorf("error while building internal entryPoint %s: %w", entryPointName, err)
+		}
+	}
+	return serverEntryPointList, nil
+}
+
+// NewInternalEntryPoint creates an EntryPoint serving the endpoints of the proxy itself, such as /metrics.
+// The endpoints are registered with Handle.
+func NewInternalEntryPoint(ctx context.Context, configuration *config.EntryPoint) (*EntryPoint, error) {
+	if configuration.TLS != nil {
+		return nil, fmt.Errorf("internal entry point %s cannot serve TLS", configuration.GetAddress())
+	}
+	httpListener, err := listen(configuration.GetAddress())
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	httpSwitcher := middlewares.NewHandlerSwitcher(mux)
+	srv := &http.Server{
+		Handler:      httpSwitcher,
+		ReadTimeout:  configuration.Transport.RespondingTimeouts.ReadTimeout,
+		WriteTimeout: configuration.Transport.RespondingTimeouts.WriteTimeout,
+		IdleTimeout:  configuration.Transport.RespondingTimeouts.IdleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	return &EntryPoint{
+		httpListener: httpListener,
+		switcher:     httpSwitcher,
+		mux:          mux,
+		ctx:          ctx,
+		server:       srv,
+		serverConfig: configuration,
+	}, nil
+}
+
+// Handle registers the handler for the given pattern on an internal entry point.
+func (ep *EntryPoint) Handle(pattern string, handler http.Handler) error {
+	if ep.mux == nil {
+		return fmt.Errorf("cannot register %s, not an internal entry point", pattern)
+	}
+	ep.mux.Handle(pattern, handler)
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/24
+
+package http
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/crochee/proxy/config"
+)
+
+// listen opens the listener of an entry point address,
+// the unix socket left behind by a previous run is removed when nothing answers on it.
+func listen(address string) (net.Listener, error) {
+	network, addr, err := config.ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if err = removeStaleSocket(addr); err != nil {
+			return nil, err
+		}
+	}
+	var listener net.Listener
+	if listener, err = net.Listen(network, addr); err != nil {
+		return nil, fmt.Errorf("error opening listener: %w", err)
+	}
+	return listener, nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	var conn net.Conn
+	if conn, err = net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("error opening listener: %s is in use", path)
+	}
+	if err = os.Remove(path); err != nil {
+		return fmt.Errorf("error removing stale socket %s: %w", path, err)
+	}
+	return nil
+}
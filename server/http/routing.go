@@ -0,0 +1,267 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/23
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/config/dynamic"
+	"github.com/crochee/proxy/metrics"
+	"github.com/crochee/proxy/middlewares/accesslog"
+	"github.com/crochee/proxy/middlewares/circuitbreaker"
+	"github.com/crochee/proxy/middlewares/grpcweb"
+	"github.com/crochee/proxy/middlewares/ratelimit"
+	"github.com/crochee/proxy/middlewares/replacehost"
+	"github.com/crochee/proxy/middlewares/retry"
+	"github.com/crochee/proxy/router"
+	"github.com/crochee/proxy/server/service"
+	"github.com/crochee/proxy/tracing"
+)
+
+// RouterInfo describes a router matching the hosts of the requests.
+type RouterInfo struct {
+	Name    string   `json:"name"`
+	Origins []string `json:"origins"`
+	Service string   `json:"service"`
+}
+
+// Routing is the router handler shared by the entry points, built from a configuration.
+type Routing struct {
+	Handler  http.Handler
+	Routers  []RouterInfo
+	Services map[string]router.Balancer
+}
+
+// BuildRouting builds the routers of the proxy hosts of cfg,
+// the requests matching none of their origins are sent to the replaceHost middleware when it is configured.
+// The round trippers of the servers transports of cfg are taken from transports.
+func BuildRouting(ctx context.Context, cfg *config.Config, transports *service.RoundTrippers) (*Routing, error) {
+	// the default servers transport is only required by the proxy hosts and middlewares using it.
+	proxies := &proxyBuilder{transports: transports, proxies: make(map[string]http.Handler)}
+	var err error
+	var middleware dynamic.Middleware
+	if cfg.Middleware != nil {
+		middleware = *cfg.Middleware
+	}
+
+	routing := &Routing{
+		Services: make(map[string]router.Balancer, len(cfg.List)),
+	}
+	hosts := &hostRouter{
+		routes:   make(map[string]http.Handler),
+		routers:  make(map[string]string),
+		fallback: http.NotFoundHandler(),
+	}
+	if replaceHost := middleware.ReplaceHost; replaceHost != nil {
+		var proxy http.Handler
+		if proxy, err = proxies.get(config.DefaultServersTransport); err != nil {
+			return nil, fmt.Errorf("replaceHost: %w", err)
+		}
+		fallback := serviceHandler(proxy, replaceHost.Host)
+		if fallback, err = replacehost.New(ctx, fallback, *replaceHost); err != nil {
+			return nil, err
+		}
+		fallback = tracing.WrapMiddleware(fallback, "replaceHost")
+		hosts.fallbackService = replaceHost.Host
+		if fallback, err = withRetry(ctx, fallback, middleware.Retry, replaceHost.Host); err != nil {
+			return nil, err
+		}
+		if hosts.fallback, err = withCircuitBreaker(ctx, fallback, middleware.CircuitBreaker, replaceHost.Host); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, proxyHost := range cfg.List {
+		name := proxyHost.GetName()
+		if name == "" {
+			return nil, fmt.Errorf("proxy host with targets %v has neither name nor origin", proxyHost.Target)
+		}
+		if _, ok := routing.Services[name]; ok {
+			return nil, fmt.Errorf("duplicate proxy host %s", name)
+		}
+		var balancer *router.Robin
+		if balancer, err = router.NewBalancer(proxyHost); err != nil {
+			return nil, fmt.Errorf("proxy host %s: %w", name, err)
+		}
+		var hostProxy http.Handler
+		if hostProxy, err = proxies.get(proxyHost.ServersTransport); err != nil {
+			return nil, fmt.Errorf("proxy host %s: %w", name, err)
+		}
+		var handler http.Handler
+		if handler, err = service.NewLoadBalancer(name, balancer, serviceHandler(hostProxy, name)); err != nil {
+			return nil, err
+		}
+		if handler, err = withRetry(ctx, handler, middleware.Retry, name); err != nil {
+			return nil, err
+		}
+		if handler, err = withCircuitBreaker(ctx, handler, middleware.CircuitBreaker, name); err != nil {
+			return nil, err
+		}
+		handler = metrics.NewRouterMiddleware(handler, name, name)
+		handler = accesslog.NewFieldHandler(handler, accesslog.RouterName, name, nil)
+		for _, origin := range proxyHost.Origin {
+			origin = strings.ToLower(origin)
+			if _, ok := hosts.routes[origin]; ok {
+				return nil, fmt.Errorf("origin %s of proxy host %s is already routed", origin, name)
+			}
+			hosts.routes[origin] = handler
+			hosts.routers[origin] = name
+		}
+		for _, state := range balancer.ServerStates() {
+			setServerEnabled(name, state)
+		}
+		routing.Services[name] = balancer
+		routing.Routers = append(routing.Routers, RouterInfo{
+			Name:    name,
+			Origins: proxyHost.Origin,
+			Service: name,
+		})
+	}
+
+	routing.Handler = hosts
+	if errorPage := middleware.Errors; errorPage != nil {
+		if routing.Handler, err = buildErrorPage(ctx, routing.Handler, errorPage, transports); err != nil {
+			return nil, err
+		}
+		routing.Handler = tracing.WrapMiddleware(routing.Handler, "errors")
+	}
+	if grpcWeb := middleware.GRPCWeb; grpcWeb != nil {
+		if routing.Handler, err = grpcweb.New(ctx, routing.Handler, *grpcWeb); err != nil {
+			return nil, err
+		}
+		routing.Handler = tracing.WrapMiddleware(routing.Handler, "grpcWeb")
+	}
+	if rateLimit := middleware.RateLimit; rateLimit != nil {
+		if routing.Handler, err = ratelimit.New(ctx, routing.Handler, *rateLimit, hosts.route); err != nil {
+			return nil, err
+		}
+		routing.Handler = tracing.WrapMiddleware(routing.Handler, "rateLimit")
+	}
+	return routing, nil
+}
+
+// CopyBalancerState carries the round robin state of the services of previous over to
+// the services of the same name of r, before r replaces previous on the entry points.
+func (r *Routing) CopyBalancerState(previous *Routing) {
+	for name, balancer := range r.Services {
+		robin, ok := balancer.(*router.Robin)
+		if !ok {
+			continue
+		}
+		if previousRobin, ok := previous.Services[name].(*router.Robin); ok {
+			robin.CopyState(previousRobin)
+		}
+	}
+}
+
+// proxyBuilder builds a reverse proxy per servers transport used by the proxy hosts.
+type proxyBuilder struct {
+	transports *service.RoundTrippers
+	proxies    map[string]http.Handler
+}
+
+func (b *proxyBuilder) get(transport string) (http.Handler, error) {
+	if transport == "" {
+		transport = config.DefaultServersTransport
+	}
+	if proxy, ok := b.proxies[transport]; ok {
+		return proxy, nil
+	}
+	rt, err := b.transports.Get(transport)
+	if err != nil {
+		return nil, err
+	}
+	var proxy http.Handler
+	if proxy, err = service.BuildProxy(30*time.Second, rt); err != nil {
+		return nil, err
+	}
+	b.proxies[transport] = proxy
+	return proxy, nil
+}
+
+// serviceHandler records the service metrics and access log fields of the requests sent by the proxy.
+func serviceHandler(proxy http.Handler, name string) http.Handler {
+	handler := metrics.NewServiceMiddleware(proxy, name)
+	return accesslog.NewFieldHandler(handler, accesslog.ServiceName, name, accesslog.AddServiceFields)
+}
+
+// setServerEnabled records whether a server of a service receives requests, neither drained nor weighted 0.
+// The servers are not health checked.
+func setServerEnabled(service string, state router.ServerState) {
+	metrics.SetServerEnabled(service, state.Host, state.Status == router.Up && state.Weight > 0)
+}
+
+// withRetry wraps the handler of a service with the retry middleware when it is configured.
+func withRetry(ctx context.Context, next http.Handler, retryConfig *dynamic.Retry,
+	serviceName string) (http.Handler, error) {
+	if retryConfig == nil {
+		return next, nil
+	}
+	listeners := retry.Listeners{&accesslog.SaveRetries{}, metrics.NewRetryListener(serviceName)}
+	handler, err := retry.New(ctx, next, *retryConfig, listeners)
+	if err != nil {
+		return nil, err
+	}
+	return tracing.WrapMiddleware(handler, "retry"), nil
+}
+
+// withCircuitBreaker wraps the handler of a service with the circuit breaker middleware when it is configured.
+func withCircuitBreaker(ctx context.Context, next http.Handler, breaker *dynamic.CircuitBreaker,
+	serviceName string) (http.Handler, error) {
+	if breaker == nil {
+		return next, nil
+	}
+	handler, err := circuitbreaker.New(ctx, next, *breaker, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return tracing.WrapMiddleware(handler, "circuitBreaker"), nil
+}
+
+// hostRouter dispatches the requests on their host, with or without its port.
+type hostRouter struct {
+	routes map[string]http.Handler
+	// routers holds the router name of each route, the router and the service of a proxy host share its name.
+	routers  map[string]string
+	fallback http.Handler
+	// fallbackService is the host of the replaceHost middleware serving the fallback.
+	fallbackService string
+}
+
+func (h *hostRouter) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if origin, ok := h.match(req); ok {
+		h.routes[origin].ServeHTTP(rw, req)
+		return
+	}
+	h.fallback.ServeHTTP(rw, req)
+}
+
+// match returns the route of the host of req, with or without its port.
+func (h *hostRouter) match(req *http.Request) (string, bool) {
+	host := strings.ToLower(req.Host)
+	if _, ok := h.routes[host]; ok {
+		return host, true
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		if _, ok := h.routes[hostname]; ok {
+			return hostname, true
+		}
+	}
+	return "", false
+}
+
+// route returns the router and the service req is sent to, no router for the fallback.
+func (h *hostRouter) route(req *http.Request) (string, string) {
+	if origin, ok := h.match(req); ok {
+		return h.routers[origin], h.routers[origin]
+	}
+	return "", h.fallbackService
+}
@@ -0,0 +1,146 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/21
+
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/config/dynamic"
+	"github.com/crochee/proxy/metrics"
+	"github.com/crochee/proxy/server/service"
+)
+
+// buildRouting builds the routing of cfg with new round trippers.
+func buildRouting(t *testing.T, cfg *config.Config) (*Routing, error) {
+	t.Helper()
+	transports, err := service.NewRoundTripperManager().Prepare(cfg.GetServersTransports())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return BuildRouting(context.Background(), cfg, transports)
+}
+
+func TestServerEnabledMetric(t *testing.T) {
+	metrics.InitPrometheus(&config.Prometheus{})
+	_, err := buildRouting(t, &config.Config{
+		Transport: &config.ServersTransport{},
+		List: []*config.ProxyHost{{
+			Name:   "whoami",
+			Origin: []string{"whoami.local"},
+			Target: []string{"http://10.0.0.1", "http://10.0.0.2", "http://10.0.0.3"},
+			Drain:  []string{"http://10.0.0.2"},
+			Weight: map[string]int{"http://10.0.0.3": 0},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	for url, value := range map[string]string{"http://10.0.0.1": "1", "http://10.0.0.2": "0", "http://10.0.0.3": "0"} {
+		line := `proxy_service_server_enabled{service="whoami",url="` + url + `"} ` + value
+		if !strings.Contains(string(body), line) {
+			t.Errorf("missing %s", line)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	metrics.InitPrometheus(&config.Prometheus{})
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {}))
+	defer backend.Close()
+	routing, err := buildRouting(t, &config.Config{
+		Transport: &config.ServersTransport{},
+		List:      []*config.ProxyHost{{Name: "whoami", Origin: []string{"whoami.local"}, Target: []string{backend.URL}}},
+		Middleware: &dynamic.Middleware{
+			RateLimit: &dynamic.RateLimit{Every: time.Minute, Burst: 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, host := range []string{"whoami.local", "whoami.local", "unknown.local"} {
+		want := http.StatusTooManyRequests
+		if i == 0 {
+			want = http.StatusOK
+		}
+		rec := httptest.NewRecorder()
+		routing.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+		if rec.Code != want {
+			t.Errorf("request %d: got %d, want %d", i, rec.Code, want)
+		}
+	}
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	// the rejections are attributed to the router the request would have reached.
+	for _, line := range []string{
+		`proxy_ratelimit_rejected_total{reason="delay",router="whoami",service="whoami"} 1`,
+		`proxy_ratelimit_rejected_total{reason="delay",router="",service=""} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), line) {
+			t.Errorf("missing %s", line)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+	routing, err := buildRouting(t, &config.Config{
+		Transport: &config.ServersTransport{},
+		List:      []*config.ProxyHost{{Name: "breaker", Origin: []string{"breaker.local"}, Target: []string{backend.URL}}},
+		Middleware: &dynamic.Middleware{
+			CircuitBreaker: &dynamic.CircuitBreaker{RequestVolumeThreshold: 1, SleepWindow: time.Hour},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the circuit of the service opens on the failures, which it counts asynchronously.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		routing.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://breaker.local/", nil))
+		if rec.Code == http.StatusServiceUnavailable {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d, want the circuit to open", rec.Code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBuildRoutingNamedTransports(t *testing.T) {
+	newConfig := func(serversTransport string) *config.Config {
+		return &config.Config{
+			ServersTransports: map[string]*config.ServersTransport{"internal": {}},
+			List: []*config.ProxyHost{{
+				Name:             "whoami",
+				Origin:           []string{"whoami.local"},
+				Target:           []string{"http://10.0.0.1"},
+				ServersTransport: serversTransport,
+			}},
+		}
+	}
+	// the default servers transport is not required when no proxy host uses it.
+	if _, err := buildRouting(t, newConfig("internal")); err != nil {
+		t.Errorf("got %v with the named servers transports only", err)
+	}
+	_, err := buildRouting(t, newConfig(""))
+	if err == nil || !strings.Contains(err.Error(), "unknown serversTransport "+config.DefaultServersTransport) {
+		t.Errorf("got %v, want the default servers transport to be missing", err)
+	}
+}
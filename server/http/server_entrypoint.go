@@ -11,15 +11,32 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
 	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/config/dynamic"
 	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/metrics"
 	"github.com/crochee/proxy/middlewares"
+	"github.com/crochee/proxy/middlewares/accesslog"
+	"github.com/crochee/proxy/middlewares/customerrors"
 	"github.com/crochee/proxy/middlewares/forwardedheaders"
 	"github.com/crochee/proxy/middlewares/replacehost"
+	"github.com/crochee/proxy/middlewares/requestid"
 	"github.com/crochee/proxy/server/service"
+	"github.com/crochee/proxy/server/tcp"
+	"github.com/crochee/proxy/server/udp"
 	tls2 "github.com/crochee/proxy/tls"
+	"github.com/crochee/proxy/tracing"
+	"github.com/crochee/proxy/util/proxyprotocol"
 )
 
 // EntryPoint is the http server.
@@ -27,48 +44,122 @@ type EntryPoint struct {
 	httpListener  net.Listener
 	httpsListener net.Listener
 	switcher      *middlewares.HTTPHandlerSwitcher
-	server        *http.Server
-	ctx           context.Context
-	serverConfig  *config.EntryPoint
+	// tcpSwitcher routes the connections to the TCP routers before the HTTP server,
+	// nil on the entry points TCP routers cannot attach to: the internal ones and those without TCP listener.
+	tcpSwitcher *tcp.Switcher
+	mux         *http.ServeMux
+	accessLog   *accesslog.Handler
+	server      *http.Server
+	// h2c serves HTTP/2 on the plain listener, its connections are shut down with h2cShutdown.
+	h2c         *http2.Server
+	h2cShutdown *http.Server
+	// http3 serves HTTP/3 on udpConn, advertised by altSvc on the TLS responses.
+	http3   *http3.Server
+	udpConn net.PacketConn
+	// udpProxy forwards the datagrams of udpConn on the entry points of the udp protocol without TLS.
+	udpProxy     *udp.Proxy
+	altSvc       string
+	ctx          context.Context
+	serverConfig *config.EntryPoint
+	// certificates are reloaded from their files until stopWatch is called.
+	certificates *tls2.CertificateStore
+	stopWatch    context.CancelFunc
+	// serving counts the listeners accepting connections.
+	serving int32
+	// terminating is set once the shutdown has begun.
+	terminating int32
 }
 
 // NewEntryPoint creates a new EntryPoint.
-func NewEntryPoint(ctx context.Context, configuration *config.EntryPoint) (*EntryPoint, error) {
-	httpListener, err := net.Listen("tcp", fmt.Sprintf(":%d", configuration.Port))
-	if err != nil {
-		return nil, fmt.Errorf("error opening listener: %w", err)
-	}
-	var httpsListener net.Listener
-	httpsListener, err = net.Listen("tcp", fmt.Sprintf(":%d", configuration.Port+1))
-	if err != nil {
-		return nil, fmt.Errorf("error opening listener: %w", err)
-	}
-	var rt http.RoundTripper
-	if rt, err = service.CreateRoundTripper(config.Cfg.Transport); err != nil {
-		return nil, err
+func NewEntryPoint(ctx context.Context, name config.ServerName, configuration *config.EntryPoint) (_ *EntryPoint, err error) {
+	plainAddress, secureAddress := configuration.ListenAddresses()
+	var (
+		httpListener, httpsListener net.Listener
+		udpConn                     net.PacketConn
+		accessLog                   *accesslog.Handler
+	)
+	// what is opened is closed again when a later step fails.
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, listener := range []net.Listener{httpListener, httpsListener} {
+			if listener != nil {
+				listener.Close()
+			}
+		}
+		if udpConn != nil {
+			udpConn.Close()
+		}
+		if accessLog != nil {
+			accessLog.Close()
+		}
+	}()
+	if plainAddress != "" {
+		if httpListener, err = listen(plainAddress); err != nil {
+			return nil, err
+		}
 	}
-	var proxyRoute http.Handler
-	if proxyRoute, err = service.BuildProxy(30*time.Second, rt); err != nil {
-		return nil, err
+	if secureAddress != "" {
+		if httpsListener, err = listen(secureAddress); err != nil {
+			return nil, err
+		}
 	}
-	//httpSwitcher := middlewares.NewHandlerSwitcher(http.NotFoundHandler())
-	var route http.Handler
-	if route, err = replacehost.New(ctx, proxyRoute, *config.Cfg.Middleware.ReplaceHost); err != nil {
-		return nil, err
+	if proxyProtocol := configuration.ProxyProtocol; proxyProtocol != nil {
+		// the headers are read beneath the TCP routers and the TLS handshakes.
+		if httpListener, httpsListener, err = withProxyProtocol(proxyProtocol, httpListener, httpsListener); err != nil {
+			return nil, err
+		}
 	}
-	httpSwitcher := middlewares.NewHandlerSwitcher(route)
+	if address := configuration.UDPAddress(); address != "" {
+		if udpConn, err = net.ListenPacket("udp", address); err != nil {
+			return nil, fmt.Errorf("error opening listener: %w", err)
+		}
+	}
+	// the routers are switched in once the configuration is applied.
+	httpSwitcher := middlewares.NewHandlerSwitcher(http.NotFoundHandler())
 	var handler http.Handler
 	if handler, err = forwardedheaders.NewXForwarded(
 		configuration.ForwardedHeaders.Insecure,
 		configuration.ForwardedHeaders.TrustedIPs,
+		configuration.ForwardedHeaders.TLSClientCert,
+		configuration.ForwardedHeaders.Emit,
 		httpSwitcher); err != nil {
 		return nil, err
 	}
-	// todo 修改
-	cfs := new(tls2.Certificates)
-	var tlsConfig *tls.Config
-	if tlsConfig, err = cfs.CreateTLSConfig("default"); err != nil {
-		return nil, err
+	handler = tracing.WrapMiddleware(handler, "forwardedHeaders")
+	handler = metrics.NewEntryPointMiddleware(handler, string(name))
+	if configuration.AccessLog != nil {
+		if accessLog, err = accesslog.New(ctx, handler, *configuration.AccessLog, string(name)); err != nil {
+			return nil, err
+		}
+		handler = accessLog
+	}
+	if middleware := config.Cfg.Middleware; middleware != nil && middleware.RequestID != nil {
+		requestID := middleware.RequestID
+		if handler, err = requestid.New(ctx, handler, *requestID); err != nil {
+			return nil, err
+		}
+		handler = tracing.WrapMiddleware(handler, "requestId")
+	}
+	handler = tracing.NewEntryPointMiddleware(handler, string(name))
+	var (
+		tlsConfig *tls.Config
+		store     *tls2.CertificateStore
+	)
+	if configuration.TLS != nil {
+		if tlsConfig, store, err = configuration.TLS.Certificates.CreateTLSConfig(string(name),
+			configuration.TLS.DefaultCertificate, config.Cfg.GetTLSOptions(configuration)); err != nil {
+			return nil, err
+		}
+		if clientAuth := configuration.TLS.ClientAuth; clientAuth != nil {
+			if err = clientAuth.Apply(tlsConfig); err != nil {
+				return nil, err
+			}
+		}
+		for _, certificate := range store.Certificates() {
+			metrics.SetCertificateExpiry(certificate.Leaf)
+		}
 	}
 	srv := &http.Server{
 		Handler:      handler,
@@ -76,34 +167,215 @@ func NewEntryPoint(ctx context.Context, configuration *config.EntryPoint) (*Entr
 		ReadTimeout:  configuration.Transport.RespondingTimeouts.ReadTimeout,
 		WriteTimeout: configuration.Transport.RespondingTimeouts.WriteTimeout,
 		IdleTimeout:  configuration.Transport.RespondingTimeouts.IdleTimeout,
+		ConnState:    metrics.ConnState(string(name)),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
 	}
-
-	return &EntryPoint{
+	if tlsConfig != nil && len(tlsConfig.NextProtos) != 0 && !containsString(tlsConfig.NextProtos, "h2") {
+		// net/http enables HTTP/2 on TLS unless TLSNextProto is set.
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	ep := &EntryPoint{
 		httpListener:  httpListener,
 		httpsListener: httpsListener,
 		switcher:      httpSwitcher,
+		accessLog:     accessLog,
 		ctx:           ctx,
 		server:        srv,
 		serverConfig:  configuration,
-	}, nil
+		certificates:  store,
+		udpConn:       udpConn,
+	}
+	if httpListener != nil || httpsListener != nil {
+		ep.tcpSwitcher = tcp.NewSwitcher(ctx)
+	}
+	if configuration.H2C {
+		ep.h2c = &http2.Server{IdleTimeout: srv.IdleTimeout}
+		// the hijacked h2c connections are not tracked by srv, a server of their own sends them GOAWAY on shutdown.
+		ep.h2cShutdown = &http.Server{}
+		if err = http2.ConfigureServer(ep.h2cShutdown, ep.h2c); err != nil {
+			return nil, err
+		}
+	}
+	if udpConn != nil && configuration.TLS == nil {
+		ep.udpProxy = udp.NewProxy(ctx)
+	} else if udpConn != nil {
+		ep.http3 = &http3.Server{
+			TLSConfig:      tlsConfig,
+			QuicConfig:     &quic.Config{MaxIdleTimeout: srv.IdleTimeout},
+			MaxHeaderBytes: srv.MaxHeaderBytes,
+		}
+		if !configuration.IsUDP() {
+			port := udpConn.LocalAddr().(*net.UDPAddr).Port
+			if configuration.HTTP3.AdvertisedPort != 0 {
+				port = configuration.HTTP3.AdvertisedPort
+			}
+			ep.altSvc = `h3=":` + strconv.Itoa(port) + `"; ma=2592000`
+		}
+	}
+	return ep, nil
+}
+
+// withProxyProtocol wraps the listeners to read the PROXY protocol header of their connections,
+// both of them are closed on error.
+func withProxyProtocol(proxyProtocol *config.ProxyProtocol, plain, secure net.Listener) (net.Listener, net.Listener, error) {
+	listeners := []net.Listener{plain, secure}
+	for i, listener := range listeners {
+		if listener == nil {
+			continue
+		}
+		l, err := proxyprotocol.NewListener(listener, proxyProtocol.Insecure, proxyProtocol.TrustedIPs)
+		if err != nil {
+			for _, listener := range []net.Listener{plain, secure} {
+				if listener != nil {
+					listener.Close()
+				}
+			}
+			return nil, nil, err
+		}
+		listeners[i] = l
+	}
+	return listeners[0], listeners[1], nil
+}
+
+// buildErrorPage wraps next with the custom error pages middleware,
+// the error page backend is reached with the default servers transport.
+func buildErrorPage(ctx context.Context, next http.Handler, errorPage *dynamic.ErrorPage,
+	transports *service.RoundTrippers) (http.Handler, error) {
+	var backend http.Handler
+	if errorPage.Service != "" {
+		u, err := url.Parse(errorPage.Service)
+		if err != nil {
+			return nil, fmt.Errorf("invalid error page service %s: %w", errorPage.Service, err)
+		}
+		var rt http.RoundTripper
+		if rt, err = transports.Get(config.DefaultServersTransport); err != nil {
+			return nil, fmt.Errorf("error page service %s: %w", errorPage.Service, err)
+		}
+		var proxy http.Handler
+		if proxy, err = service.BuildProxy(30*time.Second, rt); err != nil {
+			return nil, err
+		}
+		if backend, err = replacehost.New(ctx, proxy, dynamic.ReplaceHost{
+			Scheme: u.Scheme,
+			Host:   u.Host,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return customerrors.New(ctx, next, *errorPage, backend)
 }
 
 func (ep *EntryPoint) Start() {
-	go func() {
-		if err := ep.server.Serve(ep.httpListener); err != nil {
-			logger.FromContext(ep.ctx).Errorf("Error while starting server: %v", err)
+	if ep.certificates != nil {
+		var ctx context.Context
+		ctx, ep.stopWatch = context.WithCancel(ep.ctx)
+		go ep.certificates.Watch(ctx, func(previous, certificate *tls.Certificate) {
+			metrics.DeleteCertificate(previous.Leaf)
+			metrics.SetCertificateExpiry(certificate.Leaf)
+		})
+	}
+	// the protocols share the handler wrapped by WrapHandler.
+	handler := ep.server.Handler
+	if ep.http3 != nil {
+		ep.http3.Handler = handler
+		ep.serve(func() error { return ep.http3.Serve(ep.udpConn) })
+	}
+	if ep.udpProxy != nil {
+		ep.serve(func() error { return ep.udpProxy.Serve(ep.udpConn) })
+	}
+	if ep.altSvc != "" {
+		handler = advertiseHTTP3(handler, ep.altSvc)
+	}
+	if ep.h2c != nil {
+		handler = h2c.NewHandler(handler, ep.h2c)
+	}
+	ep.server.Handler = handler
+	if ep.tcpSwitcher != nil && ep.server.TLSConfig != nil {
+		// the TCP routers do not negotiate the HTTP protocols.
+		tlsConfig := ep.server.TLSConfig.Clone()
+		tlsConfig.NextProtos = nil
+		ep.tcpSwitcher.SetTLSConfig(tlsConfig)
+	}
+	if ep.httpListener != nil {
+		listener := ep.switchTCP(ep.httpListener)
+		ep.serve(func() error { return ep.server.Serve(listener) })
+	}
+	if ep.httpsListener != nil {
+		listener := ep.switchTCP(ep.httpsListener)
+		ep.serve(func() error { return ep.server.ServeTLS(listener, "", "") })
+	}
+}
+
+// switchTCP returns the listener of the HTTP server,
+// which accepts the connections of listener left by the TCP routers.
+func (ep *EntryPoint) switchTCP(listener net.Listener) net.Listener {
+	if ep.tcpSwitcher == nil {
+		return listener
+	}
+	l := newSwitchListener(listener)
+	go l.run(ep.tcpSwitcher)
+	return l
+}
+
+// advertiseHTTP3 announces the HTTP/3 listener in the Alt-Svc header of the TLS responses.
+func advertiseHTTP3(next http.Handler, altSvc string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.TLS != nil {
+			rw.Header().Set("Alt-Svc", altSvc)
 		}
-	}()
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// serve runs fn in a goroutine, the listener counts as serving until fn returns.
+func (ep *EntryPoint) serve(fn func() error) {
+	atomic.AddInt32(&ep.serving, 1)
 	go func() {
-		if err := ep.server.ServeTLS(ep.httpsListener, "", ""); err != nil {
+		defer atomic.AddInt32(&ep.serving, -1)
+		if err := fn(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.FromContext(ep.ctx).Errorf("Error while starting server: %v", err)
 		}
 	}()
 }
 
+// Ready reports whether the entry point accepts connections and is not shutting down.
+func (ep *EntryPoint) Ready() bool {
+	return atomic.LoadInt32(&ep.serving) > 0 && atomic.LoadInt32(&ep.terminating) == 0
+}
+
+// Certificates returns the certificate store of the entry point, nil when it serves no TLS.
+func (ep *EntryPoint) Certificates() *tls2.CertificateStore {
+	return ep.certificates
+}
+
+// TLSConfig returns the TLS configuration of the entry point, nil when it serves no TLS.
+// It may be modified until the entry point is started.
+func (ep *EntryPoint) TLSConfig() *tls.Config {
+	return ep.server.TLSConfig
+}
+
+// WrapHandler wraps the handler of the entry point ahead of its middlewares,
+// it must be called before the entry point is started.
+func (ep *EntryPoint) WrapHandler(wrap func(http.Handler) http.Handler) {
+	ep.server.Handler = wrap(ep.server.Handler)
+}
+
+// Internal reports whether the entry point serves the endpoints of the proxy itself.
+func (ep *EntryPoint) Internal() bool {
+	return ep.mux != nil
+}
+
 // Shutdown stops the http connections.
 func (ep *EntryPoint) Shutdown() {
 	log := logger.FromContext(ep.ctx)
+	// the entry point is reported as not ready during the grace timeout,
+	// so that the load balancers stop sending requests before the connections are cut.
+	atomic.StoreInt32(&ep.terminating, 1)
+	if ep.stopWatch != nil {
+		ep.stopWatch()
+	}
 
 	reqAcceptGraceTimeOut := ep.serverConfig.Transport.LifeCycle.RequestAcceptGraceTimeout
 	if reqAcceptGraceTimeOut > 0 {
@@ -115,6 +387,10 @@ func (ep *EntryPoint) Shutdown() {
 	ctx, cancel := context.WithTimeout(ep.ctx, graceTimeOut)
 	log.Debugf("Waiting %s seconds before killing connections.", graceTimeOut)
 
+	if ep.h2cShutdown != nil {
+		// only the shutdown hooks run, the server has no listener.
+		_ = ep.h2cShutdown.Shutdown(ctx)
+	}
 	if ep.server != nil {
 		func(server *http.Server) {
 			err := server.Shutdown(ctx)
@@ -134,7 +410,47 @@ func (ep *EntryPoint) Shutdown() {
 			server.Close()
 		}(ep.server)
 	}
+	if ep.tcpSwitcher != nil {
+		ep.tcpSwitcher.Shutdown(ctx)
+	}
 	cancel()
+	if ep.http3 != nil {
+		// the streams in flight are cut, quic-go has no graceful shutdown yet.
+		if err := ep.http3.Close(); err != nil {
+			log.Error(err.Error())
+		}
+		ep.udpConn.Close()
+	}
+	if ep.udpProxy != nil {
+		if err := ep.udpProxy.Close(); err != nil {
+			log.Error(err.Error())
+		}
+	}
+
+	if ep.accessLog != nil {
+		if err := ep.accessLog.Close(); err != nil {
+			log.Errorf("Error while closing access log: %v", err)
+		}
+	}
+}
+
+// SwitchTCPRouter switches the router of the TCP connections, nil routes them all to the HTTP server.
+func (ep *EntryPoint) SwitchTCPRouter(router *tcp.Router) {
+	if ep.tcpSwitcher == nil {
+		return
+	}
+	if router == nil {
+		router = tcp.NewRouter()
+	}
+	ep.tcpSwitcher.UpdateRouter(router)
+}
+
+// SwitchUDPService switches the service of the datagrams, nil drops them.
+func (ep *EntryPoint) SwitchUDPService(service *udp.Service) {
+	if ep.udpProxy == nil {
+		return
+	}
+	ep.udpProxy.UpdateService(service)
 }
 
 // SwitchRouter switches the http router handler.
@@ -144,3 +460,12 @@ func (ep *EntryPoint) SwitchRouter(handler http.Handler) {
 	}
 	ep.switcher.UpdateHandler(handler)
 }
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -13,6 +13,8 @@ import (
 
 	"github.com/crochee/proxy/config"
 	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/server/tcp"
+	"github.com/crochee/proxy/server/udp"
 )
 
 type EntryPointList map[config.ServerName]*EntryPoint
@@ -21,17 +23,14 @@ type EntryPointList map[config.ServerName]*EntryPoint
 func NewEntryPointList(entryPointsConfig config.EntryPointList) (EntryPointList, error) {
 	serverEntryPointList := make(EntryPointList, len(entryPointsConfig))
 	for entryPointName, entryPoint := range entryPointsConfig {
-		protocol, err := entryPoint.GetProtocol()
+		_, err := entryPoint.GetProtocol()
 		if err != nil {
 			return nil, fmt.Errorf("error while building entryPoint %s: %w", entryPointName, err)
 		}
-		if protocol != "tcp" {
-			continue
-		}
 		ctx := logger.With(context.Background(), logger.Enable(true),
 			logger.Level(strings.ToUpper("DEBUG")),
 			logger.LogPath(fmt.Sprintf("./log/%s.log", entryPointName)))
-		serverEntryPointList[entryPointName], err = NewEntryPoint(ctx, entryPoint)
+		serverEntryPointList[entryPointName], err = NewEntryPoint(ctx, entryPointName, entryPoint)
 		if err != nil {
 			return nil, fmt.Errorf("error while building entryPoint %s: %w", entryPointName, err)
 		}
@@ -47,11 +46,20 @@ func (epl EntryPointList) Start() {
 	}
 }
 
-// Stop the server entry points.
+// Stop the server entry points, the internal ones are stopped once the others are closed
+// so that their readiness endpoint keeps answering during the grace timeout.
 func (epl EntryPointList) Stop() {
+	epl.stop(func(ep *EntryPoint) bool { return !ep.Internal() })
+	epl.stop(func(ep *EntryPoint) bool { return ep.Internal() })
+}
+
+func (epl EntryPointList) stop(match func(*EntryPoint) bool) {
 	var wg sync.WaitGroup
 
 	for epn, ep := range epl {
+		if !match(ep) {
+			continue
+		}
 		wg.Add(1)
 
 		go func(entryPointName config.ServerName, entryPoint *EntryPoint) {
@@ -64,6 +72,16 @@ func (epl EntryPointList) Stop() {
 	wg.Wait()
 }
 
+// Ready reports whether at least one of the entry points routing the requests is ready.
+func (epl EntryPointList) Ready() bool {
+	for _, ep := range epl {
+		if !ep.Internal() && ep.Ready() {
+			return true
+		}
+	}
+	return false
+}
+
 // Update the servers.
 func (epl EntryPointList) Update(entryPointsConfig config.EntryPointList) {
 	// todo 需要实现
@@ -75,3 +93,17 @@ func (epl EntryPointList) Switch(routers map[config.ServerName]http.Handler) {
 		epl[entryPointName].SwitchRouter(rt)
 	}
 }
+
+// SwitchTCP switches the TCP routers, the entry points without router give every connection to their HTTP server.
+func (epl EntryPointList) SwitchTCP(routers map[config.ServerName]*tcp.Router) {
+	for entryPointName, entryPoint := range epl {
+		entryPoint.SwitchTCPRouter(routers[entryPointName])
+	}
+}
+
+// SwitchUDP switches the services of the datagrams, the entry points without service drop them.
+func (epl EntryPointList) SwitchUDP(services map[config.ServerName]*udp.Service) {
+	for entryPointName, entryPoint := range epl {
+		entryPoint.SwitchUDPService(services[entryPointName])
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/2
+
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/crochee/proxy/config"
+	tls2 "github.com/crochee/proxy/tls"
+)
+
+// startEntryPoint starts an entry point of configuration answering with the protocol of the requests.
+func startEntryPoint(t *testing.T, configuration *config.EntryPoint) *EntryPoint {
+	t.Helper()
+	config.Cfg = &config.Config{}
+	configuration.SetDefaults()
+	configuration.Transport = &config.EntryPointsTransport{}
+	configuration.Transport.SetDefaults()
+	configuration.Transport.LifeCycle.GraceTimeOut = time.Second
+	ep, err := NewEntryPoint(context.Background(), "web", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep.Start()
+	ep.SwitchRouter(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(req.Proto))
+	}))
+	t.Cleanup(ep.Shutdown)
+	return ep
+}
+
+// freeAddress returns a local address of a free TCP port.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func get(t *testing.T, client *http.Client, url string) *http.Response {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestH2C(t *testing.T) {
+	ep := startEntryPoint(t, &config.EntryPoint{Address: freeAddress(t), H2C: true})
+	// prior knowledge, HTTP/2 without TLS from the first request.
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	defer client.CloseIdleConnections()
+	if resp := get(t, client, "http://"+ep.httpListener.Addr().String()+"/"); resp.ProtoMajor != 2 {
+		t.Errorf("got %s, want HTTP/2", resp.Proto)
+	}
+
+	// the HTTP/1.1 clients are still served.
+	if resp := get(t, &http.Client{}, "http://"+ep.httpListener.Addr().String()+"/"); resp.ProtoMajor != 1 {
+		t.Errorf("got %s, want HTTP/1.1", resp.Proto)
+	}
+}
+
+func TestAltSvc(t *testing.T) {
+	testCases := []struct {
+		name           string
+		advertisedPort int
+	}{
+		{name: "udp port"},
+		{name: "advertised port", advertisedPort: 8443},
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	defer client.CloseIdleConnections()
+	for _, tc := range testCases {
+		ep := startEntryPoint(t, &config.EntryPoint{
+			Address: freeAddress(t),
+			TLS:     &config.EntryPointTLS{Address: freeAddress(t)},
+			HTTP3:   &config.HTTP3{AdvertisedPort: tc.advertisedPort},
+		})
+		port := tc.advertisedPort
+		if port == 0 {
+			port = ep.udpConn.LocalAddr().(*net.UDPAddr).Port
+		}
+		want := `h3=":` + strconv.Itoa(port) + `"; ma=2592000`
+		if got := get(t, client, "https://"+ep.httpsListener.Addr().String()+"/").Header.Get("Alt-Svc"); got != want {
+			t.Errorf("%s: got the Alt-Svc %q, want %q", tc.name, got, want)
+		}
+		// HTTP/3 is advertised on TLS only.
+		if got := get(t, client, "http://"+ep.httpListener.Addr().String()+"/").Header.Get("Alt-Svc"); got != "" {
+			t.Errorf("%s: got the Alt-Svc %q on the plain address", tc.name, got)
+		}
+	}
+}
+
+func TestNewEntryPointClosesListeners(t *testing.T) {
+	config.Cfg = &config.Config{}
+	testCases := []struct {
+		name          string
+		configuration *config.EntryPoint
+	}{
+		{
+			name:          "access log",
+			configuration: &config.EntryPoint{AccessLog: &config.AccessLog{Format: "xml"}},
+		},
+		{
+			name: "tls",
+			configuration: &config.EntryPoint{
+				TLS:   &config.EntryPointTLS{ClientAuth: &tls2.ClientAuth{ClientAuthType: "unknown"}},
+				HTTP3: &config.HTTP3{},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc.configuration.Address = freeAddress(t)
+		if tc.configuration.TLS != nil {
+			tc.configuration.TLS.Address = freeAddress(t)
+		}
+		tc.configuration.SetDefaults()
+		tc.configuration.Transport = &config.EntryPointsTransport{}
+		tc.configuration.Transport.SetDefaults()
+		if _, err := NewEntryPoint(context.Background(), "web", tc.configuration); err == nil {
+			t.Fatalf("%s: expected an error", tc.name)
+		}
+		// the addresses are free again.
+		plain, secure := tc.configuration.ListenAddresses()
+		for _, address := range []string{plain, secure} {
+			if address == "" {
+				continue
+			}
+			listener, err := net.Listen("tcp", address)
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+				continue
+			}
+			listener.Close()
+		}
+		if address := tc.configuration.UDPAddress(); address != "" {
+			conn, err := net.ListenPacket("udp", address)
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+				continue
+			}
+			conn.Close()
+		}
+	}
+}
+
+func TestTCPSwitcher(t *testing.T) {
+	if ep := startEntryPoint(t, &config.EntryPoint{Address: freeAddress(t)}); ep.tcpSwitcher == nil {
+		t.Error("the TCP routers cannot attach to the entry point")
+	}
+
+	configuration := &config.EntryPoint{Address: freeAddress(t)}
+	configuration.Transport = &config.EntryPointsTransport{}
+	configuration.Transport.SetDefaults()
+	ep, err := NewInternalEntryPoint(context.Background(), configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Shutdown()
+	if ep.tcpSwitcher != nil {
+		t.Error("the internal entry point routes TCP connections")
+	}
+	// no TCP router may attach, the router is ignored.
+	ep.SwitchTCPRouter(nil)
+}
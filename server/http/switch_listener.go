@@ -0,0 +1,89 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/1
+
+package http
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/crochee/proxy/server/tcp"
+)
+
+var errListenerClosed = errors.New("listener closed")
+
+// switchListener accepts the connections of an entry point listener for its TCP routers,
+// the HTTP server accepts the connections they give back.
+type switchListener struct {
+	net.Listener
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func newSwitchListener(listener net.Listener) *switchListener {
+	return &switchListener{
+		Listener: listener,
+		conns:    make(chan net.Conn),
+		closed:   make(chan struct{}),
+	}
+}
+
+// run accepts the connections until the listener is closed.
+func (l *switchListener) run(switcher *tcp.Switcher) {
+	var delay time.Duration
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				// the same backoff as net/http.
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				time.Sleep(delay)
+				continue
+			}
+			l.close(err)
+			return
+		}
+		delay = 0
+		switcher.ServeConn(conn, l.forward)
+	}
+}
+
+// forward hands conn to the HTTP server.
+func (l *switchListener) forward(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+func (l *switchListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, l.err
+	}
+}
+
+func (l *switchListener) Close() error {
+	l.close(errListenerClosed)
+	return l.Listener.Close()
+}
+
+func (l *switchListener) close(err error) {
+	l.once.Do(func() {
+		l.err = err
+		close(l.closed)
+	})
+}
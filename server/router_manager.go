@@ -0,0 +1,220 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/23
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/server/http"
+	"github.com/crochee/proxy/server/service"
+	"github.com/crochee/proxy/server/tcp"
+	"github.com/crochee/proxy/server/udp"
+)
+
+// RouterManager builds the routers of a configuration and switches them atomically on the entry points.
+// The file reloads and the changes of the admin API both go through Apply.
+type RouterManager struct {
+	ctx            context.Context
+	entryPointList http.EntryPointList
+	mu             sync.RWMutex
+	cfg            *config.Config
+	routing        *http.Routing
+	// transports keeps the round trippers of the servers transports across the configurations.
+	transports *service.RoundTripperManager
+	// listeners are notified of each configuration applied.
+	listeners []func(cfg *config.Config)
+	// updates counts the changes of the admin API in the active configuration, the next Apply discards them.
+	updates int
+}
+
+// NewRouterManager creates a RouterManager switching the routers of entryPointList,
+// the entry points added to entryPointList afterwards, such as the internal ones, are left untouched.
+func NewRouterManager(ctx context.Context, entryPointList http.EntryPointList) *RouterManager {
+	list := make(http.EntryPointList, len(entryPointList))
+	for name, entryPoint := range entryPointList {
+		list[name] = entryPoint
+	}
+	return &RouterManager{
+		ctx:            ctx,
+		entryPointList: list,
+		transports:     service.NewRoundTripperManager(),
+	}
+}
+
+// Apply validates cfg, builds its routers and switches them on the entry points,
+// the active configuration is left untouched when the validation or the build fails.
+// The entry points of cfg must be those of the active configuration, their listeners are not reopened.
+func (m *RouterManager) Apply(cfg *config.Config) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.apply(cfg); err != nil {
+		return err
+	}
+	if m.updates > 0 {
+		logger.FromContext(m.ctx).Warnf("%d changes of the admin API are discarded by the configuration applied", m.updates)
+		m.updates = 0
+	}
+	return nil
+}
+
+// Update applies a copy of the active configuration modified by fn.
+// The change is kept in memory only, the next configuration applied, such as a file reload, replaces it.
+func (m *RouterManager) Update(fn func(cfg *config.Config) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cfg == nil {
+		return errors.New("no configuration applied")
+	}
+	cfg, err := m.cfg.DeepCopy()
+	if err != nil {
+		return err
+	}
+	if err = fn(cfg); err != nil {
+		return err
+	}
+	if err = m.apply(cfg); err != nil {
+		return err
+	}
+	m.updates++
+	return nil
+}
+
+func (m *RouterManager) apply(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if m.cfg != nil {
+		// the listeners are opened once at startup.
+		if !sameEntryPoints(m.cfg.Spec, cfg.Spec) || !sameEntryPoints(m.cfg.Internal, cfg.Internal) {
+			return errors.New("the entryPoints cannot change without a restart")
+		}
+	}
+	// the round trippers are only kept once the routers using them are switched in.
+	transports, err := m.transports.Prepare(cfg.GetServersTransports())
+	if err != nil {
+		return err
+	}
+	var routing *http.Routing
+	if routing, err = http.BuildRouting(m.ctx, cfg, transports); err != nil {
+		return err
+	}
+	var tcpRouters map[config.ServerName]*tcp.Router
+	if tcpRouters, err = tcp.BuildRouting(m.ctx, cfg.TCP); err != nil {
+		return err
+	}
+	for name := range tcpRouters {
+		if _, ok := m.entryPointList[name]; !ok {
+			return fmt.Errorf("tcp routers attached to entryPoint %s which is not running", name)
+		}
+	}
+	var udpServices map[config.ServerName]*udp.Service
+	if udpServices, err = udp.BuildRouting(cfg.UDP); err != nil {
+		return err
+	}
+	for name := range udpServices {
+		if _, ok := m.entryPointList[name]; !ok {
+			return fmt.Errorf("udp router attached to entryPoint %s which is not running", name)
+		}
+	}
+	if m.routing != nil {
+		routing.CopyBalancerState(m.routing)
+	}
+	routers := make(map[config.ServerName]nethttp.Handler, len(m.entryPointList))
+	for name := range m.entryPointList {
+		routers[name] = routing.Handler
+	}
+	m.entryPointList.Switch(routers)
+	m.entryPointList.SwitchTCP(tcpRouters)
+	m.entryPointList.SwitchUDP(udpServices)
+	m.transports.Commit(transports)
+	m.cfg = cfg
+	m.routing = routing
+	logger.FromContext(m.ctx).Infof("configuration applied with %d routers, %d tcp routers and %d udp routers",
+		len(routing.Routers), len(cfg.TCP), len(cfg.UDP))
+	for _, listener := range m.listeners {
+		listener(cfg)
+	}
+	return nil
+}
+
+// sameEntryPoints reports whether the entry points of a and b are configured alike, the internal entry points
+// without transport get the default one when they are built, so the missing transports are compared as such.
+func sameEntryPoints(a, b config.EntryPointList) bool {
+	encode := func(entryPoints config.EntryPointList) ([]byte, error) {
+		list := make(config.EntryPointList, len(entryPoints))
+		for name, entryPoint := range entryPoints {
+			if entryPoint == nil || entryPoint.Transport != nil {
+				list[name] = entryPoint
+				continue
+			}
+			withTransport := *entryPoint
+			withTransport.Transport = &config.EntryPointsTransport{}
+			withTransport.Transport.SetDefaults()
+			list[name] = &withTransport
+		}
+		return yaml.Marshal(list)
+	}
+	dataA, err := encode(a)
+	if err != nil {
+		return false
+	}
+	var dataB []byte
+	if dataB, err = encode(b); err != nil {
+		return false
+	}
+	return bytes.Equal(dataA, dataB)
+}
+
+// AddListener calls listener with the active configuration and each configuration applied afterwards,
+// listener must not modify it.
+func (m *RouterManager) AddListener(listener func(cfg *config.Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listener)
+	if m.cfg != nil {
+		listener(m.cfg)
+	}
+}
+
+// Config returns the active configuration, it must not be modified.
+func (m *RouterManager) Config() *config.Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cfg
+}
+
+// Routing returns the routers of the active configuration.
+func (m *RouterManager) Routing() *http.Routing {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.routing
+}
+
+// Watch applies the configuration file each time it is written.
+func (m *RouterManager) Watch(path string) {
+	config.FileWatch{Path: path}.WatchConfig(func(fsnotify.Event) {
+		log := logger.FromContext(m.ctx)
+		cfg, err := config.LoadYaml(path)
+		if err != nil {
+			log.Errorf("Error while reloading %s: %v", path, err)
+			return
+		}
+		if err = m.Apply(cfg); err != nil {
+			log.Errorf("Error while applying %s: %v", path, err)
+			return
+		}
+		log.Infof("configuration reloaded from %s", path)
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/23
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/server/http"
+)
+
+func TestApplyValidates(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Spec:      config.EntryPointList{"web": {Port: 8080, Transport: &config.EntryPointsTransport{}}},
+			Internal:  config.EntryPointList{"metrics": {Port: 9090}},
+			Transport: &config.ServersTransport{},
+			List:      []*config.ProxyHost{{Name: "whoami", Origin: []string{"whoami.local"}, Target: []string{"http://127.0.0.1:80"}}},
+		}
+	}
+	manager := NewRouterManager(context.Background(), http.EntryPointList{})
+	if err := manager.Apply(newConfig()); err != nil {
+		t.Fatal(err)
+	}
+	// the internal entry points built at startup get the default transport.
+	manager.Config().Internal["metrics"].Transport = &config.EntryPointsTransport{}
+	manager.Config().Internal["metrics"].Transport.SetDefaults()
+
+	if err := manager.Apply(newConfig()); err != nil {
+		t.Errorf("the same entry points are rejected: %v", err)
+	}
+
+	cfg := newConfig()
+	cfg.TCP = []*config.TCPRouter{{
+		Name:        "db",
+		EntryPoints: []config.ServerName{"web"},
+		HostSNI:     []string{"db.local"},
+		Target:      []string{"127.0.0.1:5432"},
+	}}
+	if err := manager.Apply(cfg); err == nil {
+		t.Error("a tcp router matching a server name without tls is applied")
+	}
+
+	cfg = newConfig()
+	cfg.Spec["web"].Port = 8081
+	if err := manager.Apply(cfg); err == nil {
+		t.Error("an entry point is changed without restart")
+	}
+
+	cfg = newConfig()
+	cfg.Internal["admin"] = &config.EntryPoint{Port: 9091}
+	if err := manager.Apply(cfg); err == nil {
+		t.Error("an internal entry point is added without restart")
+	}
+}
+
+func TestApplyDiscardsUpdates(t *testing.T) {
+	cfg := &config.Config{
+		Transport: &config.ServersTransport{},
+		List:      []*config.ProxyHost{{Name: "whoami", Origin: []string{"whoami.local"}, Target: []string{"http://127.0.0.1:80"}}},
+	}
+	manager := NewRouterManager(context.Background(), http.EntryPointList{})
+	if err := manager.Apply(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Update(func(cfg *config.Config) error {
+		cfg.List[0].Drain = append(cfg.List[0].Drain, "http://127.0.0.1:80")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if manager.updates != 1 {
+		t.Fatalf("got %d updates, want 1", manager.updates)
+	}
+	// the reloaded configuration replaces the drained server, which is reported.
+	if err := manager.Apply(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if manager.updates != 0 || len(manager.Config().List[0].Drain) != 0 {
+		t.Errorf("the update is kept: %d %v", manager.updates, manager.Config().List[0].Drain)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/30
+
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes of the errors of the proxy.
+const (
+	grpcCanceled         = 1
+	grpcUnknown          = 2
+	grpcDeadlineExceeded = 4
+	grpcInternal         = 13
+	grpcUnavailable      = 14
+)
+
+// isGRPC reports whether the request is a gRPC call, application/grpc+proto included.
+func isGRPC(req *http.Request) bool {
+	contentType := req.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/grpc") {
+		return false
+	}
+	return len(contentType) == len("application/grpc") ||
+		contentType[len("application/grpc")] == '+' || contentType[len("application/grpc")] == ';'
+}
+
+// grpcCode maps the status of an error of the proxy to a gRPC status code.
+func grpcCode(statusCode int) int {
+	switch statusCode {
+	case StatusClientClosedRequest:
+		return grpcCanceled
+	case http.StatusGatewayTimeout:
+		return grpcDeadlineExceeded
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return grpcUnavailable
+	case http.StatusInternalServerError:
+		return grpcInternal
+	default:
+		return grpcUnknown
+	}
+}
+
+// writeGRPCError writes a Trailers-Only gRPC response: the status is carried by the headers of an empty 200 response.
+func writeGRPCError(rw http.ResponseWriter, statusCode int) {
+	header := rw.Header()
+	header.Set("Content-Type", "application/grpc")
+	header.Set("Grpc-Status", strconv.Itoa(grpcCode(statusCode)))
+	header.Set("Grpc-Message", encodeGRPCMessage(statusText(statusCode)))
+	rw.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage percent-encodes the message as required by the grpc-message header.
+func encodeGRPCMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
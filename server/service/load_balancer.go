@@ -0,0 +1,71 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/23
+
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/router"
+)
+
+// loadBalancer forwards the requests to the next server of its balancer.
+type loadBalancer struct {
+	name     string
+	balancer router.Balancer
+	servers  map[string]*url.URL
+	next     http.Handler
+}
+
+// NewLoadBalancer creates the handler of a service, next forwards the requests to the url of the chosen server.
+func NewLoadBalancer(name string, balancer router.Balancer, next http.Handler) (http.Handler, error) {
+	states := balancer.ServerStates()
+	servers := make(map[string]*url.URL, len(states))
+	for _, state := range states {
+		u, err := ParseServerURL(state.Host)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		servers[state.Host] = u
+	}
+	return &loadBalancer{
+		name:     name,
+		balancer: balancer,
+		servers:  servers,
+		next:     next,
+	}, nil
+}
+
+func (l *loadBalancer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	server := l.balancer.Next()
+	u, ok := l.servers[server]
+	if !ok {
+		logger.FromContext(req.Context()).Debugf("service %s has no available server", l.name)
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = rw.Write([]byte(http.StatusText(http.StatusServiceUnavailable)))
+		return
+	}
+	req.URL.Scheme = u.Scheme
+	req.URL.Host = u.Host
+	l.next.ServeHTTP(rw, req)
+}
+
+// ParseServerURL parses the url of a server, the http scheme is used when it is missing.
+func ParseServerURL(server string) (*url.URL, error) {
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server %s: %w", server, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid server %s: missing host", server)
+	}
+	return u, nil
+}
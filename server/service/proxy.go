@@ -23,16 +23,33 @@ const StatusClientClosedRequest = 499
 // StatusClientClosedRequestText non-standard HTTP status for client disconnection.
 const StatusClientClosedRequestText = "Client Closed Request"
 
+// BuildProxy creates the reverse proxy forwarding the requests with roundTripper,
+// the responses are flushed every flushInterval, and as soon as they are written for the gRPC calls.
 func BuildProxy(flushInterval time.Duration, roundTripper http.RoundTripper) (http.Handler, error) {
+	bufferPool := newBufferPool()
 	proxy := &httputil.ReverseProxy{
-		Director:      Director,
+		Rewrite:       Rewrite,
 		Transport:     roundTripper,
 		FlushInterval: flushInterval,
-		BufferPool:    newBufferPool(),
+		BufferPool:    bufferPool,
+		ErrorHandler:  ErrorHandler,
+	}
+	// the messages of the gRPC streams must not wait for the next flush.
+	grpcProxy := &httputil.ReverseProxy{
+		Rewrite:       Rewrite,
+		Transport:     roundTripper,
+		FlushInterval: -1,
+		BufferPool:    bufferPool,
 		ErrorHandler:  ErrorHandler,
 	}
 
-	return proxy, nil
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if isGRPC(req) {
+			grpcProxy.ServeHTTP(rw, req)
+			return
+		}
+		proxy.ServeHTTP(rw, req)
+	}), nil
 }
 
 func statusText(statusCode int) string {
@@ -61,15 +78,37 @@ func ErrorHandler(w http.ResponseWriter, request *http.Request, err error) {
 		}
 	}
 
-	logger.Debugf("url:%+v '%d %s' caused by: %v",
+	log := logger.FromContext(request.Context())
+	log.Debugf("url:%+v '%d %s' caused by: %v",
 		request,
 		statusCode, statusText(statusCode), err)
+	if isGRPC(request) {
+		// a gRPC client expects the status in grpc-status, not in a plain-text body.
+		writeGRPCError(w, statusCode)
+		return
+	}
 	w.WriteHeader(statusCode)
 	if _, err = w.Write([]byte(statusText(statusCode))); err != nil {
-		logger.Errorf("Error while writing status code", err)
+		log.Errorf("Error while writing status code: %v", err)
+	}
+}
+
+// forwardedHeaders are set by the forwardedheaders middleware of the entry points,
+// Rewrite keeps them where ReverseProxy would drop or append to them.
+var forwardedHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto"}
+
+// Rewrite forwards the request as Director, with the forwarded headers of the incoming request.
+func Rewrite(proxyRequest *httputil.ProxyRequest) {
+	for _, header := range forwardedHeaders {
+		if values, ok := proxyRequest.In.Header[header]; ok {
+			proxyRequest.Out.Header[header] = values
+		}
 	}
+	Director(proxyRequest.Out)
 }
 
+// Director keeps the scheme and the host of the backend set on request.URL by the previous handlers,
+// only the path and the query are taken from the raw request uri.
 func Director(request *http.Request) {
 	u := request.URL
 	if request.RequestURI != "" {
@@ -78,8 +117,11 @@ func Director(request *http.Request) {
 			u = parsedURL
 		}
 	}
-	request.URL = u
-	request.RequestURI = u.RequestURI()
+	request.URL.Path = u.Path
+	request.URL.RawPath = u.RawPath
+	request.URL.RawQuery = u.RawQuery
+	// Outgoing request should not have RequestURI
+	request.RequestURI = ""
 
 	if _, ok := request.Header["User-Agent"]; !ok {
 		request.Header.Set("User-Agent", "")
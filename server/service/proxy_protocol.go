@@ -0,0 +1,66 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/3
+
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/crochee/proxy/util/proxyprotocol"
+)
+
+type clientAddrsKey struct{}
+
+// clientAddrs holds the addresses of the connection of the client of a request.
+type clientAddrs struct {
+	src net.Addr
+	dst net.Addr
+}
+
+// proxyProtocolRoundTripper passes the addresses of the clients to the dialer of the transport,
+// which sends them in the PROXY protocol header of the connections.
+type proxyProtocolRoundTripper struct {
+	http.RoundTripper
+}
+
+func (rt *proxyProtocolRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	addrs := clientAddrs{src: parseTCPAddr(req.RemoteAddr)}
+	addrs.dst, _ = req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return rt.RoundTripper.RoundTrip(req.WithContext(context.WithValue(req.Context(), clientAddrsKey{}, addrs)))
+}
+
+// dialProxyProtocol sends the PROXY protocol header of the given version on the connections of dial,
+// the connections dialed without client addresses send a header without address.
+func dialProxyProtocol(dial func(ctx context.Context, network, addr string) (net.Conn, error),
+	version int) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, _ := ctx.Value(clientAddrsKey{}).(clientAddrs)
+		if err = proxyprotocol.WriteHeader(conn, version, addrs.src, addrs.dst); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// parseTCPAddr parses the ip:port of the RemoteAddr of a request, nil when it is not one.
+func parseTCPAddr(address string) net.Addr {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	p, err := strconv.Atoi(port)
+	if ip == nil || err != nil {
+		return nil
+	}
+	return &net.TCPAddr{IP: ip, Port: p}
+}
@@ -0,0 +1,51 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/3
+
+package service
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/util/proxyprotocol"
+)
+
+func TestRoundTripperProxyProtocol(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(req.RemoteAddr))
+	}))
+	listener, err := proxyprotocol.NewListener(server.Listener, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	for _, version := range []int{1, 2} {
+		rt, err := CreateRoundTripper(&config.ServersTransport{
+			ProxyProtocol: &config.ProxyProtocolHeader{Version: version},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the connections are not shared between the clients.
+		for _, client := range []string{"192.0.2.1:51234", "[2001:db8::1]:51234"} {
+			req := httptest.NewRequest(http.MethodGet, server.URL, nil)
+			req.RemoteAddr = client
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != client {
+				t.Errorf("v%d: the server sees %s, want %s", version, body, client)
+			}
+		}
+	}
+}
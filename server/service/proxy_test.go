@@ -0,0 +1,198 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/30
+
+package service
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/crochee/proxy/config"
+)
+
+// grpcFrame prefixes the message with the gRPC length-prefixed framing.
+func grpcFrame(message string) []byte {
+	frame := make([]byte, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(message)))
+	copy(frame[5:], message)
+	return frame
+}
+
+// newGRPCFrontend serves over TLS and HTTP/2 the proxy forwarding to backend with an h2c transport.
+func newGRPCFrontend(t *testing.T, backend string) *httptest.Server {
+	t.Helper()
+	rt, err := CreateRoundTripper(&config.ServersTransport{Protocol: config.ProtocolH2C})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := BuildProxy(time.Minute, rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontend := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		req.URL.Scheme = u.Scheme
+		req.URL.Host = u.Host
+		proxy.ServeHTTP(rw, req)
+	}))
+	frontend.EnableHTTP2 = true
+	frontend.StartTLS()
+	t.Cleanup(frontend.Close)
+	return frontend
+}
+
+func TestProxyGRPCStream(t *testing.T) {
+	// the backend echoes each message as soon as it is received, then ends the stream with its status.
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor != 2 {
+			t.Errorf("the backend received %s, want HTTP/2", req.Proto)
+		}
+		rw.Header().Set("Content-Type", "application/grpc")
+		rw.Header().Set("Trailer", "Grpc-Status")
+		rw.WriteHeader(http.StatusOK)
+		rw.(http.Flusher).Flush()
+		header := make([]byte, 5)
+		for {
+			if _, err := io.ReadFull(req.Body, header); err != nil {
+				break
+			}
+			message := make([]byte, binary.BigEndian.Uint32(header[1:]))
+			if _, err := io.ReadFull(req.Body, message); err != nil {
+				break
+			}
+			_, _ = rw.Write(grpcFrame(string(message)))
+			rw.(http.Flusher).Flush()
+		}
+		rw.Header().Set("Grpc-Status", "0")
+	}), &http2.Server{}))
+	defer backend.Close()
+	frontend := newGRPCFrontend(t, backend.URL)
+
+	body, writer := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, frontend.URL+"/echo.Echo/Stream", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	resp, err := frontend.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// each message is echoed before the next one is sent, the stream is not buffered in either direction.
+	for _, message := range []string{"ping", "pong"} {
+		done := make(chan error, 1)
+		go func() {
+			_, err := writer.Write(grpcFrame(message))
+			done <- err
+		}()
+		echo := make([]byte, 5+len(message))
+		if _, err = io.ReadFull(resp.Body, echo); err != nil {
+			t.Fatal(err)
+		}
+		if string(echo[5:]) != message {
+			t.Errorf("got the message %q, want %q", echo[5:], message)
+		}
+		if err = <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+	if _, err = ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if status := resp.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Errorf("got the trailer grpc-status %q, want 0", status)
+	}
+}
+
+func TestProxyGRPCError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing listens on the backend address.
+	backend := "http://" + listener.Addr().String()
+	listener.Close()
+	frontend := newGRPCFrontend(t, backend)
+
+	for contentType, want := range map[string]string{
+		"application/grpc":       "14",
+		"application/grpc+proto": "14",
+		"application/json":       "",
+	} {
+		req, err := http.NewRequest(http.MethodPost, frontend.URL+"/echo.Echo/Unary", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		resp, err := frontend.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want == "" {
+			if resp.StatusCode != http.StatusBadGateway {
+				t.Errorf("%s: got the status %d, want %d", contentType, resp.StatusCode, http.StatusBadGateway)
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Grpc-Status") != want ||
+			resp.Header.Get("Grpc-Message") != "Bad Gateway" {
+			t.Errorf("%s: got the status %d, grpc-status %q and grpc-message %q, want 200, %s and Bad Gateway",
+				contentType, resp.StatusCode, resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message"), want)
+		}
+	}
+}
+
+func TestProxyForwardedHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(req.Header.Get("X-Forwarded-For") + "|" + req.Header.Get("Forwarded")))
+	}))
+	defer backend.Close()
+	rt, err := CreateRoundTripper(&config.ServersTransport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := BuildProxy(time.Minute, rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, header := range []http.Header{
+		{},
+		{"X-Forwarded-For": {"192.0.2.1, 10.0.0.1"}, "Forwarded": {"for=192.0.2.1, for=10.0.0.1"}},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:51234"
+		req.Header = header.Clone()
+		req.URL.Scheme = u.Scheme
+		req.URL.Host = u.Host
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		// the forwarded headers are those of the forwardedheaders middleware, the client is not appended again.
+		if want := header.Get("X-Forwarded-For") + "|" + header.Get("Forwarded"); rw.Body.String() != want {
+			t.Errorf("got %q, want %q", rw.Body.String(), want)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/crochee/proxy/config"
 	"github.com/crochee/proxy/logger"
 	tls2 "github.com/crochee/proxy/tls"
+	"github.com/crochee/proxy/tracing"
 )
 
 // CreateRoundTripper creates an http.RoundTripper configured with the Transport configuration settings.
@@ -25,6 +26,9 @@ func CreateRoundTripper(cfg *config.ServersTransport) (http.RoundTripper, error)
 	if cfg == nil {
 		return nil, errors.New("no transport configuration given")
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 
 	dialer := &net.Dialer{
 		Timeout:   30 * time.Second,
@@ -37,7 +41,6 @@ func CreateRoundTripper(cfg *config.ServersTransport) (http.RoundTripper, error)
 	transport := &http.Transport{
 		Proxy:                 http.ProxyFromEnvironment,
 		DialContext:           dialer.DialContext,
-		ForceAttemptHTTP2:     true,
 		MaxIdleConnsPerHost:   cfg.MaxIdleConnPerHost,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
@@ -58,7 +61,22 @@ func CreateRoundTripper(cfg *config.ServersTransport) (http.RoundTripper, error)
 		}
 	}
 
-	return newSmartRoundTripper(transport)
+	protocol := cfg.Protocol
+	if cfg.ProxyProtocol != nil {
+		// a connection carries the requests of the client of its header only.
+		transport.DialContext = dialProxyProtocol(transport.DialContext, cfg.ProxyProtocol.GetVersion())
+		transport.DisableKeepAlives = true
+		protocol = config.ProtocolHTTP1
+	}
+
+	rt, err := newSmartRoundTripper(transport, protocol)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ProxyProtocol != nil {
+		rt = &proxyProtocolRoundTripper{RoundTripper: rt}
+	}
+	return tracing.NewTransport(rt), nil
 }
 
 func createRootCACertPool(rootCAs []tls2.FileOrContent) *x509.CertPool {
@@ -0,0 +1,103 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/29
+
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/crochee/proxy/config"
+)
+
+// closeGraceDelay is how long after a round tripper is dropped its idle connections are closed again.
+const closeGraceDelay = time.Minute
+
+// RoundTripperManager holds a round tripper per servers transport,
+// a round tripper is kept across the reloads until the configuration of its transport changes.
+type RoundTripperManager struct {
+	mu      sync.Mutex
+	current *RoundTrippers
+}
+
+// NewRoundTripperManager creates a RoundTripperManager without transport.
+func NewRoundTripperManager() *RoundTripperManager {
+	return &RoundTripperManager{current: newRoundTrippers(0)}
+}
+
+// Prepare creates the round trippers of the new and the modified transports and reuses those of the others,
+// the manager is left untouched until the returned round trippers are passed to Commit.
+func (m *RoundTripperManager) Prepare(transports map[string]*config.ServersTransport) (*RoundTrippers, error) {
+	m.mu.Lock()
+	current := m.current
+	m.mu.Unlock()
+	prepared := newRoundTrippers(len(transports))
+	for name, cfg := range transports {
+		if previous, ok := current.configs[name]; ok && reflect.DeepEqual(previous, cfg) {
+			prepared.configs[name] = previous
+			prepared.roundTrippers[name] = current.roundTrippers[name]
+			continue
+		}
+		rt, err := CreateRoundTripper(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("serversTransport %s: %w", name, err)
+		}
+		prepared.configs[name] = cfg
+		prepared.roundTrippers[name] = rt
+	}
+	return prepared, nil
+}
+
+// Commit keeps the prepared round trippers once their configuration is applied,
+// the idle connections of the round trippers they replace are closed.
+func (m *RoundTripperManager) Commit(prepared *RoundTrippers) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, rt := range m.current.roundTrippers {
+		if prepared.roundTrippers[name] != rt {
+			closeIdleConnections(rt)
+		}
+	}
+	m.current = prepared
+}
+
+// RoundTrippers are the round trippers of the servers transports of a configuration.
+type RoundTrippers struct {
+	configs       map[string]*config.ServersTransport
+	roundTrippers map[string]http.RoundTripper
+}
+
+func newRoundTrippers(size int) *RoundTrippers {
+	return &RoundTrippers{
+		configs:       make(map[string]*config.ServersTransport, size),
+		roundTrippers: make(map[string]http.RoundTripper, size),
+	}
+}
+
+// Get returns the round tripper of the transport, DefaultServersTransport when name is empty.
+func (r *RoundTrippers) Get(name string) (http.RoundTripper, error) {
+	if name == "" {
+		name = config.DefaultServersTransport
+	}
+	rt, ok := r.roundTrippers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown serversTransport %s", name)
+	}
+	return rt, nil
+}
+
+// closeIdleConnections closes the idle connections of a dropped round tripper.
+// The connections in use go back to its idle pool once their request ends, they are closed
+// closeGraceDelay later, or after the IdleConnTimeout of the transport for the longer requests.
+func closeIdleConnections(rt http.RoundTripper) {
+	closer, ok := rt.(interface{ CloseIdleConnections() })
+	if !ok {
+		return
+	}
+	closer.CloseIdleConnections()
+	time.AfterFunc(closeGraceDelay, closer.CloseIdleConnections)
+}
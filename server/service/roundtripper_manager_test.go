@@ -0,0 +1,79 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/29
+
+package service
+
+import (
+	"testing"
+
+	"github.com/crochee/proxy/config"
+)
+
+func TestRoundTripperManager(t *testing.T) {
+	manager := NewRoundTripperManager()
+	prepared, err := manager.Prepare(map[string]*config.ServersTransport{
+		config.DefaultServersTransport: {MaxIdleConnPerHost: 10},
+		"internal":                     {ServerName: "internal.example.com", InsecureSkipVerify: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Commit(prepared)
+	defaultRT, err := prepared.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	internalRT, err := prepared.Get("internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaultRT == internalRT {
+		t.Fatal("the transports share their round tripper")
+	}
+
+	// a reload builds new configurations, only the modified transport is rebuilt.
+	if prepared, err = manager.Prepare(map[string]*config.ServersTransport{
+		config.DefaultServersTransport: {MaxIdleConnPerHost: 10},
+		"internal":                     {ServerName: "internal.example.com"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if rt, _ := prepared.Get(config.DefaultServersTransport); rt != defaultRT {
+		t.Error("the unchanged transport was rebuilt")
+	}
+	if rt, _ := prepared.Get("internal"); rt == internalRT {
+		t.Error("the modified transport was not rebuilt")
+	}
+
+	// the prepared round trippers are only kept once committed.
+	if prepared, err = manager.Prepare(map[string]*config.ServersTransport{
+		config.DefaultServersTransport: {MaxIdleConnPerHost: 10},
+		"internal":                     {ServerName: "internal.example.com", InsecureSkipVerify: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if rt, _ := prepared.Get("internal"); rt != internalRT {
+		t.Error("a reload compares with a configuration which was not committed")
+	}
+
+	if _, err = manager.Prepare(map[string]*config.ServersTransport{
+		config.DefaultServersTransport: {MaxIdleConnPerHost: 20},
+		"broken":                       nil,
+	}); err == nil {
+		t.Fatal("expected an error for an empty transport")
+	}
+
+	if prepared, err = manager.Prepare(map[string]*config.ServersTransport{
+		config.DefaultServersTransport: {MaxIdleConnPerHost: 10},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	manager.Commit(prepared)
+	if _, err = prepared.Get("internal"); err == nil {
+		t.Error("the removed transport is still available")
+	}
+	if rt, _ := prepared.Get(config.DefaultServersTransport); rt != defaultRT {
+		t.Error("the unchanged transport was rebuilt")
+	}
+}
@@ -5,38 +5,74 @@
 package service
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
 
 	"golang.org/x/net/http/httpguts"
 	"golang.org/x/net/http2"
+
+	"github.com/crochee/proxy/config"
 )
 
-func newSmartRoundTripper(transport *http.Transport) (http.RoundTripper, error) {
+func newSmartRoundTripper(transport *http.Transport, protocol string) (http.RoundTripper, error) {
 	transportHTTP1 := transport.Clone()
+	// the HTTP/1.1 transport never negotiates HTTP/2, even when its TLS configuration offers it.
+	transportHTTP1.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	if protocol == config.ProtocolHTTP1 {
+		return &smartRoundTripper{http: transportHTTP1}, nil
+	}
 
 	err := http2.ConfigureTransport(transport)
 	if err != nil {
 		return nil, err
 	}
-
-	return &smartRoundTripper{
+	rt := &smartRoundTripper{
 		http2: transport,
 		http:  transportHTTP1,
-	}, nil
+	}
+	if protocol == config.ProtocolH2C {
+		rt.h2c = &http2.Transport{
+			AllowHTTP: true,
+			// h2c dials a cleartext connection where http2 expects a TLS one.
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return transport.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	return rt, nil
 }
 
+// smartRoundTripper sends the requests over HTTP/2 when the protocol of the transport allows it.
 type smartRoundTripper struct {
+	// http2 negotiates HTTP/2 with the TLS servers, nil when the transport only speaks HTTP/1.1.
 	http2 *http.Transport
-	http  *http.Transport
+	// h2c speaks HTTP/2 with prior knowledge to the cleartext servers, nil unless the protocol is h2c.
+	h2c  *http2.Transport
+	http *http.Transport
 }
 
 // smartRoundTripper implements RoundTrip while making sure that HTTP/2 is not used
 // with protocols that start with a Connection Upgrade, such as SPDY or Websocket.
 func (m *smartRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	// If we have a connection upgrade, we don't use HTTP/2
-	if !httpguts.HeaderValuesContainsToken(req.Header["Connection"], "Upgrade") {
+	if m.http2 == nil || httpguts.HeaderValuesContainsToken(req.Header["Connection"], "Upgrade") {
 		return m.http.RoundTrip(req)
 	}
-
+	if m.h2c != nil && req.URL.Scheme == "http" {
+		return m.h2c.RoundTrip(req)
+	}
 	return m.http2.RoundTrip(req)
 }
+
+// CloseIdleConnections closes the idle connections of the transports.
+func (m *smartRoundTripper) CloseIdleConnections() {
+	m.http.CloseIdleConnections()
+	if m.http2 != nil {
+		m.http2.CloseIdleConnections()
+	}
+	if m.h2c != nil {
+		m.h2c.CloseIdleConnections()
+	}
+}
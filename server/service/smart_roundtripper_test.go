@@ -0,0 +1,122 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/29
+
+package service
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/crochee/proxy/config"
+	tls2 "github.com/crochee/proxy/tls"
+)
+
+func TestSmartRoundTripperProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(req.Proto))
+	})
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	// the cleartext server speaks HTTP/1.1 and h2c with prior knowledge.
+	cleartextServer := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer cleartextServer.Close()
+	rootCA := tls2.FileOrContent(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw}))
+
+	tests := []struct {
+		name     string
+		protocol string
+		url      string
+		upgrade  bool
+		want     string
+	}{
+		{name: "default over TLS", url: tlsServer.URL, want: "HTTP/2.0"},
+		{name: "default cleartext", url: cleartextServer.URL, want: "HTTP/1.1"},
+		{name: "http1 over TLS", protocol: config.ProtocolHTTP1, url: tlsServer.URL, want: "HTTP/1.1"},
+		{name: "http2 over TLS", protocol: config.ProtocolHTTP2, url: tlsServer.URL, want: "HTTP/2.0"},
+		{name: "http2 cleartext", protocol: config.ProtocolHTTP2, url: cleartextServer.URL, want: "HTTP/1.1"},
+		{name: "h2c cleartext", protocol: config.ProtocolH2C, url: cleartextServer.URL, want: "HTTP/2.0"},
+		{name: "h2c over TLS", protocol: config.ProtocolH2C, url: tlsServer.URL, want: "HTTP/2.0"},
+		{name: "upgrade over TLS", protocol: config.ProtocolHTTP2, url: tlsServer.URL, upgrade: true, want: "HTTP/1.1"},
+		{name: "upgrade cleartext", protocol: config.ProtocolH2C, url: cleartextServer.URL, upgrade: true, want: "HTTP/1.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt, err := CreateRoundTripper(&config.ServersTransport{
+				RootCAs:  []tls2.FileOrContent{rootCA},
+				Protocol: test.protocol,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
+			req.RequestURI = ""
+			if test.upgrade {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+			}
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != test.want {
+				t.Errorf("the server received %s, want %s", body, test.want)
+			}
+		})
+	}
+}
+
+func TestSmartRoundTripperH2CDialContext(t *testing.T) {
+	// the dial blocks until the request is cancelled.
+	rt, err := newSmartRoundTripper(&http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}, config.ProtocolH2C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://192.0.2.1/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := rt.RoundTrip(req)
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want the deadline of the request", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the h2c dial ignores the context of the request")
+	}
+}
+
+func TestCreateRoundTripperUnknownProtocol(t *testing.T) {
+	if _, err := CreateRoundTripper(&config.ServersTransport{Protocol: "spdy"}); err == nil {
+		t.Error("expected an error for an unknown protocol")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/1
+
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+)
+
+const (
+	recordTypeHandshake = 0x16
+	recordHeaderLen     = 5
+	// maxRecordLen is the length of the largest plaintext TLS record with its header.
+	maxRecordLen = recordHeaderLen + 16384
+)
+
+// errHelloRead stops the handshake once the ClientHello is parsed.
+var errHelloRead = errors.New("client hello read")
+
+// clientHelloServerName peeks the first TLS record of br and returns the server name of its ClientHello,
+// isTLS is false when the connection does not start with a TLS handshake.
+func clientHelloServerName(br *bufio.Reader) (serverName string, isTLS bool, err error) {
+	header, err := br.Peek(1)
+	if err != nil {
+		return "", false, err
+	}
+	if header[0] != recordTypeHandshake {
+		return "", false, nil
+	}
+	if header, err = br.Peek(recordHeaderLen); err != nil {
+		return "", false, err
+	}
+	recordLen := int(header[3])<<8 | int(header[4])
+	var record []byte
+	if record, err = br.Peek(recordHeaderLen + recordLen); err != nil {
+		return "", true, err
+	}
+	// crypto/tls parses the ClientHello, the handshake stops before anything is written.
+	_ = tls.Server(helloConn{r: bytes.NewReader(record)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	return serverName, true, nil
+}
+
+// helloConn reads a ClientHello, nothing can be written to it.
+type helloConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c helloConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (helloConn) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
@@ -0,0 +1,34 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/1
+
+// Package tcp routes the TCP connections of the entry points to their servers.
+package tcp
+
+import (
+	"io"
+	"net"
+)
+
+// WriteCloser is a connection which can be half-closed.
+type WriteCloser interface {
+	net.Conn
+	// CloseWrite closes the writing side of the connection, the peer reads io.EOF.
+	CloseWrite() error
+}
+
+// Handler serves the TCP connections.
+type Handler interface {
+	// ServeTCP serves conn until it is done with it, conn is then closed.
+	ServeTCP(conn WriteCloser)
+}
+
+// peekedConn replays the bytes read ahead to route the connection before reading the connection itself.
+type peekedConn struct {
+	WriteCloser
+	r io.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
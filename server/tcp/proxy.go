@@ -0,0 +1,144 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/1
+
+package tcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/router"
+	"github.com/crochee/proxy/util/proxyprotocol"
+)
+
+const (
+	dialTimeout = 30 * time.Second
+	bufferSize  = 32 * 1024
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return make([]byte, bufferSize)
+	},
+}
+
+// Proxy forwards the connections to the next server of its balancer.
+type Proxy struct {
+	ctx         context.Context
+	name        string
+	balancer    router.Balancer
+	idleTimeout time.Duration
+	// proxyProtocol is the version of the PROXY protocol header sent to the servers, 0 sends none.
+	proxyProtocol int
+}
+
+// NewProxy creates the handler of a TCP service,
+// the connections without traffic in either direction during idleTimeout are closed.
+// The servers receive a PROXY protocol header of the proxyProtocol version unless it is 0.
+func NewProxy(ctx context.Context, name string, balancer router.Balancer, idleTimeout time.Duration,
+	proxyProtocol int) *Proxy {
+	return &Proxy{
+		ctx:           ctx,
+		name:          name,
+		balancer:      balancer,
+		idleTimeout:   idleTimeout,
+		proxyProtocol: proxyProtocol,
+	}
+}
+
+func (p *Proxy) ServeTCP(conn WriteCloser) {
+	defer conn.Close()
+	log := logger.FromContext(p.ctx)
+	server := p.balancer.Next()
+	if server == "" {
+		log.Debugf("tcp service %s has no available server", p.name)
+		return
+	}
+	backend, err := net.DialTimeout("tcp", server, dialTimeout)
+	if err != nil {
+		log.Errorf("tcp service %s: error dialing %s: %v", p.name, server, err)
+		return
+	}
+	defer backend.Close()
+	if p.proxyProtocol != 0 {
+		if err = proxyprotocol.WriteHeader(backend, p.proxyProtocol, conn.RemoteAddr(), conn.LocalAddr()); err != nil {
+			log.Errorf("tcp service %s: error sending the PROXY protocol header to %s: %v", p.name, server, err)
+			return
+		}
+	}
+	p.pipe(conn, backend.(WriteCloser))
+}
+
+// pipe copies the bytes in both directions until both of them are closed,
+// the end of one direction is forwarded as a half-close.
+func (p *Proxy) pipe(client, backend WriteCloser) {
+	idle := &idleTimer{timeout: p.idleTimeout}
+	idle.touch()
+	errCh := make(chan error, 2)
+	go func() { errCh <- idle.copy(backend, client) }()
+	go func() { errCh <- idle.copy(client, backend) }()
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; err != nil {
+			// the connections are closed by the caller, which stops the other direction.
+			logger.FromContext(p.ctx).Debugf("tcp service %s: %v", p.name, err)
+			return
+		}
+	}
+}
+
+// idleTimer tracks the last activity of both directions of a connection.
+type idleTimer struct {
+	timeout time.Duration
+	last    int64
+}
+
+func (t *idleTimer) touch() {
+	atomic.StoreInt64(&t.last, time.Now().UnixNano())
+}
+
+// expired reports whether neither direction has seen any traffic during the timeout.
+func (t *idleTimer) expired() bool {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&t.last))) >= t.timeout
+}
+
+// copy copies src to dst until src ends, which then half-closes dst.
+func (t *idleTimer) copy(dst, src WriteCloser) error {
+	buf := bufferPool.Get().([]byte)
+	defer bufferPool.Put(buf)
+	for {
+		if t.timeout > 0 {
+			_ = src.SetReadDeadline(time.Now().Add(t.timeout))
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			t.touch()
+			if t.timeout > 0 {
+				_ = dst.SetWriteDeadline(time.Now().Add(t.timeout))
+			}
+			if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+			t.touch()
+		}
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			_ = dst.CloseWrite()
+			return nil
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && !t.expired() {
+			// the other direction is active.
+			continue
+		}
+		return err
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/1
+
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/router"
+)
+
+// Router matches the connections of an entry point to the TCP routers attached to it.
+type Router struct {
+	// routes holds the routes of the lowercase server names.
+	routes map[string]*route
+	// catchAllTLS receives the TLS connections matching no server name.
+	catchAllTLS *route
+	// catchAll receives the connections matching no other route.
+	catchAll *route
+}
+
+type route struct {
+	name    string
+	handler Handler
+	// tls restricts the route to the TLS connections, terminated by the entry point when terminate is set.
+	tls       bool
+	terminate bool
+}
+
+// NewRouter creates a Router without routes, every connection goes to the HTTP routers.
+func NewRouter() *Router {
+	return &Router{routes: make(map[string]*route)}
+}
+
+// Empty reports whether the router has no routes.
+func (r *Router) Empty() bool {
+	return len(r.routes) == 0 && r.catchAllTLS == nil && r.catchAll == nil
+}
+
+// needPeek reports whether the first bytes of the connections must be read to route them.
+func (r *Router) needPeek() bool {
+	return len(r.routes) != 0 || r.catchAllTLS != nil
+}
+
+// match returns the route of a connection, nil when it goes to the HTTP routers.
+func (r *Router) match(serverName string, isTLS bool) *route {
+	if isTLS {
+		if rt, ok := r.routes[strings.ToLower(serverName)]; ok {
+			return rt
+		}
+		if r.catchAllTLS != nil {
+			return r.catchAllTLS
+		}
+	}
+	return r.catchAll
+}
+
+func (r *Router) add(serverName string, rt *route) error {
+	switch {
+	case serverName != config.HostSNICatchAll:
+		serverName = strings.ToLower(serverName)
+		if other, ok := r.routes[serverName]; ok {
+			return fmt.Errorf("hostSNI %s of tcp router %s is already routed by %s", serverName, rt.name, other.name)
+		}
+		r.routes[serverName] = rt
+	case rt.tls:
+		if r.catchAllTLS != nil {
+			return fmt.Errorf("tcp router %s: TLS catch-all is already routed by %s", rt.name, r.catchAllTLS.name)
+		}
+		r.catchAllTLS = rt
+	default:
+		if r.catchAll != nil {
+			return fmt.Errorf("tcp router %s: catch-all is already routed by %s", rt.name, r.catchAll.name)
+		}
+		r.catchAll = rt
+	}
+	return nil
+}
+
+// BuildRouting builds the routers of the entry points the TCP routers are attached to.
+func BuildRouting(ctx context.Context, tcpRouters []*config.TCPRouter) (map[config.ServerName]*Router, error) {
+	routers := make(map[config.ServerName]*Router)
+	for _, tcpRouter := range tcpRouters {
+		balancer, err := router.NewTCPBalancer(tcpRouter)
+		if err != nil {
+			return nil, fmt.Errorf("tcp router %s: %w", tcpRouter.Name, err)
+		}
+		var proxyProtocol int
+		if tcpRouter.ProxyProtocol != nil {
+			proxyProtocol = tcpRouter.ProxyProtocol.GetVersion()
+		}
+		rt := &route{
+			name:      tcpRouter.Name,
+			handler:   NewProxy(ctx, tcpRouter.Name, balancer, tcpRouter.GetIdleTimeout(), proxyProtocol),
+			tls:       tcpRouter.TLS != nil,
+			terminate: tcpRouter.Terminates(),
+		}
+		for _, entryPoint := range tcpRouter.EntryPoints {
+			r, ok := routers[entryPoint]
+			if !ok {
+				r = NewRouter()
+				routers[entryPoint] = r
+			}
+			for _, serverName := range tcpRouter.HostSNI {
+				if err = r.add(serverName, rt); err != nil {
+					return nil, fmt.Errorf("entryPoint %s: %w", entryPoint, err)
+				}
+			}
+		}
+	}
+	return routers, nil
+}
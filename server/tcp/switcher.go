@@ -0,0 +1,169 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/1
+
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/crochee/proxy/logger"
+)
+
+const (
+	// firstByteTimeout is how long a connection may stay silent before it goes to the catch-all router,
+	// the clients of the server-first protocols send nothing before the server.
+	firstByteTimeout = time.Second
+	// helloTimeout bounds the reading of the ClientHello and the TLS handshakes.
+	helloTimeout = 10 * time.Second
+)
+
+// Switcher serves the connections of an entry point with its current TCP router,
+// the connections matching no TCP router are given back to the HTTP server.
+type Switcher struct {
+	ctx       context.Context
+	lock      sync.RWMutex
+	router    *Router
+	tlsConfig *tls.Config
+	mu        sync.Mutex
+	// conns holds the connections served by the TCP routers.
+	conns map[net.Conn]struct{}
+}
+
+// NewSwitcher creates a Switcher giving every connection back to the HTTP server until a router is set.
+func NewSwitcher(ctx context.Context) *Switcher {
+	return &Switcher{
+		ctx:    ctx,
+		router: NewRouter(),
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// UpdateRouter safely switches the current router with a new one.
+func (s *Switcher) UpdateRouter(router *Router) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.router = router
+}
+
+// GetRouter returns the current router.
+func (s *Switcher) GetRouter() *Router {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.router
+}
+
+// SetTLSConfig sets the configuration terminating the TLS connections,
+// it must be called before the connections are served.
+func (s *Switcher) SetTLSConfig(tlsConfig *tls.Config) {
+	s.tlsConfig = tlsConfig
+}
+
+// ServeConn serves conn with the current router, fallback serves it when it matches no TCP router.
+func (s *Switcher) ServeConn(conn net.Conn, fallback func(net.Conn)) {
+	router := s.GetRouter()
+	wc, ok := conn.(WriteCloser)
+	if router.Empty() || !ok {
+		fallback(conn)
+		return
+	}
+	go s.serve(router, wc, fallback)
+}
+
+func (s *Switcher) serve(router *Router, conn WriteCloser, fallback func(net.Conn)) {
+	log := logger.FromContext(s.ctx)
+	var (
+		serverName string
+		isTLS      bool
+	)
+	if router.needPeek() {
+		br := bufio.NewReaderSize(conn, maxRecordLen)
+		var err error
+		if serverName, isTLS, err = readClientHello(conn, br, router.catchAll != nil); err != nil {
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() || br.Buffered() != 0 || router.catchAll == nil {
+				log.Debugf("Error while reading the first bytes of %s: %v", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+		}
+		conn = &peekedConn{WriteCloser: conn, r: br}
+	}
+	rt := router.match(serverName, isTLS)
+	if rt == nil {
+		fallback(conn)
+		return
+	}
+	if rt.terminate {
+		if s.tlsConfig == nil {
+			log.Errorf("tcp router %s: the entry point has no certificates to terminate TLS", rt.name)
+			conn.Close()
+			return
+		}
+		tlsConn := tls.Server(conn, s.tlsConfig)
+		_ = tlsConn.SetDeadline(time.Now().Add(helloTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			log.Debugf("tcp router %s: TLS handshake error from %s: %v", rt.name, conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		_ = tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+	s.track(conn, true)
+	defer s.track(conn, false)
+	rt.handler.ServeTCP(conn)
+}
+
+// readClientHello waits for the first bytes of conn, only a second when it may be of a server-first protocol,
+// then reads its ClientHello when it is a TLS connection.
+func readClientHello(conn net.Conn, br *bufio.Reader, serverFirst bool) (serverName string, isTLS bool, err error) {
+	timeout := helloTimeout
+	if serverFirst {
+		timeout = firstByteTimeout
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	if _, err = br.Peek(1); err == nil {
+		_ = conn.SetReadDeadline(time.Now().Add(helloTimeout))
+		serverName, isTLS, err = clientHelloServerName(br)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	return serverName, isTLS, err
+}
+
+func (s *Switcher) track(conn net.Conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		s.conns[conn] = struct{}{}
+	} else {
+		delete(s.conns, conn)
+	}
+}
+
+// Shutdown waits for the connections served by the TCP routers to end, those left are closed once ctx is done.
+func (s *Switcher) Shutdown(ctx context.Context) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		if len(s.conns) == 0 || ctx.Err() != nil {
+			for conn := range s.conns {
+				conn.Close()
+			}
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
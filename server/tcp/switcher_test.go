@@ -0,0 +1,199 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/1
+
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/tls/generate"
+)
+
+func newCertificate(t *testing.T, domain string) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM, err := generate.KeyPair(domain, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+// echoServer answers "echo:" followed by what it read once the client has half-closed the connection.
+func echoServer(t *testing.T, tlsConfig *tls.Config) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				data, _ := ioutil.ReadAll(conn)
+				_, _ = conn.Write(append([]byte("echo:"), data...))
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// frontend serves with switcher the connections of a listener, those matching no router are answered "http".
+func frontend(t *testing.T, switcher *Switcher) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			switcher.ServeConn(conn, func(conn net.Conn) {
+				_, _ = conn.Write([]byte("http"))
+				conn.Close()
+			})
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// exchange sends message on conn, half-closes it and returns the answer.
+func exchange(t *testing.T, conn WriteCloser, message string) string {
+	t.Helper()
+	defer conn.Close()
+	if _, err := conn.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(answer)
+}
+
+func TestSwitcherSNI(t *testing.T) {
+	passthroughServer := echoServer(t, &tls.Config{Certificates: []tls.Certificate{newCertificate(t, "db.example.com")}})
+	plainServer := echoServer(t, nil)
+	routers, err := BuildRouting(context.Background(), []*config.TCPRouter{
+		{
+			Name:        "db",
+			EntryPoints: []config.ServerName{"websecure"},
+			HostSNI:     []string{"db.example.com"},
+			TLS:         &config.TCPRouterTLS{Passthrough: true},
+			Target:      []string{passthroughServer},
+		},
+		{
+			Name:        "app",
+			EntryPoints: []config.ServerName{"websecure"},
+			HostSNI:     []string{"App.Example.com"},
+			TLS:         &config.TCPRouterTLS{},
+			Target:      []string{plainServer},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	switcher := NewSwitcher(context.Background())
+	switcher.UpdateRouter(routers["websecure"])
+	switcher.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{newCertificate(t, "app.example.com")}})
+	address := frontend(t, switcher)
+
+	for serverName, want := range map[string]string{
+		"db.example.com":  "echo:ping",
+		"app.example.com": "echo:ping",
+	} {
+		conn, err := tls.Dial("tcp", address, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("%s: %v", serverName, err)
+		}
+		if got := conn.ConnectionState().PeerCertificates[0].DNSNames[0]; got != serverName {
+			t.Errorf("%s: the TLS connection is terminated with the certificate of %s", serverName, got)
+		}
+		if got := exchange(t, conn, "ping"); got != want {
+			t.Errorf("%s: got %q, want %q", serverName, got, want)
+		}
+	}
+
+	// the other connections go to the HTTP server.
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exchange(t, conn.(WriteCloser), "GET / HTTP/1.1\r\n\r\n"); got != "http" {
+		t.Errorf("got %q, want http", got)
+	}
+}
+
+func TestSwitcherCatchAll(t *testing.T) {
+	routers, err := BuildRouting(context.Background(), []*config.TCPRouter{{
+		Name:        "raw",
+		EntryPoints: []config.ServerName{"raw"},
+		HostSNI:     []string{config.HostSNICatchAll},
+		Target:      []string{echoServer(t, nil)},
+		IdleTimeout: 200 * time.Millisecond,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	switcher := NewSwitcher(context.Background())
+	switcher.UpdateRouter(routers["raw"])
+	address := frontend(t, switcher)
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exchange(t, conn.(WriteCloser), "ping"); got != "echo:ping" {
+		t.Errorf("got %q, want echo:ping", got)
+	}
+
+	// the connection without traffic is closed after the idle timeout.
+	if conn, err = net.Dial("tcp", address); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("got %v, want the connection closed", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("the idle connection was closed after %s", elapsed)
+	}
+}
+
+func TestBuildRoutingConflict(t *testing.T) {
+	_, err := BuildRouting(context.Background(), []*config.TCPRouter{
+		{Name: "a", EntryPoints: []config.ServerName{"web"}, HostSNI: []string{"*"}, Target: []string{"127.0.0.1:1"}},
+		{Name: "b", EntryPoints: []config.ServerName{"web"}, HostSNI: []string{"*"}, Target: []string{"127.0.0.1:2"}},
+	})
+	if err == nil {
+		t.Error("expected an error for two catch-all routers on the same entry point")
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/2
+
+// Package udp forwards the datagrams of the entry points to their servers.
+package udp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/router"
+)
+
+// maxDatagramSize is the size of the largest UDP payload.
+const maxDatagramSize = 65535
+
+// Service chooses the servers of the new sessions of a UDP router.
+type Service struct {
+	name        string
+	balancer    router.Balancer
+	timeout     time.Duration
+	maxSessions int
+}
+
+// BuildRouting builds the services of the entry points the UDP routers are attached to.
+func BuildRouting(udpRouters []*config.UDPRouter) (map[config.ServerName]*Service, error) {
+	services := make(map[config.ServerName]*Service)
+	owners := make(map[config.ServerName]string)
+	for _, udpRouter := range udpRouters {
+		balancer, err := router.NewUDPBalancer(udpRouter)
+		if err != nil {
+			return nil, fmt.Errorf("udp router %s: %w", udpRouter.Name, err)
+		}
+		service := &Service{
+			name:        udpRouter.Name,
+			balancer:    balancer,
+			timeout:     udpRouter.GetTimeout(),
+			maxSessions: udpRouter.GetMaxSessions(),
+		}
+		for _, entryPoint := range udpRouter.EntryPoints {
+			if owner, ok := owners[entryPoint]; ok {
+				return nil, fmt.Errorf("entryPoint %s is already routed by udp router %s (conflicts with %s)",
+					entryPoint, owner, udpRouter.Name)
+			}
+			owners[entryPoint] = udpRouter.Name
+			services[entryPoint] = service
+		}
+	}
+	return services, nil
+}
+
+// Proxy forwards the datagrams of an entry point to the server of the session of their client,
+// the replies of the server go back to the client.
+type Proxy struct {
+	ctx     context.Context
+	lock    sync.RWMutex
+	service *Service
+	mu      sync.Mutex
+	conn    net.PacketConn
+	// sessions holds the sessions of the client addresses.
+	sessions map[string]*session
+	closed   bool
+}
+
+// session connects a client to a server.
+type session struct {
+	client  net.Addr
+	backend net.Conn
+	timeout time.Duration
+	last    int64
+}
+
+func (s *session) touch() {
+	atomic.StoreInt64(&s.last, time.Now().UnixNano())
+}
+
+// expired reports whether no datagram went through the session during its timeout.
+func (s *session) expired() bool {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&s.last))) >= s.timeout
+}
+
+// NewProxy creates a Proxy dropping the datagrams until a service is set.
+func NewProxy(ctx context.Context) *Proxy {
+	return &Proxy{
+		ctx:      ctx,
+		sessions: make(map[string]*session),
+	}
+}
+
+// UpdateService safely switches the service of the new sessions, nil drops their datagrams.
+func (p *Proxy) UpdateService(service *Service) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.service = service
+}
+
+// GetService returns the current service.
+func (p *Proxy) GetService() *Service {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.service
+}
+
+// Serve forwards the datagrams read on conn until the proxy is closed.
+func (p *Proxy) Serve(conn net.PacketConn) error {
+	p.mu.Lock()
+	p.conn = conn
+	p.mu.Unlock()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, client, err := conn.ReadFrom(buf)
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				continue
+			}
+			return err
+		}
+		s, err := p.session(client)
+		if err != nil {
+			logger.FromContext(p.ctx).Debugf("Dropping the datagram of %s: %v", client, err)
+			continue
+		}
+		if s == nil {
+			continue
+		}
+		s.touch()
+		if _, err = s.backend.Write(buf[:n]); err != nil {
+			logger.FromContext(p.ctx).Debugf("Error while forwarding the datagram of %s: %v", client, err)
+		}
+	}
+}
+
+// session returns the session of client, a new one is connected to the next server of the service
+// unless the service has reached its maximum number of sessions. The sessions are only created by Serve.
+func (p *Proxy) session(client net.Addr) (*session, error) {
+	key := client.String()
+	p.mu.Lock()
+	s, ok := p.sessions[key]
+	sessions := len(p.sessions)
+	p.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+	service := p.GetService()
+	if service == nil {
+		return nil, errors.New("no udp router")
+	}
+	// a flood of spoofed sources must not exhaust the file descriptors.
+	if sessions >= service.maxSessions {
+		return nil, fmt.Errorf("udp service %s has reached its %d sessions", service.name, service.maxSessions)
+	}
+	server := service.balancer.Next()
+	if server == "" {
+		return nil, fmt.Errorf("udp service %s has no available server", service.name)
+	}
+	backend, err := net.Dial("udp", server)
+	if err != nil {
+		return nil, fmt.Errorf("udp service %s: %w", service.name, err)
+	}
+	s = &session{client: client, backend: backend, timeout: service.timeout}
+	s.touch()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		backend.Close()
+		return nil, nil
+	}
+	p.sessions[key] = s
+	go p.reply(s)
+	return s, nil
+}
+
+// reply sends the datagrams of the server back to the client until the session times out.
+func (p *Proxy) reply(s *session) {
+	defer p.remove(s)
+	buf := make([]byte, maxDatagramSize)
+	for {
+		_ = s.backend.SetReadDeadline(time.Now().Add(s.timeout))
+		n, err := s.backend.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !s.expired() {
+				// the client is still sending.
+				continue
+			}
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				logger.FromContext(p.ctx).Debugf("Error while reading the reply to %s: %v", s.client, err)
+			}
+			return
+		}
+		s.touch()
+		if _, err = p.conn.WriteTo(buf[:n], s.client); err != nil {
+			logger.FromContext(p.ctx).Debugf("Error while replying to %s: %v", s.client, err)
+		}
+	}
+}
+
+func (p *Proxy) remove(s *session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sessions[s.client.String()] == s {
+		delete(p.sessions, s.client.String())
+	}
+	s.backend.Close()
+}
+
+// Close stops Serve and closes the sessions.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, s := range p.sessions {
+		s.backend.Close()
+	}
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
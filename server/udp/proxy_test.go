@@ -0,0 +1,167 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/2
+
+package udp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/config"
+)
+
+// echoServer answers each datagram with "echo:" followed by it.
+func echoServer(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteTo(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestProxy(t *testing.T) {
+	services, err := BuildRouting([]*config.UDPRouter{{
+		Name:        "dns",
+		EntryPoints: []config.ServerName{"dns"},
+		Target:      []string{echoServer(t), echoServer(t)},
+		Timeout:     200 * time.Millisecond,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := NewProxy(context.Background())
+	proxy.UpdateService(services["dns"])
+	done := make(chan error, 1)
+	go func() { done <- proxy.Serve(conn) }()
+
+	// each client gets the replies to its own datagrams.
+	clients := make([]net.Conn, 3)
+	for i := range clients {
+		if clients[i], err = net.Dial("udp", conn.LocalAddr().String()); err != nil {
+			t.Fatal(err)
+		}
+		defer clients[i].Close()
+	}
+	for round := 0; round < 2; round++ {
+		for i, client := range clients {
+			message := string(rune('a' + i))
+			if _, err = client.Write([]byte(message)); err != nil {
+				t.Fatal(err)
+			}
+			_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+			reply := make([]byte, 64)
+			n, err := client.Read(reply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(reply[:n]) != "echo:"+message {
+				t.Errorf("client %d got %q, want %q", i, reply[:n], "echo:"+message)
+			}
+		}
+	}
+	proxy.mu.Lock()
+	sessions := len(proxy.sessions)
+	proxy.mu.Unlock()
+	if sessions != len(clients) {
+		t.Errorf("got %d sessions, want %d", sessions, len(clients))
+	}
+
+	// the sessions without datagram are closed after the timeout.
+	deadline := time.Now().Add(5 * time.Second)
+	for sessions != 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		proxy.mu.Lock()
+		sessions = len(proxy.sessions)
+		proxy.mu.Unlock()
+	}
+	if sessions != 0 {
+		t.Errorf("%d sessions are left after their timeout", sessions)
+	}
+
+	if err = proxy.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-done; err != nil {
+		t.Errorf("Serve returned %v after Close", err)
+	}
+}
+
+func TestProxyMaxSessions(t *testing.T) {
+	services, err := BuildRouting([]*config.UDPRouter{{
+		Name:        "dns",
+		EntryPoints: []config.ServerName{"dns"},
+		Target:      []string{echoServer(t)},
+		Timeout:     200 * time.Millisecond,
+		MaxSessions: 2,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := NewProxy(context.Background())
+	proxy.UpdateService(services["dns"])
+	go func() { _ = proxy.Serve(conn) }()
+	defer proxy.Close()
+
+	exchange := func(client net.Conn) bool {
+		if _, err := client.Write([]byte("a")); err != nil {
+			t.Fatal(err)
+		}
+		_ = client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err := client.Read(make([]byte, 64))
+		return err == nil
+	}
+	clients := make([]net.Conn, 3)
+	for i := range clients {
+		if clients[i], err = net.Dial("udp", conn.LocalAddr().String()); err != nil {
+			t.Fatal(err)
+		}
+		defer clients[i].Close()
+	}
+	for i, want := range []bool{true, true, false} {
+		if got := exchange(clients[i]); got != want {
+			t.Errorf("client %d: got a reply %v, want %v", i, got, want)
+		}
+	}
+
+	// the sessions timed out make room for the new clients.
+	time.Sleep(500 * time.Millisecond)
+	if !exchange(clients[2]) {
+		t.Error("the client is dropped once the sessions timed out")
+	}
+}
+
+func TestBuildRoutingConflict(t *testing.T) {
+	_, err := BuildRouting([]*config.UDPRouter{
+		{Name: "a", EntryPoints: []config.ServerName{"dns"}, Target: []string{"127.0.0.1:53"}},
+		{Name: "b", EntryPoints: []config.ServerName{"dns"}, Target: []string{"127.0.0.1:54"}},
+	})
+	if err == nil {
+		t.Fatal("expected an error for two udp routers on the same entry point")
+	}
+	if want := "entryPoint dns is already routed by udp router a (conflicts with b)"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+}
@@ -6,13 +6,10 @@ package tls
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"sort"
 	"strings"
 
 	"github.com/crochee/proxy/logger"
-	"github.com/crochee/proxy/tls/generate"
 )
 
 // Certificate holds a SSL cert/key pair
@@ -107,109 +104,22 @@ func (c *Certificates) Type() string {
 	return "certificates"
 }
 
-// CreateTLSConfig creates a TLS config from Certificate structures.
-func (c *Certificates) CreateTLSConfig(entryPointName string) (*tls.Config, error) {
-	config := &tls.Config{}
-	domainsCertificates := make(map[string]map[string]*tls.Certificate)
-
-	if c.isEmpty() {
-		config.Certificates = []tls.Certificate{}
-
-		cert, err := generate.DefaultCertificate("", "")
-		if err != nil {
-			return nil, err
-		}
-
-		config.Certificates = append(config.Certificates, *cert)
-	} else {
-		for _, certificate := range *c {
-			err := certificate.AppendCertificate(domainsCertificates, entryPointName)
-			if err != nil {
-				logger.Errorf("Unable to add a certificate to the entryPoint %q : %v", entryPointName, err)
-				continue
-			}
-
-			for _, certDom := range domainsCertificates {
-				for _, cert := range certDom {
-					config.Certificates = append(config.Certificates, *cert)
-				}
-			}
-		}
-	}
-	return config, nil
-}
-
-// isEmpty checks if the certificates list is empty.
-func (c *Certificates) isEmpty() bool {
-	if len(*c) == 0 {
-		return true
-	}
-	var key int
-	for _, cert := range *c {
-		if len(cert.CertFile.String()) != 0 && len(cert.KeyFile.String()) != 0 {
-			break
-		}
-		key++
-	}
-	return key == len(*c)
-}
-
-// AppendCertificate appends a Certificate to a certificates map keyed by entrypoint.
-func (c *Certificate) AppendCertificate(certs map[string]map[string]*tls.Certificate, ep string) error {
-	certContent, err := c.CertFile.Read()
+// CreateTLSConfig creates the TLS config of an entry point, the certificate of a handshake is chosen from the SNI
+// by the returned store, the default certificate is served when none matches unless the options are SNI strict.
+func (c *Certificates) CreateTLSConfig(entryPointName string, defaultCertificate *Certificate,
+	options *Options) (*tls.Config, *CertificateStore, error) {
+	store, err := NewCertificateStore(entryPointName, *c, defaultCertificate)
 	if err != nil {
-		return fmt.Errorf("unable to read CertFile : %w", err)
-	}
-	var keyContent []byte
-	if keyContent, err = c.KeyFile.Read(); err != nil {
-		return fmt.Errorf("unable to read KeyFile : %w", err)
-	}
-	var tlsCert tls.Certificate
-	if tlsCert, err = tls.X509KeyPair(certContent, keyContent); err != nil {
-		return fmt.Errorf("unable to generate TLS certificate : %w", err)
-	}
-
-	parsedCert, _ := x509.ParseCertificate(tlsCert.Certificate[0])
-
-	var SANs []string
-	if parsedCert.Subject.CommonName != "" {
-		SANs = append(SANs, strings.ToLower(parsedCert.Subject.CommonName))
+		return nil, nil, err
 	}
-	if parsedCert.DNSNames != nil {
-		sort.Strings(parsedCert.DNSNames)
-		for _, dnsName := range parsedCert.DNSNames {
-			if dnsName != parsedCert.Subject.CommonName {
-				SANs = append(SANs, strings.ToLower(dnsName))
-			}
+	config := &tls.Config{GetCertificate: store.GetCertificate}
+	if options != nil {
+		if err = options.Apply(config); err != nil {
+			return nil, nil, fmt.Errorf("TLS options of the entryPoint %q: %w", entryPointName, err)
 		}
-	}
-	if parsedCert.IPAddresses != nil {
-		for _, ip := range parsedCert.IPAddresses {
-			if ip.String() != parsedCert.Subject.CommonName {
-				SANs = append(SANs, strings.ToLower(ip.String()))
-			}
+		if options.SniStrict {
+			config.GetCertificate = store.GetStrictCertificate
 		}
 	}
-	certKey := strings.Join(SANs, ",")
-
-	certExists := false
-	if certs[ep] == nil {
-		certs[ep] = make(map[string]*tls.Certificate)
-	} else {
-		for domains := range certs[ep] {
-			if domains == certKey {
-				certExists = true
-				break
-			}
-		}
-	}
-	if certExists {
-		logger.Debugf("Skipping addition of certificate for domain(s) %q, to EntryPoint %s, "+
-			"as it already exists for this Entrypoint.", certKey, ep)
-	} else {
-		logger.Debugf("Adding certificate for domain(s) %s", certKey)
-		certs[ep][certKey] = &tlsCert
-	}
-
-	return err
+	return config, store, nil
 }
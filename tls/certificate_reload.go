@@ -0,0 +1,179 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/25
+
+package tls
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/crochee/proxy/logger"
+)
+
+// reloadDelay groups the file events of a rotation, which usually writes the certificate and the key separately.
+const reloadDelay = 500 * time.Millisecond
+
+// certificateSource is a configured certificate with the content it was loaded from.
+type certificateSource struct {
+	config    Certificate
+	isDefault bool
+	certPEM   []byte
+	keyPEM    []byte
+	cert      *tls.Certificate
+	// ocsp is the stapling state of cert.
+	ocsp ocspState
+}
+
+// load reads and validates the pair, the content is kept to detect the changes.
+func (c *certificateSource) load() (*tls.Certificate, error) {
+	certPEM, err := c.config.CertFile.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CertFile : %w", err)
+	}
+	var keyPEM []byte
+	if keyPEM, err = c.config.KeyFile.Read(); err != nil {
+		return nil, fmt.Errorf("unable to read KeyFile : %w", err)
+	}
+	var cert tls.Certificate
+	if cert, err = tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return nil, fmt.Errorf("unable to generate TLS certificate : %w", err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, fmt.Errorf("unable to parse certificate : %w", err)
+	}
+	c.certPEM, c.keyPEM = certPEM, keyPEM
+	return &cert, nil
+}
+
+// changed reports whether the files of the certificate hold a different content.
+func (c *certificateSource) changed() bool {
+	if !c.config.CertFile.IsPath() || !c.config.KeyFile.IsPath() {
+		// an inline content never changes, and a file being rotated may be missing for a moment,
+		// the event creating it reloads the pair.
+		return false
+	}
+	certPEM, certErr := c.config.CertFile.Read()
+	keyPEM, keyErr := c.config.KeyFile.Read()
+	if certErr != nil || keyErr != nil {
+		return false
+	}
+	return !bytes.Equal(certPEM, c.certPEM) || !bytes.Equal(keyPEM, c.keyPEM)
+}
+
+// ReloadedCertificate is a certificate reloaded in place of Previous.
+type ReloadedCertificate struct {
+	Previous    *tls.Certificate
+	Certificate *tls.Certificate
+}
+
+// Reload loads again the certificates whose files changed and swaps them in the store.
+// An invalid pair is logged and the previous certificate is kept. The reloaded certificates are returned.
+func (s *CertificateStore) Reload() []ReloadedCertificate {
+	s.sourcesMu.Lock()
+	defer s.sourcesMu.Unlock()
+	var reloaded []ReloadedCertificate
+	for _, source := range s.sources {
+		if !source.changed() {
+			continue
+		}
+		name := source.config.GetTruncatedCertificateName()
+		cert, err := source.load()
+		if err == nil && time.Now().After(cert.Leaf.NotAfter) {
+			err = fmt.Errorf("certificate expired on %s", cert.Leaf.NotAfter.Format(time.RFC3339))
+		}
+		if err != nil {
+			logger.Errorf("Unable to reload certificate %s, keeping the previous one: %v", name, err)
+			continue
+		}
+		s.replace(source.cert, cert, source.isDefault)
+		reloaded = append(reloaded, ReloadedCertificate{Previous: source.cert, Certificate: cert})
+		source.cert = cert
+		logger.Infof("Certificate %s reloaded, valid until %s", name, cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return reloaded
+}
+
+// replace swaps the previous certificate with the new one for its SANs and as default certificate.
+func (s *CertificateStore) replace(previous, cert *tls.Certificate, isDefault bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, c := range s.certificates {
+		if c == previous {
+			delete(s.certificates, name)
+		}
+	}
+	if isDefault || s.defaultCert == previous {
+		s.defaultCert = cert
+	}
+	if isDefault {
+		return
+	}
+	for _, name := range certificateNames(cert.Leaf) {
+		if _, ok := s.certificates[name]; !ok {
+			s.certificates[name] = cert
+		}
+	}
+}
+
+// Watch reloads the certificates when the files of their directories change until ctx is done,
+// the directories are watched so that the atomic symlink swaps of mounted secrets are seen.
+// onReload is called with each reloaded certificate and the previous one it replaced.
+func (s *CertificateStore) Watch(ctx context.Context, onReload func(previous, cert *tls.Certificate)) {
+	dirs := make(map[string]struct{})
+	for _, source := range s.sources {
+		for _, f := range []FileOrContent{source.config.CertFile, source.config.KeyFile} {
+			if f.IsPath() {
+				dirs[filepath.Dir(f.String())] = struct{}{}
+			}
+		}
+	}
+	if len(dirs) == 0 {
+		return
+	}
+	log := logger.FromContext(ctx)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("Unable to watch the certificates: %v", err)
+		return
+	}
+	defer watcher.Close()
+	for dir := range dirs {
+		if err = watcher.Add(dir); err != nil {
+			log.Errorf("Unable to watch the certificates of %s: %v", dir, err)
+		}
+	}
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			timer.Reset(reloadDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("Certificate watcher error: %v", err)
+		case <-timer.C:
+			for _, reloaded := range s.Reload() {
+				if onReload != nil {
+					onReload(reloaded.Previous, reloaded.Certificate)
+				}
+			}
+		}
+	}
+}
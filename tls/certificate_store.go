@@ -0,0 +1,220 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/24
+
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/tls/generate"
+)
+
+// CertificateStore holds the certificates of an entry point indexed by their SANs,
+// the certificate of a handshake is chosen from the SNI sent by the client.
+type CertificateStore struct {
+	mu           sync.RWMutex
+	certificates map[string]*tls.Certificate
+	defaultCert  *tls.Certificate
+	// sources are the configured certificates, they are reloaded when their files change
+	// and their OCSP responses are stapled, sourcesMu serializes these updates.
+	sourcesMu sync.Mutex
+	sources   []*certificateSource
+}
+
+// NewCertificateStore creates the certificate store of an entry point.
+// The default certificate is served when no certificate matches the SNI,
+// a self-signed one is generated when it is not given.
+func NewCertificateStore(entryPointName string, certificates Certificates,
+	defaultCertificate *Certificate) (*CertificateStore, error) {
+	store := &CertificateStore{
+		certificates: make(map[string]*tls.Certificate),
+	}
+	for i := range certificates {
+		source := &certificateSource{config: certificates[i]}
+		cert, err := source.load()
+		if err == nil {
+			err = store.AddCertificate(cert)
+		}
+		if err != nil {
+			logger.Errorf("Unable to add certificate %s to the entryPoint %q : %v",
+				certificates[i].GetTruncatedCertificateName(), entryPointName, err)
+			continue
+		}
+		source.cert = cert
+		store.sources = append(store.sources, source)
+	}
+
+	if defaultCertificate != nil {
+		source := &certificateSource{config: *defaultCertificate, isDefault: true}
+		cert, err := source.load()
+		if err != nil {
+			return nil, fmt.Errorf("default certificate of the entryPoint %q: %w", entryPointName, err)
+		}
+		source.cert = cert
+		store.defaultCert = cert
+		store.sources = append(store.sources, source)
+		return store, nil
+	}
+	cert, err := generate.DefaultCertificate("", "")
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	store.defaultCert = cert
+	return store, nil
+}
+
+// AddCertificate indexes the certificate by its DNS names and IP addresses,
+// or by its common name when it has no SAN. A SAN already indexed keeps its certificate.
+func (s *CertificateStore) AddCertificate(cert *tls.Certificate) error {
+	if len(cert.Certificate) == 0 {
+		return errors.New("empty certificate")
+	}
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+		cert.Leaf = leaf
+	}
+	names := certificateNames(cert.Leaf)
+	if len(names) == 0 {
+		return errors.New("certificate has neither SAN nor common name")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range names {
+		if _, ok := s.certificates[name]; ok {
+			logger.Debugf("Skipping addition of certificate for domain %q, it already exists", name)
+			continue
+		}
+		logger.Debugf("Adding certificate for domain %s", name)
+		s.certificates[name] = cert
+	}
+	return nil
+}
+
+// UpdateCertificate replaces previous with cert for their SANs, cert is added when previous is nil.
+// It swaps the certificates managed out of the configuration, such as the ones obtained by ACME.
+func (s *CertificateStore) UpdateCertificate(previous, cert *tls.Certificate) error {
+	if previous == nil {
+		return s.AddCertificate(cert)
+	}
+	if len(cert.Certificate) == 0 {
+		return errors.New("empty certificate")
+	}
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+		cert.Leaf = leaf
+	}
+	s.replace(previous, cert, false)
+	return nil
+}
+
+// DefaultCertificate returns the certificate served when no certificate matches the SNI.
+func (s *CertificateStore) DefaultCertificate() *tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.defaultCert
+}
+
+// Certificates returns the distinct certificates of the store, the default one included.
+func (s *CertificateStore) Certificates() []*tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := make(map[*tls.Certificate]struct{}, len(s.certificates)+1)
+	list := make([]*tls.Certificate, 0, len(s.certificates)+1)
+	for _, cert := range append([]*tls.Certificate{s.defaultCert}, mapValues(s.certificates)...) {
+		if _, ok := seen[cert]; ok || cert == nil {
+			continue
+		}
+		seen[cert] = struct{}{}
+		list = append(list, cert)
+	}
+	return list
+}
+
+// Match returns the certificate matching the server name exactly, then by wildcard, or nil.
+func (s *CertificateStore) Match(serverName string) *tls.Certificate {
+	name := strings.TrimSuffix(strings.ToLower(serverName), ".")
+	if name == "" {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if cert, ok := s.certificates[name]; ok {
+		return cert
+	}
+	// a wildcard only matches a single label.
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := s.certificates["*"+name[i:]]; ok {
+			return cert
+		}
+	}
+	return nil
+}
+
+// GetCertificate is the tls.Config callback choosing the certificate from the SNI,
+// the local IP address is matched when the client sends no SNI.
+func (s *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := s.Match(helloServerName(hello)); cert != nil {
+		return cert, nil
+	}
+	if cert := s.DefaultCertificate(); cert != nil {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+}
+
+// GetStrictCertificate is the tls.Config callback rejecting the handshakes whose SNI matches no certificate.
+func (s *CertificateStore) GetStrictCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := s.Match(helloServerName(hello)); cert != nil {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("strict SNI enabled, no certificate found for domain %q", hello.ServerName)
+}
+
+func helloServerName(hello *tls.ClientHelloInfo) string {
+	if hello.ServerName == "" && hello.Conn != nil {
+		if host, _, err := net.SplitHostPort(hello.Conn.LocalAddr().String()); err == nil {
+			return host
+		}
+	}
+	return hello.ServerName
+}
+
+func certificateNames(leaf *x509.Certificate) []string {
+	var names []string
+	for _, dnsName := range leaf.DNSNames {
+		names = append(names, strings.ToLower(dnsName))
+	}
+	for _, ip := range leaf.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = append(names, strings.ToLower(leaf.Subject.CommonName))
+	}
+	return names
+}
+
+func mapValues(certificates map[string]*tls.Certificate) []*tls.Certificate {
+	list := make([]*tls.Certificate, 0, len(certificates))
+	for _, cert := range certificates {
+		list = append(list, cert)
+	}
+	return list
+}
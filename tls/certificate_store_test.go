@@ -0,0 +1,111 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/24
+
+package tls
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/tls/generate"
+)
+
+func newCertificate(t *testing.T, domain string) Certificate {
+	t.Helper()
+	certPEM, keyPEM, err := generate.KeyPair(domain, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Certificate{CertFile: FileOrContent(certPEM), KeyFile: FileOrContent(keyPEM)}
+}
+
+func TestCertificateStoreSNI(t *testing.T) {
+	defaultCert := newCertificate(t, "default.local")
+	store, err := NewCertificateStore("websecure", Certificates{
+		newCertificate(t, "a.example.com"),
+		newCertificate(t, "*.example.com"),
+	}, &defaultCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for serverName, want := range map[string]string{
+		"a.example.com":   "a.example.com",
+		"A.Example.com.":  "a.example.com",
+		"b.example.com":   "*.example.com",
+		"c.b.example.com": "default.local",
+		"example.com":     "default.local",
+		"":                "default.local",
+	} {
+		cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cert.Leaf.DNSNames[0]; got != want {
+			t.Errorf("%q: got certificate %s, want %s", serverName, got, want)
+		}
+	}
+	if n := len(store.Certificates()); n != 3 {
+		t.Errorf("expected 3 certificates, got %d", n)
+	}
+}
+
+func TestCertificateStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writePair := func(certPEM, keyPEM []byte) {
+		if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	certPEM, keyPEM, err := generate.KeyPair("a.example.com", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePair(certPEM, keyPEM)
+	store, err := NewCertificateStore("websecure", Certificates{
+		{CertFile: FileOrContent(certFile), KeyFile: FileOrContent(keyFile)},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.Reload()); n != 0 {
+		t.Fatalf("unchanged files reloaded %d certificates", n)
+	}
+
+	rotatedCert, rotatedKey, err := generate.KeyPair("b.example.com", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := store.Match("a.example.com")
+	writePair(rotatedCert, rotatedKey)
+	reloaded := store.Reload()
+	if n := len(reloaded); n != 1 {
+		t.Fatalf("expected the rotated certificate to be reloaded, got %d", n)
+	}
+	if reloaded[0].Previous != previous {
+		t.Error("the replaced certificate is not returned")
+	}
+	if store.Match("a.example.com") != nil {
+		t.Error("the previous certificate is still served")
+	}
+	rotated := store.Match("b.example.com")
+	if rotated == nil {
+		t.Fatal("the rotated certificate is not served")
+	}
+
+	// a key not matching the certificate keeps the rotated certificate.
+	writePair(certPEM, rotatedKey)
+	if n := len(store.Reload()); n != 0 {
+		t.Fatalf("invalid pair reloaded %d certificates", n)
+	}
+	if store.Match("b.example.com") != rotated {
+		t.Error("the invalid pair replaced the served certificate")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/25
+
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ClientAuthTypes maps the client authentication modes to their crypto/tls value.
+var ClientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify-if-given":    tls.VerifyClientCertIfGiven,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
+// ClientAuth configures the authentication of the clients of an entry point by their certificate.
+type ClientAuth struct {
+	// CAFiles are the CA bundles verifying the client certificates.
+	CAFiles []FileOrContent `json:"caFiles,omitempty" toml:"caFiles,omitempty" yaml:"caFiles,omitempty"`
+	// ClientAuthType is one of none, request, require, verify-if-given and require-and-verify.
+	ClientAuthType string `json:"clientAuthType,omitempty" toml:"clientAuthType,omitempty" yaml:"clientAuthType,omitempty"`
+}
+
+// Validate checks the mode and the CA bundles.
+func (c *ClientAuth) Validate() error {
+	_, _, err := c.build()
+	return err
+}
+
+// Apply sets the client authentication on config.
+func (c *ClientAuth) Apply(config *tls.Config) error {
+	authType, pool, err := c.build()
+	if err != nil {
+		return err
+	}
+	config.ClientAuth = authType
+	config.ClientCAs = pool
+	return nil
+}
+
+func (c *ClientAuth) build() (tls.ClientAuthType, *x509.CertPool, error) {
+	mode := c.ClientAuthType
+	if mode == "" {
+		mode = "none"
+	}
+	authType, ok := ClientAuthTypes[mode]
+	if !ok {
+		names := make([]string, 0, len(ClientAuthTypes))
+		for name := range ClientAuthTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return 0, nil, fmt.Errorf("unknown client auth type %s, valid types are: %s", mode, strings.Join(names, ", "))
+	}
+	if len(c.CAFiles) == 0 {
+		if authType == tls.VerifyClientCertIfGiven || authType == tls.RequireAndVerifyClientCert {
+			return 0, nil, fmt.Errorf("client auth type %s requires caFiles", mode)
+		}
+		return authType, nil, nil
+	}
+	pool := x509.NewCertPool()
+	for _, caFile := range c.CAFiles {
+		content, err := caFile.Read()
+		if err != nil {
+			return 0, nil, fmt.Errorf("unable to read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(content) {
+			return 0, nil, fmt.Errorf("no certificate found in CA file %s", truncate(caFile))
+		}
+	}
+	return authType, pool, nil
+}
+
+func truncate(f FileOrContent) string {
+	return (&Certificate{CertFile: f}).GetTruncatedCertificateName()
+}
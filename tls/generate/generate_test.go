@@ -4,10 +4,14 @@
 
 package generate
 
-import "testing"
+import (
+	"path/filepath"
+	"testing"
+)
 
 func TestDefaultCertificate(t *testing.T) {
-	tlsConfig, err := DefaultCertificate("cert.pem", "key.pem")
+	dir := t.TempDir()
+	tlsConfig, err := DefaultCertificate(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,274 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/28
+
+package generate
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// Key types of the generated keys.
+const (
+	KeyRSA     = "rsa"
+	KeyECDSA   = "ecdsa"
+	KeyEd25519 = "ed25519"
+)
+
+// Usages of the leaf certificates.
+const (
+	UsageServer = "server"
+	UsageClient = "client"
+)
+
+// clockSkew backdates the certificates so that they are valid on the hosts whose clock is late.
+const clockSkew = 5 * time.Minute
+
+// GenerateKey generates a key of the type: rsa (2048 bits), ecdsa (P-256) or ed25519.
+func GenerateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyRSA:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "", KeyECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unknown key type %s, valid types are: %s, %s, %s", keyType, KeyRSA, KeyECDSA, KeyEd25519)
+	}
+}
+
+// CA is a certificate authority issuing leaf certificates.
+type CA struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+	// Chain holds the DER certificates above Certificate, empty for a root CA.
+	Chain [][]byte
+}
+
+// NewRootCA creates a self-signed root CA valid for validity.
+func NewRootCA(commonName string, validity time.Duration, keyType string) (*CA, error) {
+	if commonName == "" {
+		return nil, errors.New("the common name of the CA is required")
+	}
+	key, err := GenerateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	var serialNumber *big.Int
+	if serialNumber, err = newSerialNumber(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		// the CA only issues leaf certificates.
+		MaxPathLenZero: true,
+	}
+	var der []byte
+	if der, err = x509.CreateCertificate(rand.Reader, template, template, key.Public(), key); err != nil {
+		return nil, err
+	}
+	var cert *x509.Certificate
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		return nil, err
+	}
+	return &CA{Certificate: cert, Key: key}, nil
+}
+
+// LoadCA loads a CA from its PEM certificate, followed by its chain, and its PEM private key.
+func LoadCA(certPEM, keyPEM []byte) (*CA, error) {
+	ders := decodeCertificates(certPEM)
+	if len(ders) == 0 {
+		return nil, errors.New("no certificate found in the CA certificate")
+	}
+	cert, err := x509.ParseCertificate(ders[0])
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", cert.Subject.CommonName)
+	}
+	var key crypto.Signer
+	if key, err = ParseKey(keyPEM); err != nil {
+		return nil, err
+	}
+	if !publicKeyEqual(cert.PublicKey, key.Public()) {
+		return nil, errors.New("the CA key does not match the CA certificate")
+	}
+	return &CA{Certificate: cert, Key: key, Chain: ders[1:]}, nil
+}
+
+// LeafRequest describes a leaf certificate.
+type LeafRequest struct {
+	// CommonName defaults to the first SAN.
+	CommonName string
+	// SANs are DNS names or IP addresses.
+	SANs     []string
+	Validity time.Duration
+	KeyType  string
+	// Usages are server and client, server when empty.
+	Usages []string
+}
+
+// Issue creates a leaf certificate signed by the CA,
+// it returns the DER certificate and its key.
+func (ca *CA) Issue(request LeafRequest) ([]byte, crypto.Signer, error) {
+	template, err := leafTemplate(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	if template.NotAfter.After(ca.Certificate.NotAfter) {
+		return nil, nil, fmt.Errorf("the certificate would expire after its CA on %s",
+			ca.Certificate.NotAfter.Format(time.RFC3339))
+	}
+	var key crypto.Signer
+	if key, err = GenerateKey(request.KeyType); err != nil {
+		return nil, nil, err
+	}
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	var der []byte
+	if der, err = x509.CreateCertificate(rand.Reader, template, ca.Certificate, key.Public(), ca.Key); err != nil {
+		return nil, nil, err
+	}
+	return der, key, nil
+}
+
+// FullChain returns the PEM chain of a certificate issued by the CA: the leaf, the CA and its chain.
+func (ca *CA) FullChain(leaf []byte) []byte {
+	chain := EncodeCertificates(leaf, ca.Certificate.Raw)
+	return append(chain, EncodeCertificates(ca.Chain...)...)
+}
+
+func leafTemplate(request LeafRequest) (*x509.Certificate, error) {
+	if len(request.SANs) == 0 && request.CommonName == "" {
+		return nil, errors.New("a SAN or a common name is required")
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: request.CommonName},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(request.Validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	for _, san := range request.SANs {
+		if ip := net.ParseIP(san); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, san)
+		}
+	}
+	if template.Subject.CommonName == "" {
+		template.Subject.CommonName = request.SANs[0]
+	}
+	usages := request.Usages
+	if len(usages) == 0 {
+		usages = []string{UsageServer}
+	}
+	for _, usage := range usages {
+		switch usage {
+		case UsageServer:
+			template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+		case UsageClient:
+			template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+		default:
+			return nil, fmt.Errorf("unknown usage %s, valid usages are: %s, %s", usage, UsageServer, UsageClient)
+		}
+	}
+	return template, nil
+}
+
+// EncodeKey encodes the key in a PKCS#8 PEM block.
+func EncodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseKey parses a PEM private key in the PKCS#8, PKCS#1 or SEC 1 format.
+func ParseKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM block found in the key")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
+
+// EncodeCertificates encodes the DER certificates in PEM blocks.
+func EncodeCertificates(ders ...[]byte) []byte {
+	var out []byte
+	for _, der := range ders {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return out
+}
+
+func decodeCertificates(certPEM []byte) [][]byte {
+	var ders [][]byte
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			return ders
+		}
+		if block.Type == "CERTIFICATE" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
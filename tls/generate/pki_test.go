@@ -0,0 +1,98 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/28
+
+package generate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	for _, keyType := range []string{KeyRSA, KeyECDSA, KeyEd25519} {
+		t.Run(keyType, func(t *testing.T) {
+			root, err := NewRootCA("Proxy Root CA", 24*time.Hour, keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rootKey, err := EncodeKey(root.Key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the CA is used from its files.
+			ca, err := LoadCA(EncodeCertificates(root.Certificate.Raw), rootKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			der, key, err := ca.Issue(LeafRequest{
+				SANs:     []string{"proxy.local", "127.0.0.1"},
+				Validity: time.Hour,
+				KeyType:  keyType,
+				Usages:   []string{UsageServer, UsageClient},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			keyPEM, err := EncodeKey(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pair, err := tls.X509KeyPair(ca.FullChain(der), keyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pair.Certificate) != 2 {
+				t.Fatalf("expected the leaf and its CA, got %d certificates", len(pair.Certificate))
+			}
+			leaf, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if leaf.Subject.CommonName != "proxy.local" || len(leaf.IPAddresses) != 1 {
+				t.Errorf("unexpected subject %s and IP addresses %v", leaf.Subject, leaf.IPAddresses)
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(root.Certificate)
+			for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+				if _, err = leaf.Verify(x509.VerifyOptions{
+					DNSName:   "proxy.local",
+					Roots:     roots,
+					KeyUsages: []x509.ExtKeyUsage{usage},
+				}); err != nil {
+					t.Errorf("usage %d: %v", usage, err)
+				}
+			}
+		})
+	}
+}
+
+func TestIssueErrors(t *testing.T) {
+	ca, err := NewRootCA("Proxy Root CA", time.Hour, KeyECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, request := range map[string]LeafRequest{
+		"no name":       {Validity: time.Hour},
+		"unknown usage": {SANs: []string{"proxy.local"}, Validity: time.Hour, Usages: []string{"email"}},
+		"unknown key":   {SANs: []string{"proxy.local"}, Validity: time.Hour, KeyType: "dsa"},
+		"outlives CA":   {SANs: []string{"proxy.local"}, Validity: 2 * time.Hour},
+	} {
+		if _, _, err = ca.Issue(request); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	other, err := NewRootCA("Other CA", time.Hour, KeyECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := EncodeKey(other.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadCA(EncodeCertificates(ca.Certificate.Raw), otherKey); err == nil {
+		t.Error("expected the mismatched CA key to be rejected")
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/28
+
+// Package inspect describes the configured certificates and monitors their expiry.
+package inspect
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/tls"
+)
+
+// Source is a configured PEM content, a certificate followed by its chain or a bundle of CAs.
+type Source struct {
+	// Name tells where the content is configured.
+	Name    string
+	Content tls.FileOrContent
+}
+
+// CertificateInfo describes a certificate of a source.
+type CertificateInfo struct {
+	Source      string
+	Certificate *x509.Certificate
+	Subject     string
+	Issuer      string
+	SANs        []string
+	IsCA        bool
+	// ChainError is the reason the certificate does not verify against the system roots
+	// and the other certificates of its source, nil when it verifies.
+	ChainError error
+}
+
+// Sources returns the certificates of the entry points and of the servers transports.
+func Sources(cfg *config.Config) []Source {
+	var sources []Source
+	certificate := func(name string, c tls.Certificate) {
+		sources = append(sources, Source{
+			Name:    fmt.Sprintf("%s %s", name, c.GetTruncatedCertificateName()),
+			Content: c.CertFile,
+		})
+	}
+	bundle := func(name string, f tls.FileOrContent) {
+		sources = append(sources, Source{
+			Name:    fmt.Sprintf("%s %s", name, (&tls.Certificate{CertFile: f}).GetTruncatedCertificateName()),
+			Content: f,
+		})
+	}
+	for _, list := range []config.EntryPointList{cfg.Spec, cfg.Internal} {
+		for name, entryPoint := range list {
+			if entryPoint == nil || entryPoint.TLS == nil {
+				continue
+			}
+			prefix := "entryPoint " + string(name)
+			for _, c := range entryPoint.TLS.Certificates {
+				certificate(prefix+" certificate", c)
+			}
+			if entryPoint.TLS.DefaultCertificate != nil {
+				certificate(prefix+" default certificate", *entryPoint.TLS.DefaultCertificate)
+			}
+			if entryPoint.TLS.ClientAuth != nil {
+				for _, f := range entryPoint.TLS.ClientAuth.CAFiles {
+					bundle(prefix+" client CA", f)
+				}
+			}
+		}
+	}
+	for name, transport := range cfg.GetServersTransports() {
+		if transport == nil {
+			continue
+		}
+		prefix := "serversTransport " + name
+		for _, c := range transport.Certificates {
+			certificate(prefix+" certificate", c)
+		}
+		for _, f := range transport.RootCAs {
+			bundle(prefix+" root CA", f)
+		}
+	}
+	return sources
+}
+
+// Inspect parses the certificates of the source and verifies each of them at now.
+func Inspect(source Source, now time.Time) ([]*CertificateInfo, error) {
+	content, err := source.Content.Read()
+	if err != nil {
+		return nil, err
+	}
+	return InspectPEM(source.Name, content, now)
+}
+
+// InspectPEM parses the PEM certificates of content and verifies each of them at now,
+// the self-signed certificates of content are trusted and the others may be intermediates.
+func InspectPEM(name string, content []byte, now time.Time) ([]*CertificateInfo, error) {
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		certificates = append(certificates, cert)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("%s: no certificate found", name)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certificates {
+		if isSelfSigned(cert) {
+			roots.AddCert(cert)
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	infos := make([]*CertificateInfo, 0, len(certificates))
+	for _, cert := range certificates {
+		info := &CertificateInfo{
+			Source:      name,
+			Certificate: cert,
+			Subject:     cert.Subject.String(),
+			Issuer:      cert.Issuer.String(),
+			SANs:        SANs(cert),
+			IsCA:        cert.IsCA,
+		}
+		_, info.ChainError = cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// SANs returns the DNS names, IP addresses, emails and URIs of the certificate.
+func SANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// DaysToExpiry returns the number of whole days before the certificate expires, negative once expired.
+func (i *CertificateInfo) DaysToExpiry(now time.Time) int {
+	remaining := i.Certificate.NotAfter.Sub(now)
+	days := int(remaining / (24 * time.Hour))
+	if remaining < 0 {
+		days--
+	}
+	return days
+}
+
+// String describes the certificate on several indented lines.
+func (i *CertificateInfo) String() string {
+	return i.Format(time.Now())
+}
+
+// Format describes the certificate at now on several indented lines.
+func (i *CertificateInfo) Format(now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", i.Source)
+	fmt.Fprintf(&b, "  subject:   %s\n", i.Subject)
+	fmt.Fprintf(&b, "  issuer:    %s\n", i.Issuer)
+	if len(i.SANs) != 0 {
+		fmt.Fprintf(&b, "  SANs:      %s\n", strings.Join(i.SANs, ", "))
+	}
+	fmt.Fprintf(&b, "  serial:    %s\n", i.Certificate.SerialNumber)
+	if i.IsCA {
+		fmt.Fprintf(&b, "  CA:        true\n")
+	}
+	fmt.Fprintf(&b, "  not after: %s (%d days)\n", i.Certificate.NotAfter.Format(time.RFC3339), i.DaysToExpiry(now))
+	if i.ChainError != nil {
+		fmt.Fprintf(&b, "  chain:     invalid: %v\n", i.ChainError)
+	} else {
+		fmt.Fprintf(&b, "  chain:     valid\n")
+	}
+	return b.String()
+}
+
+// isSelfSigned reports whether the certificate is signed by its own key, CA or not.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/28
+
+package inspect
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/tls"
+	"github.com/crochee/proxy/tls/generate"
+)
+
+func TestInspectPEM(t *testing.T) {
+	ca, err := generate.NewRootCA("Test Root CA", 30*24*time.Hour, generate.KeyECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := ca.Issue(generate.LeafRequest{
+		SANs:     []string{"example.com", "127.0.0.1"},
+		Validity: 10 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	infos, err := InspectPEM("chain", ca.FullChain(leaf), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected the leaf and the CA, got %d certificates", len(infos))
+	}
+	if info := infos[0]; info.Subject != "CN=example.com" || info.Issuer != "CN=Test Root CA" ||
+		!reflect.DeepEqual(info.SANs, []string{"example.com", "127.0.0.1"}) || info.IsCA {
+		t.Errorf("unexpected leaf %+v", info)
+	}
+	for _, info := range infos {
+		if info.ChainError != nil {
+			t.Errorf("%s: unexpected chain error %v", info.Subject, info.ChainError)
+		}
+	}
+	if days := infos[0].DaysToExpiry(now); days != 9 {
+		t.Errorf("the leaf expires in %d days, want 9", days)
+	}
+
+	// without its CA the leaf does not verify.
+	if infos, err = InspectPEM("leaf", generate.EncodeCertificates(leaf), now); err != nil {
+		t.Fatal(err)
+	}
+	if infos[0].ChainError == nil {
+		t.Error("the chain of a leaf without its CA verifies")
+	}
+	if _, err = InspectPEM("empty", nil, now); err == nil {
+		t.Error("expected an error without certificate")
+	}
+}
+
+func TestMonitorCheck(t *testing.T) {
+	ca, err := generate.NewRootCA("Test Root CA", 365*24*time.Hour, generate.KeyECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(san string, validity time.Duration) tls.FileOrContent {
+		der, _, err := ca.Issue(generate.LeafRequest{SANs: []string{san}, Validity: validity})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tls.FileOrContent(ca.FullChain(der))
+	}
+	cfg := &config.Config{
+		Spec: config.EntryPointList{
+			"websecure": {Port: 443, TLS: &config.EntryPointTLS{
+				Certificates: tls.Certificates{
+					{CertFile: issue("soon.example.com", 10*24*time.Hour)},
+					{CertFile: issue("later.example.com", 90*24*time.Hour)},
+				},
+			}},
+		},
+		Transport: &config.ServersTransport{
+			RootCAs: []tls.FileOrContent{tls.FileOrContent(generate.EncodeCertificates(ca.Certificate.Raw))},
+		},
+	}
+	if n := len(Sources(cfg)); n != 3 {
+		t.Fatalf("expected 3 sources, got %d", n)
+	}
+	monitor := NewMonitor(&config.TLSMonitor{ExpiryThreshold: 20 * 24 * time.Hour}, func() *config.Config { return cfg })
+	expiring := monitor.Check(time.Now())
+	if len(expiring) != 1 || expiring[0].Subject != "CN=soon.example.com" {
+		t.Errorf("expected only soon.example.com to expire within the threshold, got %v", expiring)
+	}
+}
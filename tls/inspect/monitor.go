@@ -0,0 +1,93 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/28
+
+package inspect
+
+import (
+	"context"
+	"time"
+
+	"github.com/crochee/proxy/config"
+	"github.com/crochee/proxy/logger"
+	"github.com/crochee/proxy/metrics"
+)
+
+const (
+	// DefaultExpiryThreshold is how long before its expiry a certificate is reported by default.
+	DefaultExpiryThreshold = 30 * 24 * time.Hour
+	// DefaultInterval is the default period of the inspections.
+	DefaultInterval = 12 * time.Hour
+)
+
+// Monitor periodically inspects the configured certificates,
+// it logs the certificates expiring within the threshold and those whose chain does not verify.
+type Monitor struct {
+	threshold time.Duration
+	interval  time.Duration
+	// current returns the active configuration, its certificates are read on each inspection.
+	current func() *config.Config
+}
+
+// NewMonitor creates a monitor of the certificates of the configuration returned by current.
+func NewMonitor(cfg *config.TLSMonitor, current func() *config.Config) *Monitor {
+	m := &Monitor{threshold: DefaultExpiryThreshold, interval: DefaultInterval, current: current}
+	if cfg != nil {
+		if cfg.ExpiryThreshold > 0 {
+			m.threshold = cfg.ExpiryThreshold
+		}
+		if cfg.Interval > 0 {
+			m.interval = cfg.Interval
+		}
+	}
+	return m
+}
+
+// Run inspects the certificates every interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.Check(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check inspects the certificates at now and returns those expiring within the threshold.
+func (m *Monitor) Check(now time.Time) []*CertificateInfo {
+	cfg := m.current()
+	if cfg == nil {
+		return nil
+	}
+	var expiring []*CertificateInfo
+	for _, source := range Sources(cfg) {
+		infos, err := Inspect(source, now)
+		if err != nil {
+			logger.Errorf("Unable to inspect the certificates of %s: %v", source.Name, err)
+			continue
+		}
+		for _, info := range infos {
+			soon := now.Add(m.threshold).After(info.Certificate.NotAfter)
+			metrics.SetCertificateExpiry(info.Certificate)
+			metrics.ObserveCertificateCheck(info.Certificate, source.Name, soon, info.ChainError == nil)
+			switch {
+			case !now.Before(info.Certificate.NotAfter):
+				logger.Errorf("Certificate %s of %s expired on %s", info.Subject, source.Name,
+					info.Certificate.NotAfter.Format(time.RFC3339))
+			case soon:
+				logger.Warnf("Certificate %s of %s expires in %d days on %s", info.Subject, source.Name,
+					info.DaysToExpiry(now), info.Certificate.NotAfter.Format(time.RFC3339))
+			case info.ChainError != nil:
+				logger.Warnf("Certificate %s of %s has an invalid chain: %v", info.Subject, source.Name, info.ChainError)
+			}
+			if soon {
+				expiring = append(expiring, info)
+			}
+		}
+	}
+	return expiring
+}
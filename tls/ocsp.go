@@ -0,0 +1,261 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/27
+
+package tls
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/crochee/proxy/logger"
+)
+
+const (
+	// ocspCheckInterval is the period at which the certificates are checked for a due OCSP response.
+	ocspCheckInterval = time.Minute
+	// ocspRetryDelay is the delay before a failed OCSP request is retried.
+	ocspRetryDelay = 5 * time.Minute
+	// ocspRefreshMargin is how long before its NextUpdate a response is refreshed at most.
+	ocspRefreshMargin = time.Hour
+	// ocspDefaultLifetime is how long a response without NextUpdate is kept.
+	ocspDefaultLifetime = time.Hour
+	// ocspTimeout bounds an OCSP request.
+	ocspTimeout = 30 * time.Second
+	// maxOCSPResponseSize bounds the responses read from the responders and the issuer certificates.
+	maxOCSPResponseSize = 1 << 20
+)
+
+// OCSP statuses reported to the OCSPListener.
+const (
+	OCSPGood    = "good"
+	OCSPRevoked = "revoked"
+	OCSPUnknown = "unknown"
+	OCSPError   = "error"
+)
+
+// OCSPListener is notified of each OCSP request, nextUpdate is zero unless the status is OCSPGood.
+type OCSPListener func(leaf *x509.Certificate, status string, nextUpdate time.Time)
+
+// ocspState is the stapling state of a certificate.
+type ocspState struct {
+	// leaf is the certificate the state belongs to, the state is reset when it is reloaded.
+	leaf       *x509.Certificate
+	refreshAt  time.Time
+	nextUpdate time.Time
+}
+
+// StapleOCSP staples the OCSP responses of the configured certificates until ctx is done.
+// A response is refreshed shortly before its NextUpdate. A failure is logged and reported to listener,
+// the certificate is served with its previous response while it is valid, then without response.
+// The response of a revoked certificate is stapled, a certificate unknown to the responder is served without response.
+func (s *CertificateStore) StapleOCSP(ctx context.Context, listener OCSPListener) {
+	client := &http.Client{Timeout: ocspTimeout}
+	ticker := time.NewTicker(ocspCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.stapleOCSP(ctx, client, listener)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stapleOCSP requests the OCSP responses which are due.
+func (s *CertificateStore) stapleOCSP(ctx context.Context, client *http.Client, listener OCSPListener) {
+	type due struct {
+		source *certificateSource
+		cert   *tls.Certificate
+	}
+	var list []due
+	now := time.Now()
+	s.sourcesMu.Lock()
+	for _, source := range s.sources {
+		leaf := source.cert.Leaf
+		if len(leaf.OCSPServer) == 0 {
+			continue
+		}
+		if source.ocsp.leaf != leaf || !now.Before(source.ocsp.refreshAt) {
+			list = append(list, due{source: source, cert: source.cert})
+		}
+	}
+	s.sourcesMu.Unlock()
+
+	for _, d := range list {
+		leaf := d.cert.Leaf
+		raw, response, err := fetchOCSP(ctx, client, d.cert)
+		status := ocspStatus(response)
+		var nextUpdate time.Time
+		if status == OCSPGood {
+			nextUpdate = response.NextUpdate
+		}
+		if listener != nil {
+			listener(leaf, status, nextUpdate)
+		}
+		switch status {
+		case OCSPError:
+			logger.Errorf("Unable to staple the OCSP response of %s: %v", leaf.Subject.CommonName, err)
+		case OCSPRevoked:
+			logger.Errorf("The certificate of %s is revoked on %s, its OCSP response is stapled",
+				leaf.Subject.CommonName, response.RevokedAt.Format(time.RFC3339))
+		case OCSPUnknown:
+			logger.Errorf("Unable to staple the OCSP response of %s: certificate unknown to the responder",
+				leaf.Subject.CommonName)
+		}
+		s.applyOCSP(d.source, d.cert, raw, response, err)
+	}
+}
+
+// applyOCSP staples the response of cert, unless the certificate was reloaded meanwhile.
+// The previous response is kept on a failed request only, the signed responses replace it.
+func (s *CertificateStore) applyOCSP(source *certificateSource, cert *tls.Certificate, raw []byte,
+	response *ocsp.Response, err error) {
+	s.sourcesMu.Lock()
+	defer s.sourcesMu.Unlock()
+	if source.cert != cert {
+		return
+	}
+	now := time.Now()
+	var staple []byte
+	if err != nil {
+		source.ocsp.refreshAt = now.Add(ocspRetryDelay)
+		if source.ocsp.leaf == cert.Leaf && now.Before(source.ocsp.nextUpdate) {
+			// the previous response is still valid.
+			return
+		}
+		source.ocsp.nextUpdate = time.Time{}
+	} else if response.Status != ocsp.Good && response.Status != ocsp.Revoked {
+		// a certificate unknown to the responder is served without response.
+		source.ocsp.refreshAt = now.Add(ocspRetryDelay)
+		source.ocsp.nextUpdate = time.Time{}
+	} else {
+		staple = raw
+		source.ocsp.nextUpdate = response.NextUpdate
+		if response.NextUpdate.IsZero() {
+			source.ocsp.nextUpdate = now.Add(ocspDefaultLifetime)
+		}
+		source.ocsp.refreshAt = refreshTime(response.ThisUpdate, source.ocsp.nextUpdate, now)
+	}
+	source.ocsp.leaf = cert.Leaf
+	if bytes.Equal(cert.OCSPStaple, staple) {
+		return
+	}
+	// the served certificate is never modified, a handshake may be reading it.
+	stapled := *cert
+	stapled.OCSPStaple = staple
+	s.replace(cert, &stapled, source.isDefault)
+	source.cert = &stapled
+}
+
+// refreshTime returns when a response valid from thisUpdate to nextUpdate is refreshed:
+// ocspRefreshMargin before nextUpdate, or halfway for the short-lived responses.
+func refreshTime(thisUpdate, nextUpdate, now time.Time) time.Time {
+	margin := ocspRefreshMargin
+	if half := nextUpdate.Sub(thisUpdate) / 2; half < margin {
+		margin = half
+	}
+	refreshAt := nextUpdate.Add(-margin)
+	if refreshAt.Before(now) {
+		return now.Add(ocspRetryDelay)
+	}
+	return refreshAt
+}
+
+func ocspStatus(response *ocsp.Response) string {
+	if response == nil {
+		return OCSPError
+	}
+	switch response.Status {
+	case ocsp.Good:
+		return OCSPGood
+	case ocsp.Revoked:
+		return OCSPRevoked
+	default:
+		return OCSPUnknown
+	}
+}
+
+// fetchOCSP requests the OCSP response of cert from the first responder of its leaf.
+func fetchOCSP(ctx context.Context, client *http.Client, cert *tls.Certificate) ([]byte, *ocsp.Response, error) {
+	leaf := cert.Leaf
+	issuer, err := issuerOf(ctx, client, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	var request []byte
+	if request, err = ocsp.CreateRequest(leaf, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1}); err != nil {
+		return nil, nil, err
+	}
+	var raw []byte
+	if raw, err = post(ctx, client, leaf.OCSPServer[0], request); err != nil {
+		return nil, nil, err
+	}
+	var response *ocsp.Response
+	if response, err = ocsp.ParseResponseForCert(raw, leaf, issuer); err != nil {
+		return nil, nil, fmt.Errorf("invalid OCSP response from %s: %w", leaf.OCSPServer[0], err)
+	}
+	return raw, response, nil
+}
+
+// issuerOf returns the issuer of the leaf, from the chain or else from the issuing certificate URL of the leaf.
+func issuerOf(ctx context.Context, client *http.Client, cert *tls.Certificate) (*x509.Certificate, error) {
+	if len(cert.Certificate) > 1 {
+		return x509.ParseCertificate(cert.Certificate[1])
+	}
+	if len(cert.Leaf.IssuingCertificateURL) == 0 {
+		return nil, errors.New("no issuer certificate in the chain")
+	}
+	content, err := get(ctx, client, cert.Leaf.IssuingCertificateURL[0])
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(content); block != nil {
+		content = block.Bytes
+	}
+	return x509.ParseCertificate(content)
+}
+
+func post(ctx context.Context, client *http.Client, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+	return do(client, req)
+}
+
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return do(client, req)
+}
+
+func do(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxOCSPResponseSize))
+		return nil, fmt.Errorf("%s %s: unexpected status %s", req.Method, req.URL, resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseSize))
+}
@@ -0,0 +1,161 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/27
+
+package tls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestStapleOCSP(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := ocsp.Good
+	fail := false
+	responder := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if fail {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		request, err := ocsp.ParseRequest(body)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		response, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       status,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   now,
+			NextUpdate:   now.Add(4 * time.Hour),
+			RevokedAt:    now,
+		}, caKey)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = rw.Write(response)
+	}))
+	defer responder.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "ocsp.example.com"},
+		DNSNames:     []string{"ocsp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		OCSPServer:   []string{responder.URL},
+	}, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+	store, err := NewCertificateStore("websecure", Certificates{{
+		CertFile: FileOrContent(chain),
+		KeyFile:  FileOrContent(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses []string
+	staple := func() []byte {
+		t.Helper()
+		// the responses are due again.
+		store.sources[0].ocsp.refreshAt = time.Time{}
+		store.stapleOCSP(context.Background(), responder.Client(), func(_ *x509.Certificate, status string, _ time.Time) {
+			statuses = append(statuses, status)
+		})
+		cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "ocsp.example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.OCSPStaple
+	}
+
+	stapled := staple()
+	if response, err := ocsp.ParseResponseForCert(stapled, store.sources[0].cert.Leaf, ca); err != nil ||
+		response.Status != ocsp.Good {
+		t.Fatalf("expected a good response to be stapled, got %v", err)
+	}
+
+	fail = true
+	if got := staple(); string(got) != string(stapled) {
+		t.Error("a failure dropped the valid response")
+	}
+	store.sources[0].ocsp.nextUpdate = time.Now()
+	if got := staple(); got != nil {
+		t.Error("the expired response is still stapled")
+	}
+
+	fail = false
+	if staple() == nil {
+		t.Fatal("the good response is not stapled")
+	}
+	// the revoked response replaces the good one, clients must see the revocation.
+	status = ocsp.Revoked
+	if response, err := ocsp.ParseResponseForCert(staple(), store.sources[0].cert.Leaf, ca); err != nil ||
+		response.Status != ocsp.Revoked {
+		t.Errorf("expected the revoked response to be stapled, got %v", err)
+	}
+	status = ocsp.Unknown
+	if got := staple(); got != nil {
+		t.Error("the response of an unknown certificate is stapled")
+	}
+	want := []string{OCSPGood, OCSPError, OCSPError, OCSPGood, OCSPRevoked, OCSPUnknown}
+	if len(statuses) != len(want) {
+		t.Fatalf("got statuses %v, want %v", statuses, want)
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Errorf("got statuses %v, want %v", statuses, want)
+			break
+		}
+	}
+}
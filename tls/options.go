@@ -0,0 +1,137 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/25
+
+package tls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultOptionsName is the name of the options used by the entry points referencing none.
+const DefaultOptionsName = "default"
+
+// Versions maps the names of the TLS versions to their value.
+var Versions = map[string]uint16{
+	"VersionTLS10": tls.VersionTLS10,
+	"VersionTLS11": tls.VersionTLS11,
+	"VersionTLS12": tls.VersionTLS12,
+	"VersionTLS13": tls.VersionTLS13,
+}
+
+// Curves maps the names of the elliptic curves to their ID.
+var Curves = map[string]tls.CurveID{
+	"secp256r1": tls.CurveP256,
+	"CurveP256": tls.CurveP256,
+	"secp384r1": tls.CurveP384,
+	"CurveP384": tls.CurveP384,
+	"secp521r1": tls.CurveP521,
+	"CurveP521": tls.CurveP521,
+	"x25519":    tls.X25519,
+	"X25519":    tls.X25519,
+}
+
+// CipherSuites maps the names of the cipher suites known by crypto/tls to their ID.
+var CipherSuites = func() map[string]uint16 {
+	suites := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[suite.Name] = suite.ID
+	}
+	return suites
+}()
+
+// Options is a named TLS profile referenced by the entry points.
+// The cipher suites only apply up to TLS 1.2, the TLS 1.3 ones are not configurable.
+type Options struct {
+	MinVersion               string   `json:"minVersion,omitempty" toml:"minVersion,omitempty" yaml:"minVersion,omitempty"`
+	MaxVersion               string   `json:"maxVersion,omitempty" toml:"maxVersion,omitempty" yaml:"maxVersion,omitempty"`
+	CipherSuites             []string `json:"cipherSuites,omitempty" toml:"cipherSuites,omitempty" yaml:"cipherSuites,omitempty"`
+	CurvePreferences         []string `json:"curvePreferences,omitempty" toml:"curvePreferences,omitempty" yaml:"curvePreferences,omitempty"`
+	PreferServerCipherSuites bool     `json:"preferServerCipherSuites,omitempty" toml:"preferServerCipherSuites,omitempty" yaml:"preferServerCipherSuites,omitempty"`
+	ALPNProtocols            []string `json:"alpnProtocols,omitempty" toml:"alpnProtocols,omitempty" yaml:"alpnProtocols,omitempty"`
+	// SniStrict rejects the handshakes whose SNI matches no certificate instead of serving the default one.
+	SniStrict bool `json:"sniStrict,omitempty" toml:"sniStrict,omitempty" yaml:"sniStrict,omitempty"`
+}
+
+// Validate checks the names used by the options.
+func (o *Options) Validate() error {
+	_, err := o.build()
+	return err
+}
+
+// Apply sets the options on config.
+func (o *Options) Apply(config *tls.Config) error {
+	built, err := o.build()
+	if err != nil {
+		return err
+	}
+	config.MinVersion = built.MinVersion
+	config.MaxVersion = built.MaxVersion
+	config.CipherSuites = built.CipherSuites
+	config.CurvePreferences = built.CurvePreferences
+	config.PreferServerCipherSuites = built.PreferServerCipherSuites
+	config.NextProtos = built.NextProtos
+	return nil
+}
+
+func (o *Options) build() (*tls.Config, error) {
+	config := &tls.Config{
+		PreferServerCipherSuites: o.PreferServerCipherSuites,
+		NextProtos:               o.ALPNProtocols,
+	}
+	var err error
+	if config.MinVersion, err = lookupVersion(o.MinVersion); err != nil {
+		return nil, err
+	}
+	if config.MaxVersion, err = lookupVersion(o.MaxVersion); err != nil {
+		return nil, err
+	}
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return nil, fmt.Errorf("minVersion %s is greater than maxVersion %s", o.MinVersion, o.MaxVersion)
+	}
+	for _, name := range o.CipherSuites {
+		id, ok := CipherSuites[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %s, valid cipher suites are: %s", name, keys(CipherSuites))
+		}
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+	for _, name := range o.CurvePreferences {
+		id, ok := Curves[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %s, valid curves are: %s", name, keys(Curves))
+		}
+		config.CurvePreferences = append(config.CurvePreferences, id)
+	}
+	return config, nil
+}
+
+func lookupVersion(name string) (uint16, error) {
+	if name == "" {
+		return 0, nil
+	}
+	version, ok := Versions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %s, valid versions are: %s", name, keys(Versions))
+	}
+	return version, nil
+}
+
+func keys(m interface{}) string {
+	var names []string
+	switch v := m.(type) {
+	case map[string]uint16:
+		for name := range v {
+			names = append(names, name)
+		}
+	case map[string]tls.CurveID:
+		for name := range v {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
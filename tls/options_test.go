@@ -0,0 +1,56 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/25
+
+package tls
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	options := &Options{
+		MinVersion:       "VersionTLS12",
+		MaxVersion:       "VersionTLS13",
+		CipherSuites:     []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		CurvePreferences: []string{"X25519", "secp256r1"},
+		ALPNProtocols:    []string{"http/1.1"},
+	}
+	config := &tls.Config{}
+	if err := options.Apply(config); err != nil {
+		t.Fatal(err)
+	}
+	if config.MinVersion != tls.VersionTLS12 || config.MaxVersion != tls.VersionTLS13 ||
+		len(config.CipherSuites) != 1 || config.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 ||
+		len(config.CurvePreferences) != 2 || config.CurvePreferences[1] != tls.CurveP256 ||
+		config.NextProtos[0] != "http/1.1" {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	err := (&Options{CipherSuites: []string{"TLS_NOPE"}}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256") {
+		t.Errorf("unknown cipher should list the valid ones: %v", err)
+	}
+	if err = (&Options{MinVersion: "VersionTLS13", MaxVersion: "VersionTLS12"}).Validate(); err == nil {
+		t.Error("minVersion greater than maxVersion should be rejected")
+	}
+	if err = (&Options{CurvePreferences: []string{"P-999"}}).Validate(); err == nil {
+		t.Error("unknown curve should be rejected")
+	}
+}
+
+func TestSniStrict(t *testing.T) {
+	certificates := Certificates{newCertificate(t, "a.example.com")}
+	config, _, err := certificates.CreateTLSConfig("websecure", nil, &Options{SniStrict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = config.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.example.com"}); err != nil {
+		t.Error(err)
+	}
+	if _, err = config.GetCertificate(&tls.ClientHelloInfo{ServerName: "b.example.com"}); err == nil {
+		t.Error("strict SNI should reject an unknown server name")
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/22
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crochee/proxy/logger"
+)
+
+const (
+	tracesPath = "/v1/traces"
+	scopeName  = "github.com/crochee/proxy"
+)
+
+// exporter batches the ended spans and sends them to an OTLP/HTTP collector with the JSON encoding.
+type exporter struct {
+	url           string
+	headers       map[string]string
+	serviceName   string
+	batchSize     int
+	flushInterval time.Duration
+	queue         chan *Span
+	client        *http.Client
+}
+
+func newExporter(endpoint string, headers map[string]string, serviceName string, batchSize int,
+	flushInterval time.Duration) *exporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, tracesPath) {
+		url += tracesPath
+	}
+	return &exporter{
+		url:           url,
+		headers:       headers,
+		serviceName:   serviceName,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		queue:         make(chan *Span, batchSize*4),
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// export queues the span, it is dropped when the queue is full so that requests are never blocked.
+func (e *exporter) export(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		logger.Debugf("tracing: queue is full, span %s dropped", span.name)
+	}
+}
+
+func (e *exporter) run(ctx context.Context) {
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, e.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			logger.Errorf("tracing: unable to export %d spans: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *exporter) send(spans []*Span) error {
+	body, err := json.Marshal(e.buildRequest(spans))
+	if err != nil {
+		return err
+	}
+	var req *http.Request
+	if req, err = http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body)); err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	var resp *http.Response
+	if resp, err = e.client.Do(req); err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// The types below are the OTLP/JSON representation of ExportTraceServiceRequest.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanData `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type spanData struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	TraceState        string     `json:"traceState,omitempty"`
+	Name              string     `json:"name"`
+	Kind              SpanKind   `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type status struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *exporter) buildRequest(spans []*Span) exportRequest {
+	data := make([]spanData, 0, len(spans))
+	for _, span := range spans {
+		span.mu.Lock()
+		sd := spanData{
+			TraceID:           span.spanContext.TraceID.String(),
+			SpanID:            span.spanContext.SpanID.String(),
+			TraceState:        span.spanContext.TraceState,
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        toKeyValues(span.attributes),
+			Status:            status{Code: span.statusCode, Message: span.statusMessage},
+		}
+		span.mu.Unlock()
+		if span.parentSpanID.IsValid() {
+			sd.ParentSpanID = span.parentSpanID.String()
+		}
+		data = append(data, sd)
+	}
+	return exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{Attributes: toKeyValues([]Attribute{{Key: "service.name", Value: e.serviceName}})},
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: scopeName},
+				Spans: data,
+			}},
+		}},
+	}
+}
+
+func toKeyValues(attributes []Attribute) []keyValue {
+	kvs := make([]keyValue, 0, len(attributes))
+	for _, attribute := range attributes {
+		kv := keyValue{Key: attribute.Key}
+		switch v := attribute.Value.(type) {
+		case string:
+			kv.Value.StringValue = &v
+		case bool:
+			kv.Value.BoolValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			kv.Value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			kv.Value.IntValue = &s
+		case float64:
+			kv.Value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			kv.Value.StringValue = &s
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs
+}
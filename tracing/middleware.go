@@ -0,0 +1,133 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/22
+
+package tracing
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/crochee/proxy/middlewares"
+)
+
+// entryPointMiddleware starts the server span of the requests received by an entry point.
+type entryPointMiddleware struct {
+	next       http.Handler
+	entryPoint string
+	tracer     *Tracer
+}
+
+// NewEntryPointMiddleware creates the server span middleware of an entry point,
+// it continues the trace of the W3C trace context headers sent by the client.
+func NewEntryPointMiddleware(next http.Handler, entryPoint string) http.Handler {
+	if tracer == nil {
+		return next
+	}
+	return &entryPointMiddleware{next: next, entryPoint: entryPoint, tracer: tracer}
+}
+
+func (e *entryPointMiddleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if sc, ok := Extract(req.Header); ok {
+		ctx = ContextWithRemoteSpanContext(ctx, sc)
+	}
+	ctx, span := e.tracer.Start(ctx, "EntryPoint "+e.entryPoint, SpanKindServer)
+	defer span.End()
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	span.SetAttributes(
+		Attribute{Key: "entrypoint", Value: e.entryPoint},
+		Attribute{Key: "http.method", Value: req.Method},
+		Attribute{Key: "http.scheme", Value: scheme},
+		Attribute{Key: "http.host", Value: req.Host},
+		Attribute{Key: "http.target", Value: req.URL.RequestURI()},
+		Attribute{Key: "http.flavor", Value: fmt.Sprintf("%d.%d", req.ProtoMajor, req.ProtoMinor)},
+		Attribute{Key: "http.user_agent", Value: req.UserAgent()},
+	)
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		span.SetAttributes(Attribute{Key: "net.peer.ip", Value: host})
+	}
+
+	recorder := middlewares.NewResponseWriter(rw)
+	e.next.ServeHTTP(recorder, req.WithContext(ctx))
+
+	span.SetAttributes(Attribute{Key: "http.status_code", Value: recorder.Status()})
+	if recorder.Status() >= http.StatusInternalServerError {
+		span.SetStatus(StatusError, http.StatusText(recorder.Status()))
+	}
+}
+
+// middlewareSpan wraps a middleware in a child span of the current one.
+type middlewareSpan struct {
+	next   http.Handler
+	name   string
+	tracer *Tracer
+}
+
+// WrapMiddleware creates a child span named after the middleware around each of its requests.
+func WrapMiddleware(next http.Handler, name string) http.Handler {
+	if tracer == nil {
+		return next
+	}
+	return &middlewareSpan{next: next, name: name, tracer: tracer}
+}
+
+func (m *middlewareSpan) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	ctx, span := m.tracer.Start(req.Context(), m.name, SpanKindInternal)
+	defer span.End()
+	span.SetAttributes(Attribute{Key: "middleware", Value: m.name})
+	m.next.ServeHTTP(rw, req.WithContext(ctx))
+}
+
+// transport creates the client span of the requests sent to the backends.
+type transport struct {
+	next   http.RoundTripper
+	tracer *Tracer
+}
+
+// NewTransport wraps the round tripper with a client span and injects the trace context in the upstream request.
+func NewTransport(next http.RoundTripper) http.RoundTripper {
+	if tracer == nil {
+		return next
+	}
+	return &transport{next: next, tracer: tracer}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), "Forward "+req.Method, SpanKindClient)
+	defer span.End()
+
+	span.SetAttributes(
+		Attribute{Key: "http.method", Value: req.Method},
+		Attribute{Key: "http.url", Value: req.URL.String()},
+		Attribute{Key: "net.peer.name", Value: req.URL.Host},
+	)
+
+	// RoundTrip must not modify the request, the headers are copied before the injection.
+	outReq := req.WithContext(ctx)
+	outReq.Header = req.Header.Clone()
+	Inject(span.SpanContext(), outReq.Header)
+
+	resp, err := t.next.RoundTrip(outReq)
+	if err != nil {
+		span.SetStatus(StatusError, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(Attribute{Key: "http.status_code", Value: resp.StatusCode})
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(StatusError, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped round tripper.
+func (t *transport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
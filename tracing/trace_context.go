@@ -0,0 +1,142 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/22
+
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TraceParentHeader is the W3C trace context header carrying the trace and parent span ids.
+	TraceParentHeader = "Traceparent"
+	// TraceStateHeader is the W3C trace context header carrying vendor specific data.
+	TraceStateHeader = "Tracestate"
+
+	traceContextVersion = "00"
+	flagSampled         = 0x01
+	maxTraceStateLength = 512
+)
+
+// TraceID is a unique identity of a trace.
+type TraceID [16]byte
+
+// IsValid checks whether the trace id is not all zeros.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID is a unique identity of a span in a trace.
+type SpanID [8]byte
+
+// IsValid checks whether the span id is not all zeros.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is the part of a span propagated between processes.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	Remote     bool
+}
+
+// IsValid checks whether the span context has both a trace and a span id.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled reports whether the sampled flag is set.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&flagSampled == flagSampled
+}
+
+// Extract reads the W3C trace context headers, ok is false when no valid traceparent was received.
+func Extract(header http.Header) (sc SpanContext, ok bool) {
+	sc, err := ParseTraceParent(header.Get(TraceParentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	if state := strings.Join(header.Values(TraceStateHeader), ","); len(state) <= maxTraceStateLength {
+		sc.TraceState = state
+	}
+	sc.Remote = true
+	return sc, true
+}
+
+// Inject writes the W3C trace context headers of the span context.
+func Inject(sc SpanContext, header http.Header) {
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(TraceParentHeader, FormatTraceParent(sc))
+	if sc.TraceState != "" {
+		header.Set(TraceStateHeader, sc.TraceState)
+	} else {
+		header.Del(TraceStateHeader)
+	}
+}
+
+// FormatTraceParent formats the span context as a traceparent value.
+func FormatTraceParent(sc SpanContext) string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceContextVersion, sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceParent parses a traceparent value such as 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func ParseTraceParent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	version := parts[0]
+	if len(version) != 2 || version == "ff" || !isLowerHex(version) {
+		return sc, fmt.Errorf("invalid traceparent version %q", version)
+	}
+	// future versions may append fields, version 00 must have exactly four.
+	if version == traceContextVersion && len(parts) != 4 {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	if len(parts[1]) != 32 || !isLowerHex(parts[1]) {
+		return sc, fmt.Errorf("invalid trace id %q", parts[1])
+	}
+	if len(parts[2]) != 16 || !isLowerHex(parts[2]) {
+		return sc, fmt.Errorf("invalid parent id %q", parts[2])
+	}
+	if len(parts[3]) != 2 || !isLowerHex(parts[3]) {
+		return sc, fmt.Errorf("invalid trace flags %q", parts[3])
+	}
+	_, _ = hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	_, _ = hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	var flags [1]byte
+	_, _ = hex.Decode(flags[:], []byte(parts[3]))
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+	return sc, nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
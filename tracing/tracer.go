@@ -0,0 +1,153 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/22
+
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/crochee/proxy/config"
+)
+
+const (
+	// DefaultServiceName is the service.name resource attribute of the spans.
+	DefaultServiceName = "proxy"
+
+	defaultBatchSize     = 512
+	defaultFlushInterval = 5 * time.Second
+)
+
+// Tracer creates the spans and samples the traces.
+type Tracer struct {
+	serviceName string
+	// traces whose 8 last bytes of the trace id are below the bound are sampled.
+	sampleBound uint64
+	exporter    *exporter
+}
+
+var tracer *Tracer
+
+// Init creates the global tracer from the configuration, spans are not created until it is called.
+func Init(cfg *config.Tracing) error {
+	t, err := NewTracer(cfg)
+	if err != nil {
+		return err
+	}
+	tracer = t
+	return nil
+}
+
+// Run exports the spans of the global tracer until ctx is done, then flushes the remaining spans.
+func Run(ctx context.Context) {
+	if tracer == nil {
+		return
+	}
+	tracer.Run(ctx)
+}
+
+// Enabled reports whether spans are created.
+func Enabled() bool {
+	return tracer != nil
+}
+
+// NewTracer creates a tracer exporting its spans to the configured OTLP/HTTP endpoint.
+func NewTracer(cfg *config.Tracing) (*Tracer, error) {
+	if cfg == nil || cfg.Endpoint == "" {
+		return nil, errors.New("tracing: no endpoint given")
+	}
+	ratio := 1.0
+	if cfg.SamplingRatio != nil {
+		ratio = *cfg.SamplingRatio
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("tracing: sampling ratio %v must be between 0 and 1", ratio)
+	}
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	flushInterval := cfg.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	t := &Tracer{
+		serviceName: serviceName,
+		exporter:    newExporter(cfg.Endpoint, cfg.Headers, serviceName, batchSize, flushInterval),
+	}
+	if ratio >= 1 {
+		t.sampleBound = ^uint64(0)
+	} else {
+		t.sampleBound = uint64(ratio * (1 << 63) * 2)
+	}
+	return t, nil
+}
+
+// Run exports the spans until ctx is done, then flushes the remaining spans.
+func (t *Tracer) Run(ctx context.Context) {
+	t.exporter.run(ctx)
+}
+
+// Start creates a span, child of the span of ctx, or of the remote span context received by the entry point.
+// The sampling decision of the parent is kept, root spans are sampled by the trace id ratio.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+	}
+
+	var parent SpanContext
+	if parentSpan := SpanFromContext(ctx); parentSpan != nil {
+		parent = parentSpan.SpanContext()
+	} else if remote, ok := remoteSpanContextFromContext(ctx); ok {
+		parent = remote
+	}
+
+	if parent.IsValid() {
+		span.spanContext.TraceID = parent.TraceID
+		span.spanContext.TraceState = parent.TraceState
+		span.spanContext.Flags = parent.Flags
+		span.parentSpanID = parent.SpanID
+	} else {
+		span.spanContext.TraceID = newTraceID()
+		if t.shouldSample(span.spanContext.TraceID) {
+			span.spanContext.Flags |= flagSampled
+		}
+	}
+	span.spanContext.SpanID = newSpanID()
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) shouldSample(id TraceID) bool {
+	if t.sampleBound == ^uint64(0) {
+		return true
+	}
+	return binary.BigEndian.Uint64(id[8:]) < t.sampleBound
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,137 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/22
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/crochee/proxy/config"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	sc, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+	if !sc.IsSampled() {
+		t.Fatal("expected sampled flag")
+	}
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, err = ParseTraceParent(invalid); err == nil {
+			t.Errorf("%q should be rejected", invalid)
+		}
+	}
+}
+
+func TestExportToCollector(t *testing.T) {
+	received := make(chan exportRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != tracesPath || req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected export %s %s", req.URL.Path, req.Header.Get("Content-Type"))
+		}
+		var body exportRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		received <- body
+	}))
+	defer collector.Close()
+
+	var upstreamParent string
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		upstreamParent = req.Header.Get(TraceParentHeader)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+
+	if err := Init(&config.Tracing{Endpoint: collector.URL, FlushInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { tracer = nil }()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx)
+		close(done)
+	}()
+
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport)}
+	handler := NewEntryPointMiddleware(WrapMiddleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		outReq, _ := http.NewRequestWithContext(req.Context(), http.MethodGet, backend.URL, nil)
+		resp, err := client.Do(outReq)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+		rw.WriteHeader(resp.StatusCode)
+	}), "test"), "web")
+
+	req := httptest.NewRequest(http.MethodGet, "http://proxy.local/", nil)
+	req.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(TraceStateHeader, "vendor=value")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	cancel()
+	<-done
+
+	var body exportRequest
+	select {
+	case body = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no export received")
+	}
+	spans := body.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	byKind := make(map[SpanKind]spanData)
+	for _, span := range spans {
+		if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("span %s did not continue the trace: %s", span.Name, span.TraceID)
+		}
+		if span.TraceState != "vendor=value" {
+			t.Errorf("span %s lost the trace state: %q", span.Name, span.TraceState)
+		}
+		byKind[span.Kind] = span
+	}
+	serverSpan, internal, clientSpan := byKind[SpanKindServer], byKind[SpanKindInternal], byKind[SpanKindClient]
+	if serverSpan.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("server span parent = %s", serverSpan.ParentSpanID)
+	}
+	if internal.ParentSpanID != serverSpan.SpanID || clientSpan.ParentSpanID != internal.SpanID {
+		t.Errorf("unexpected span tree %+v", spans)
+	}
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + clientSpan.SpanID + "-01"; upstreamParent != want {
+		t.Errorf("upstream traceparent = %s, want %s", upstreamParent, want)
+	}
+}
+
+func TestSamplingRatio(t *testing.T) {
+	never := 0.0
+	tr, err := NewTracer(&config.Tracing{Endpoint: "http://127.0.0.1:4318", SamplingRatio: &never})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tr.Start(context.Background(), "root", SpanKindServer)
+	if span.IsRecording() || !span.SpanContext().IsValid() {
+		t.Fatalf("unsampled span should only propagate its context: %+v", span.SpanContext())
+	}
+}
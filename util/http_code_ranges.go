@@ -0,0 +1,61 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/1/20
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HTTPCodeRanges holds HTTP code ranges.
+type HTTPCodeRanges [][2]int
+
+// NewHTTPCodeRanges creates HTTPCodeRanges from a given []string.
+// Break out the http status code ranges into a low int and high int
+// for ease of use at runtime.
+func NewHTTPCodeRanges(strBlocks []string) (HTTPCodeRanges, error) {
+	var blocks HTTPCodeRanges
+	for _, block := range strBlocks {
+		for _, item := range strings.Split(block, ",") {
+			codes := strings.Split(strings.TrimSpace(item), "-")
+			// if only a single HTTP code was configured, assume the best and create the correct configuration on the user's behalf
+			if len(codes) == 1 {
+				codes = append(codes, codes[0])
+			}
+			if len(codes) != 2 {
+				return nil, fmt.Errorf("invalid status code range %q", item)
+			}
+			lowCode, err := strconv.Atoi(strings.TrimSpace(codes[0]))
+			if err != nil {
+				return nil, err
+			}
+			var highCode int
+			if highCode, err = strconv.Atoi(strings.TrimSpace(codes[1])); err != nil {
+				return nil, err
+			}
+			if lowCode > highCode {
+				return nil, fmt.Errorf("invalid status code range %q", item)
+			}
+			blocks = append(blocks, [2]int{lowCode, highCode})
+		}
+	}
+	if len(blocks) == 0 {
+		return nil, errors.New("no status code range provided")
+	}
+	return blocks, nil
+}
+
+// Contains tests whether the passed status code is within
+// one of its HTTP code ranges.
+func (h HTTPCodeRanges) Contains(statusCode int) bool {
+	for _, block := range h {
+		if statusCode >= block[0] && statusCode <= block[1] {
+			return true
+		}
+	}
+	return false
+}
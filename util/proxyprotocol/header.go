@@ -0,0 +1,218 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/3
+
+// Package proxyprotocol reads and writes the PROXY protocol headers carrying the addresses of the clients
+// through the L4 load balancers, https://www.haproxy.org/download/2.3/doc/proxy-protocol.txt.
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	v1Prefix = "PROXY "
+	// v1MaxLen is the length of the longest v1 header, its CRLF included.
+	v1MaxLen = 107
+
+	v2HeaderLen = 16
+	v2Version   = 0x20
+	v2CmdLocal  = 0x00
+	v2CmdProxy  = 0x01
+	v2FamUnspec = 0x00
+	v2FamTCP4   = 0x11
+	v2FamTCP6   = 0x21
+	v2AddrsTCP4 = 12
+	v2AddrsTCP6 = 36
+)
+
+// v2Signature starts the v2 headers.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidHeader is returned for a malformed PROXY protocol header.
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// ReadHeader reads the PROXY protocol header at the beginning of br and returns the addresses it carries,
+// nil when there is no header or when it carries no address, such as the health checks of the load balancers.
+func ReadHeader(br *bufio.Reader) (src, dst net.Addr, err error) {
+	first, err := br.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch first[0] {
+	case v1Prefix[0]:
+		var prefix []byte
+		if prefix, err = br.Peek(len(v1Prefix)); err != nil || string(prefix) != v1Prefix {
+			return nil, nil, ignoreEOF(err)
+		}
+		return readV1(br)
+	case v2Signature[0]:
+		var prefix []byte
+		if prefix, err = br.Peek(len(v2Signature)); err != nil || !bytes.Equal(prefix, v2Signature) {
+			return nil, nil, ignoreEOF(err)
+		}
+		return readV2(br)
+	default:
+		return nil, nil, nil
+	}
+}
+
+// ignoreEOF reports the end of a connection too short to carry a header as the absence of header.
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+func readV1(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLen {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, fmt.Errorf("%w: v1 header without CRLF", ErrInvalidHeader)
+	}
+	fields := strings.Split(string(line[len(v1Prefix):len(line)-2]), " ")
+	if fields[0] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 5 || (fields[0] != "TCP4" && fields[0] != "TCP6") {
+		return nil, nil, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+	src, err := tcpAddr(fields[1], fields[3], fields[0] == "TCP4")
+	if err != nil {
+		return nil, nil, err
+	}
+	var dst *net.TCPAddr
+	if dst, err = tcpAddr(fields[2], fields[4], fields[0] == "TCP4"); err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func tcpAddr(host, port string, v4 bool) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || strings.Contains(host, ":") == v4 {
+		return nil, fmt.Errorf("%w: invalid address %s", ErrInvalidHeader, host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid port %s", ErrInvalidHeader, port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+func readV2(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, v2HeaderLen)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, nil, err
+	}
+	if header[12]&0xF0 != v2Version {
+		return nil, nil, fmt.Errorf("%w: unknown version %#x", ErrInvalidHeader, header[12]>>4)
+	}
+	command := header[12] & 0x0F
+	family := header[13]
+	addrs := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(br, addrs); err != nil {
+		return nil, nil, err
+	}
+	switch command {
+	case v2CmdLocal:
+		return nil, nil, nil
+	case v2CmdProxy:
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown command %#x", ErrInvalidHeader, command)
+	}
+	switch family {
+	case v2FamTCP4:
+		if len(addrs) < v2AddrsTCP4 {
+			return nil, nil, fmt.Errorf("%w: short TCP4 addresses", ErrInvalidHeader)
+		}
+		return &net.TCPAddr{IP: net.IP(addrs[0:4]), Port: int(binary.BigEndian.Uint16(addrs[8:]))},
+			&net.TCPAddr{IP: net.IP(addrs[4:8]), Port: int(binary.BigEndian.Uint16(addrs[10:]))}, nil
+	case v2FamTCP6:
+		if len(addrs) < v2AddrsTCP6 {
+			return nil, nil, fmt.Errorf("%w: short TCP6 addresses", ErrInvalidHeader)
+		}
+		return &net.TCPAddr{IP: net.IP(addrs[0:16]), Port: int(binary.BigEndian.Uint16(addrs[32:]))},
+			&net.TCPAddr{IP: net.IP(addrs[16:32]), Port: int(binary.BigEndian.Uint16(addrs[34:]))}, nil
+	default:
+		// the other families, such as UDP or unix, do not address a TCP connection.
+		return nil, nil, nil
+	}
+}
+
+// WriteHeader writes the PROXY protocol header of the given version carrying src and dst,
+// a header without address is written when src is not a TCP address.
+// The unspecified address stands for a dst which is not a TCP address, and IPv4-mapped addresses
+// carry the IPv4 address of a header mixing both families.
+func WriteHeader(w io.Writer, version int, src, dst net.Addr) error {
+	srcTCP, _ := src.(*net.TCPAddr)
+	dstTCP, _ := dst.(*net.TCPAddr)
+	if srcTCP != nil && dstTCP == nil {
+		dstTCP = &net.TCPAddr{IP: net.IPv6unspecified}
+		if srcTCP.IP.To4() != nil {
+			dstTCP.IP = net.IPv4zero
+		}
+	}
+	v4 := srcTCP != nil && srcTCP.IP.To4() != nil && dstTCP.IP.To4() != nil
+	v6 := srcTCP != nil && !v4
+	var header []byte
+	switch version {
+	case 1:
+		switch {
+		case v4:
+			header = []byte(fmt.Sprintf("PROXY TCP4 %s %s %d %d\r\n", srcTCP.IP, dstTCP.IP, srcTCP.Port, dstTCP.Port))
+		case v6:
+			header = []byte(fmt.Sprintf("PROXY TCP6 %s %s %d %d\r\n", ipv6(srcTCP.IP), ipv6(dstTCP.IP),
+				srcTCP.Port, dstTCP.Port))
+		default:
+			header = []byte("PROXY UNKNOWN\r\n")
+		}
+	case 2:
+		header = append(header, v2Signature...)
+		switch {
+		case v4:
+			header = append(header, v2Version|v2CmdProxy, v2FamTCP4, 0, v2AddrsTCP4)
+			header = append(header, srcTCP.IP.To4()...)
+			header = append(header, dstTCP.IP.To4()...)
+		case v6:
+			header = append(header, v2Version|v2CmdProxy, v2FamTCP6, 0, v2AddrsTCP6)
+			header = append(header, srcTCP.IP.To16()...)
+			header = append(header, dstTCP.IP.To16()...)
+		default:
+			header = append(header, v2Version|v2CmdLocal, v2FamUnspec, 0, 0)
+		}
+		if v4 || v6 {
+			header = append(header, byte(srcTCP.Port>>8), byte(srcTCP.Port), byte(dstTCP.Port>>8), byte(dstTCP.Port))
+		}
+	default:
+		return fmt.Errorf("unknown PROXY protocol version %d", version)
+	}
+	_, err := w.Write(header)
+	return err
+}
+
+// ipv6 formats ip as an IPv6 address, the IPv4 addresses as IPv4-mapped ones.
+func ipv6(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
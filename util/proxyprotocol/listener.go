@@ -0,0 +1,145 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/3
+
+package proxyprotocol
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/crochee/proxy/util/ip"
+)
+
+// headerTimeout bounds the wait of the header, the connections sending nothing meanwhile have none.
+const headerTimeout = 10 * time.Second
+
+// Listener reads the PROXY protocol header of the connections of the trusted sources,
+// their remote and local addresses are those of the header.
+type Listener struct {
+	net.Listener
+	// checker holds the trusted sources, nil trusts them all.
+	checker *ip.Checker
+}
+
+// NewListener wraps listener, the header of a connection is only read when its source is trusted:
+// insecure trusts every source, otherwise trustedIPs holds the trusted IPs and CIDRs.
+func NewListener(listener net.Listener, insecure bool, trustedIPs []string) (*Listener, error) {
+	l := &Listener{Listener: listener}
+	if insecure {
+		return l, nil
+	}
+	var err error
+	if l.checker, err = ip.NewChecker(trustedIPs); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Accept waits for the next connection, the header is read by the first call to its Read,
+// RemoteAddr or LocalAddr methods so that a slow client does not block the listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.checker != nil && l.checker.IsAuthorized(conn.RemoteAddr().String()) != nil {
+		return conn, nil
+	}
+	return &Conn{Conn: conn, br: bufio.NewReader(conn)}, nil
+}
+
+// Conn is a connection from a trusted source which may start with a PROXY protocol header.
+type Conn struct {
+	net.Conn
+	br   *bufio.Reader
+	once sync.Once
+	src  net.Addr
+	dst  net.Addr
+	err  error
+
+	mu sync.Mutex
+	// readDeadline is the deadline set by the caller, restored once the header is read.
+	readDeadline time.Time
+	parsing      bool
+}
+
+// readHeader reads the header once.
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.parsing = true
+		_ = c.Conn.SetReadDeadline(time.Now().Add(headerTimeout))
+		c.mu.Unlock()
+
+		c.src, c.dst, c.err = ReadHeader(c.br)
+		var netErr net.Error
+		if errors.As(c.err, &netErr) && netErr.Timeout() && c.br.Buffered() == 0 {
+			// the client waits for the server to speak first, the error kept by br is discarded.
+			_, _ = c.br.Read(nil)
+			c.err = nil
+		}
+
+		c.mu.Lock()
+		c.parsing = false
+		_ = c.Conn.SetReadDeadline(c.readDeadline)
+		c.mu.Unlock()
+	})
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(p)
+}
+
+// RemoteAddr returns the source address of the header, the address of the peer without header.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.src != nil {
+		return c.src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address of the header, the local address without header.
+func (c *Conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.dst != nil {
+		return c.dst
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	if c.parsing {
+		return c.Conn.SetWriteDeadline(t)
+	}
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	if c.parsing {
+		return nil
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+// CloseWrite half-closes the connection.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.New("the connection cannot be half-closed")
+}
@@ -0,0 +1,145 @@
+// Copyright 2020, The Go Authors. All rights reserved.
+// Author: OnlyOneFace
+// Date: 2021/2/3
+
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src, dst net.Addr
+	}{
+		{
+			name: "tcp4",
+			src:  &net.TCPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 51234},
+			dst:  &net.TCPAddr{IP: net.ParseIP("198.51.100.2").To4(), Port: 443},
+		},
+		{
+			name: "tcp6",
+			src:  &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51234},
+			dst:  &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443},
+		},
+		{
+			name: "mixed",
+			src:  &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51234},
+			dst:  &net.TCPAddr{IP: net.ParseIP("::ffff:198.51.100.2"), Port: 443},
+		},
+		{
+			name: "unknown",
+			src:  &net.UnixAddr{Name: "/tmp/a.sock", Net: "unix"},
+		},
+	}
+	for _, version := range []int{1, 2} {
+		for _, tc := range testCases {
+			var buf bytes.Buffer
+			if err := WriteHeader(&buf, version, tc.src, tc.dst); err != nil {
+				t.Fatalf("v%d %s: %v", version, tc.name, err)
+			}
+			buf.WriteString("payload")
+			br := bufio.NewReader(&buf)
+			src, dst, err := ReadHeader(br)
+			if err != nil {
+				t.Fatalf("v%d %s: %v", version, tc.name, err)
+			}
+			if _, ok := tc.src.(*net.TCPAddr); !ok {
+				if src != nil || dst != nil {
+					t.Errorf("v%d %s: got %v %v, want no address", version, tc.name, src, dst)
+				}
+			} else if src.String() != tc.src.String() || dst.String() != tc.dst.String() {
+				t.Errorf("v%d %s: got %v %v, want %v %v", version, tc.name, src, dst, tc.src, tc.dst)
+			}
+			if rest, _ := ioutil.ReadAll(br); string(rest) != "payload" {
+				t.Errorf("v%d %s: the header is followed by %q", version, tc.name, rest)
+			}
+		}
+	}
+}
+
+func TestReadHeaderInvalid(t *testing.T) {
+	for _, header := range []string{
+		"PROXY TCP4 192.0.2.1 198.51.100.2 51234\r\n",
+		"PROXY TCP4 2001:db8::1 198.51.100.2 51234 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.2 51234 443" + strings.Repeat(" ", 100) + "\r\n",
+		"\r\n\r\n\x00\r\nQUIT\n\x31\x11\x00\x00",
+	} {
+		if _, _, err := ReadHeader(bufio.NewReader(strings.NewReader(header))); err == nil {
+			t.Errorf("%q: expected an error", header)
+		}
+	}
+	// the connections without header are read as is.
+	for _, data := range []string{"GET / HTTP/1.1\r\n", "PRI * HTTP/2.0\r\n", "\r\n"} {
+		br := bufio.NewReader(strings.NewReader(data))
+		if src, _, err := ReadHeader(br); src != nil || err != nil {
+			t.Errorf("%q: got %v %v, want no header", data, src, err)
+		}
+		if rest, _ := ioutil.ReadAll(br); string(rest) != data {
+			t.Errorf("%q: read %q", data, rest)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	testCases := []struct {
+		name       string
+		trustedIPs []string
+		trusted    bool
+	}{
+		{name: "trusted", trustedIPs: []string{"127.0.0.0/8"}, trusted: true},
+		{name: "untrusted", trustedIPs: []string{"10.0.0.0/8"}},
+	}
+	client := &net.TCPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 51234}
+	for _, tc := range testCases {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var listener *Listener
+		if listener, err = NewListener(ln, false, tc.trustedIPs); err != nil {
+			t.Fatal(err)
+		}
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = WriteHeader(conn, 2, client, &net.TCPAddr{IP: net.ParseIP("198.51.100.2").To4(), Port: 443}); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = conn.Write([]byte("ping"))
+		conn.Close()
+
+		accepted, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(accepted)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if tc.trusted {
+			if got := accepted.RemoteAddr().String(); got != client.String() {
+				t.Errorf("%s: got the remote address %s, want %s", tc.name, got, client)
+			}
+			if string(data) != "ping" {
+				t.Errorf("%s: read %q, want ping", tc.name, data)
+			}
+		} else {
+			if got := accepted.RemoteAddr().String(); got == client.String() {
+				t.Errorf("%s: the header of an untrusted source is read", tc.name)
+			}
+			if !bytes.HasSuffix(data, []byte("ping")) || len(data) == len("ping") {
+				t.Errorf("%s: read %q, want the header and ping", tc.name, data)
+			}
+		}
+		accepted.Close()
+		listener.Close()
+	}
+}